@@ -0,0 +1,130 @@
+package scan
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/cloudflare/cfssl/scan/crypto/tls"
+)
+
+// Baseline records the outcome of a default handshake with a host, against
+// which later handshakes can be compared to detect configuration changes.
+type Baseline struct {
+	Version     uint16 `json:"version"`
+	CipherSuite uint16 `json:"cipher_suite"`
+	// Leaf is the hex SHA-256 fingerprint of the host's leaf certificate.
+	Leaf string `json:"leaf"`
+	// Chain holds the hex SHA-256 fingerprints of the rest of the host's
+	// chain, in the order it was sent.
+	Chain []string `json:"chain"`
+}
+
+// RecordBaseline handshakes with the host, returning a Baseline of the outcome
+// for later use in Options.
+func RecordBaseline(host string, opts *Options) (*Baseline, error) {
+	if opts == nil {
+		opts = new(Options)
+	}
+	addr, hostname := opts.dialAddr(host)
+	return currentBaseline(addr, hostname, opts)
+}
+
+// currentBaseline returns a Baseline of a handshake with the host.
+func currentBaseline(addr, hostname string, opts *Options) (*Baseline, error) {
+	conn, err := tls.DialWithDialer(Dialer, Network, addr, opts.tlsConfig(hostname))
+	if err != nil {
+		return nil, err
+	}
+	conn.Close()
+
+	state := conn.ConnectionState()
+	leaf, err := leafCert(state)
+	if err != nil {
+		return nil, err
+	}
+
+	baseline := &Baseline{
+		Version:     state.Version,
+		CipherSuite: state.CipherSuite,
+		Leaf:        fmt.Sprintf("%x", sha256.Sum256(leaf.Raw)),
+		Chain:       []string{},
+	}
+	for _, cert := range state.PeerCertificates[1:] {
+		baseline.Chain = append(baseline.Chain, fmt.Sprintf("%x", sha256.Sum256(cert.Raw)))
+	}
+	return baseline, nil
+}
+
+// baselineChange describes a difference between a host's baseline and its
+// current handshake.
+type baselineChange struct {
+	Field    string      `json:"field"`
+	Baseline interface{} `json:"baseline"`
+	Current  interface{} `json:"current"`
+}
+
+// diff lists the differences from b to current.
+func (b *Baseline) diff(current *Baseline) []baselineChange {
+	changes := []baselineChange{}
+	if b.Version != current.Version {
+		field := "version_upgrade"
+		if current.Version < b.Version {
+			field = "version_downgrade"
+		}
+		changes = append(changes, baselineChange{field, tls.Versions[b.Version], tls.Versions[current.Version]})
+	}
+	if b.CipherSuite != current.CipherSuite {
+		changes = append(changes, baselineChange{"cipher_suite", tls.CipherSuites[b.CipherSuite].Name, tls.CipherSuites[current.CipherSuite].Name})
+	}
+	if b.Leaf != current.Leaf {
+		changes = append(changes, baselineChange{"leaf", b.Leaf, current.Leaf})
+	}
+
+	removed, added := []string{}, []string{}
+	inCurrent := make(map[string]bool)
+	for _, fp := range current.Chain {
+		inCurrent[fp] = true
+	}
+	inBaseline := make(map[string]bool)
+	for _, fp := range b.Chain {
+		inBaseline[fp] = true
+		if !inCurrent[fp] {
+			removed = append(removed, fp)
+		}
+	}
+	for _, fp := range current.Chain {
+		if !inBaseline[fp] {
+			added = append(added, fp)
+		}
+	}
+	if len(removed) > 0 || len(added) > 0 {
+		changes = append(changes, baselineChange{"chain", removed, added})
+	}
+	return changes
+}
+
+// baselineDiffScan compares a default handshake with the host to the baseline
+// given in opts, listing what changed: the version, cipher suite, leaf, or
+// intermediates, with certificates removed from or added to the chain given
+// as the baseline and current values respectively. Any change is warned of.
+// Scans without a baseline are skipped.
+func baselineDiffScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	if opts.Baseline == nil {
+		grade = Skipped
+		return
+	}
+
+	current, err := currentBaseline(addr, hostname, opts)
+	if err != nil {
+		return
+	}
+
+	changes := opts.Baseline.diff(current)
+	output = changes
+	if len(changes) > 0 {
+		grade = Warning
+	} else {
+		grade = Good
+	}
+	return
+}
@@ -0,0 +1,35 @@
+package scan
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cloudflare/cfssl/scan/crypto/tls"
+)
+
+func TestBaselineDiff(t *testing.T) {
+	baseline := &Baseline{
+		Version:     tls.VersionTLS12,
+		CipherSuite: tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		Leaf:        "aa",
+		Chain:       []string{"bb", "cc"},
+	}
+	if changes := baseline.diff(baseline); len(changes) != 0 {
+		t.Errorf("diff of a baseline with itself = %v, want none", changes)
+	}
+
+	current := &Baseline{
+		Version:     tls.VersionTLS11,
+		CipherSuite: tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		Leaf:        "dd",
+		Chain:       []string{"bb", "ee"},
+	}
+	want := []baselineChange{
+		{"version_downgrade", "TLS 1.2", "TLS 1.1"},
+		{"leaf", "aa", "dd"},
+		{"chain", []string{"cc"}, []string{"ee"}},
+	}
+	if changes := baseline.diff(current); !reflect.DeepEqual(changes, want) {
+		t.Errorf("diff = %v, want %v", changes, want)
+	}
+}
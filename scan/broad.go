@@ -15,8 +15,8 @@ var Broad = &Family{
 	Description: "Large scale scans of TLS hosts",
 	Scanners: map[string]*Scanner{
 		"IntermediateCAs": {
-			"Scans a CIDR IP range for unknown Intermediate CAs",
-			intermediateCAScan,
+			Description: "Scans a CIDR IP range for unknown Intermediate CAs",
+			scan:        intermediateCAScan,
 		},
 	},
 }
@@ -37,7 +37,7 @@ var (
 )
 
 // intermediateCAScan scans for new intermediate CAs not in the trust store.
-func intermediateCAScan(addr, hostname string) (grade Grade, output Output, err error) {
+func intermediateCAScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
 	cidr, port, _ := net.SplitHostPort(addr)
 	_, ipnet, err := net.ParseCIDR(cidr)
 	if err != nil {
@@ -0,0 +1,41 @@
+package scan
+
+import "sync"
+
+// A Collector aggregates scanner results and is safe for concurrent use.
+// The zero value is an empty Collector ready to use.
+type Collector struct {
+	mu      sync.Mutex
+	results map[string]FamilyResult
+}
+
+// Add records r as the result of the named scanner in the named family,
+// replacing any result previously added for it.
+func (c *Collector) Add(family, scanner string, r ScannerResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.results == nil {
+		c.results = make(map[string]FamilyResult)
+	}
+	if c.results[family] == nil {
+		c.results[family] = make(FamilyResult)
+	}
+	c.results[family][scanner] = r
+}
+
+// Snapshot returns a copy of the results collected so far. Later calls to Add
+// don't modify the returned maps; scanner outputs themselves are not copied.
+func (c *Collector) Snapshot() map[string]FamilyResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	results := make(map[string]FamilyResult, len(c.results))
+	for familyName, familyResult := range c.results {
+		results[familyName] = make(FamilyResult, len(familyResult))
+		for scannerName, result := range familyResult {
+			results[familyName][scannerName] = result
+		}
+	}
+	return results
+}
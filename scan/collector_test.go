@@ -0,0 +1,46 @@
+package scan
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestCollectorConcurrentAdd(t *testing.T) {
+	const families, scanners = 8, 50
+
+	var c Collector
+	var wg sync.WaitGroup
+	for i := 0; i < families; i++ {
+		for j := 0; j < scanners; j++ {
+			wg.Add(2)
+			go func(family, scanner string) {
+				defer wg.Done()
+				c.Add(family, scanner, ScannerResult{Grade: Good.String()})
+			}(fmt.Sprint("family", i), fmt.Sprint("scanner", j))
+			go func() {
+				defer wg.Done()
+				c.Snapshot()
+			}()
+		}
+	}
+	wg.Wait()
+
+	results := c.Snapshot()
+	if len(results) != families {
+		t.Fatalf("got %d families, want %d", len(results), families)
+	}
+	for familyName, familyResult := range results {
+		if len(familyResult) != scanners {
+			t.Errorf("%s: got %d scanners, want %d", familyName, len(familyResult), scanners)
+		}
+	}
+
+	// Snapshots must not share maps with the Collector.
+	results["family0"]["scanner0"] = ScannerResult{Grade: Bad.String()}
+	delete(results, "family1")
+	again := c.Snapshot()
+	if again["family0"]["scanner0"].Grade != Good.String() || again["family1"] == nil {
+		t.Error("modifying a snapshot changed the Collector")
+	}
+}
@@ -0,0 +1,242 @@
+package scan
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	stdtls "crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	"github.com/cloudflare/cfssl/scan/crypto/tls"
+)
+
+// A ComplianceProfile is a set of requirements on a host's TLS configuration,
+// such as those of a standard or a published server configuration. Zero
+// fields impose no requirement.
+type ComplianceProfile struct {
+	// MinVersion is the lowest protocol version the host may accept.
+	MinVersion uint16
+	// RequireTLS13 requires that the host accept TLS 1.3.
+	RequireTLS13 bool
+	// CipherSuites, if set, are the only cipher suites the host may accept
+	// below TLS 1.3.
+	CipherSuites []uint16
+	// MinCipherBits is the lowest symmetric key strength of the cipher suites
+	// the host may accept.
+	MinCipherBits int
+	// ForwardSecrecy requires that every cipher suite the host accepts be
+	// forward secret.
+	ForwardSecrecy bool
+	// MinRSABits and MinECDSABits are the smallest leaf keys allowed.
+	MinRSABits, MinECDSABits int
+}
+
+// ComplianceProfiles are the profiles the ComplianceProfile scanner can
+// evaluate hosts against, by name. More may be added.
+var ComplianceProfiles = map[string]*ComplianceProfile{
+	// https://wiki.mozilla.org/Security/Server_Side_TLS
+	"Mozilla Modern": {
+		MinVersion:     tls.VersionTLS13,
+		RequireTLS13:   true,
+		ForwardSecrecy: true,
+		MinRSABits:     2048,
+		MinECDSABits:   256,
+	},
+	"Mozilla Intermediate": {
+		MinVersion: tls.VersionTLS12,
+		CipherSuites: []uint16{
+			0xc02b, 0xc02f, 0xc02c, 0xc030, 0xcca9, 0xcca8, // ECDHE with AES-GCM and ChaCha20-Poly1305
+			0x009e, 0x009f, 0xccaa, // DHE with AES-GCM and ChaCha20-Poly1305
+		},
+		ForwardSecrecy: true,
+		MinRSABits:     2048,
+		MinECDSABits:   256,
+	},
+	// PCI DSS v4.0 requirement 4.2.1, with strong cryptography as defined in
+	// its glossary.
+	"PCI-DSS": {
+		MinVersion:    tls.VersionTLS12,
+		MinCipherBits: 128,
+		MinRSABits:    2048,
+		MinECDSABits:  224,
+	},
+	// NIST SP 800-52 Rev. 2, section 3.
+	"NIST-800-52": {
+		MinVersion:    tls.VersionTLS12,
+		RequireTLS13:  true,
+		MinCipherBits: 128,
+		MinRSABits:    2048,
+		MinECDSABits:  256,
+	},
+}
+
+// versionName returns the name of a protocol version, including TLS 1.3.
+func versionName(vers uint16) string {
+	if vers == tls.VersionTLS13 {
+		return "TLS 1.3"
+	}
+	return tls.Versions[vers]
+}
+
+// complianceRequirement is whether the host meets one of a profile's requirements.
+type complianceRequirement struct {
+	Requirement string `json:"requirement"`
+	Met         bool   `json:"met"`
+	Detail      string `json:"detail,omitempty"`
+}
+
+// compliance is the evaluation of the host against a profile.
+type compliance struct {
+	Profile      string                  `json:"profile"`
+	Compliant    bool                    `json:"compliant"`
+	Requirements []complianceRequirement `json:"requirements"`
+}
+
+// require records whether a requirement is met, with details of how it isn't.
+func (c *compliance) require(requirement string, failures []string) {
+	c.Requirements = append(c.Requirements, complianceRequirement{requirement, len(failures) == 0, strings.Join(failures, ", ")})
+	if len(failures) > 0 {
+		c.Compliant = false
+	}
+}
+
+// evaluateCompliance evaluates the versions and cipher suites found by
+// cipherSuiteScan, whether the host accepts TLS 1.3, and its leaf against
+// profile.
+func evaluateCompliance(name string, profile *ComplianceProfile, cvList cipherVersionList, tls13 bool, leaf *x509.Certificate) *compliance {
+	result := &compliance{Profile: name, Compliant: true}
+
+	if profile.MinVersion != 0 {
+		var below []string
+		seen := make(map[uint16]bool)
+		for _, cv := range cvList {
+			for _, d := range cv.data {
+				if d.versionID < profile.MinVersion && !seen[d.versionID] {
+					seen[d.versionID] = true
+					below = append(below, versionName(d.versionID))
+				}
+			}
+		}
+		result.require("minimum version "+versionName(profile.MinVersion), below)
+	}
+	if profile.RequireTLS13 {
+		var failures []string
+		if !tls13 {
+			failures = []string{"TLS 1.3 not accepted"}
+		}
+		result.require("TLS 1.3 supported", failures)
+	}
+
+	if len(profile.CipherSuites) > 0 {
+		allowed := make(map[uint16]bool)
+		for _, id := range profile.CipherSuites {
+			allowed[id] = true
+		}
+		var disallowed []string
+		for _, cv := range cvList {
+			if !allowed[cv.cipherID] {
+				disallowed = append(disallowed, tls.CipherSuites[cv.cipherID].Name)
+			}
+		}
+		result.require("allowed cipher suites only", disallowed)
+	}
+	if profile.MinCipherBits > 0 {
+		var weak []string
+		for _, cv := range cvList {
+			if cipherBits(cv.cipherID) < profile.MinCipherBits {
+				weak = append(weak, tls.CipherSuites[cv.cipherID].Name)
+			}
+		}
+		result.require(fmt.Sprintf("cipher strength of at least %d bits", profile.MinCipherBits), weak)
+	}
+	if profile.ForwardSecrecy {
+		var static []string
+		for _, cv := range cvList {
+			if !tls.CipherSuites[cv.cipherID].ForwardSecret {
+				static = append(static, tls.CipherSuites[cv.cipherID].Name)
+			}
+		}
+		result.require("forward secrecy", static)
+	}
+
+	if profile.MinRSABits > 0 || profile.MinECDSABits > 0 {
+		var failures []string
+		switch key := leaf.PublicKey.(type) {
+		case *rsa.PublicKey:
+			if bits := key.N.BitLen(); bits < profile.MinRSABits {
+				failures = append(failures, fmt.Sprintf("%d-bit RSA key", bits))
+			}
+		case *ecdsa.PublicKey:
+			if bits := key.Params().BitSize; bits < profile.MinECDSABits {
+				failures = append(failures, fmt.Sprintf("%d-bit ECDSA key", bits))
+			}
+		}
+		result.require("leaf key size", failures)
+	}
+	return result
+}
+
+// complianceProfileScan evaluates the host against the entry of
+// ComplianceProfiles named by opts.ComplianceProfile, enumerating its
+// versions and cipher suites and checking its leaf's key, and reports whether
+// it meets each of the profile's requirements. Hosts failing any are graded
+// Bad. The scan is skipped if no profile is named.
+func complianceProfileScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	if opts.ComplianceProfile == "" {
+		grade = Skipped
+		return
+	}
+	profile, ok := ComplianceProfiles[opts.ComplianceProfile]
+	if !ok {
+		err = fmt.Errorf("unknown compliance profile %q", opts.ComplianceProfile)
+		return
+	}
+
+	var suites []uint16
+	for id := range tls.TLS13CipherSuites {
+		suites = append(suites, id)
+	}
+	_, tls13, herr := tls13Hello(addr, hostname, opts, suites, tls13Groups)
+	tls13 = tls13 && herr == nil
+
+	// Hosts accepting only TLS 1.3 negotiate nothing with cipherSuiteScan, and
+	// can only give up their chain to crypto/tls.
+	_, cvOutput, err := cipherSuiteScan(addr, hostname, opts)
+	if err == errNoCipherSuites && tls13 {
+		err = nil
+	}
+	if err != nil {
+		return
+	}
+	cvList, _ := cvOutput.(cipherVersionList)
+
+	chain, err := getChain(addr, opts.tlsConfig(hostname))
+	if err != nil && tls13 {
+		chain, err = stdChain(addr, hostname)
+	}
+	if err != nil {
+		return
+	}
+
+	result := evaluateCompliance(opts.ComplianceProfile, profile, cvList, tls13, chain[0])
+	output = result
+	if result.Compliant {
+		grade = Good
+	}
+	return
+}
+
+// stdChain returns the certificate chain the host presents to crypto/tls.
+func stdChain(addr, hostname string) ([]*x509.Certificate, error) {
+	conn, err := stdtls.DialWithDialer(Dialer, Network, addr, &stdtls.Config{ServerName: hostname, InsecureSkipVerify: true})
+	if err != nil {
+		return nil, err
+	}
+	conn.Close()
+	chain := conn.ConnectionState().PeerCertificates
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("%s: %v", addr, errNoLeaf)
+	}
+	return chain, nil
+}
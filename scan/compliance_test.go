@@ -0,0 +1,41 @@
+package scan
+
+import (
+	"crypto/x509"
+	"testing"
+
+	"github.com/cloudflare/cfssl/scan/crypto/tls"
+)
+
+func TestEvaluateCompliance(t *testing.T) {
+	leaf := &x509.Certificate{PublicKey: &testKey(t).PublicKey}
+
+	modern := cipherVersionList{
+		{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, []cipherDatum{{versionID: tls.VersionTLS12}}},
+	}
+	legacy := append(cipherVersionList{
+		{tls.TLS_RSA_WITH_AES_128_CBC_SHA, []cipherDatum{{versionID: tls.VersionTLS12}, {versionID: tls.VersionTLS10}}},
+	}, modern...)
+
+	tests := []struct {
+		profile   string
+		cvList    cipherVersionList
+		tls13     bool
+		compliant bool
+	}{
+		{"Mozilla Intermediate", modern, false, true},
+		{"Mozilla Intermediate", legacy, true, false},
+		{"PCI-DSS", modern, false, true},
+		{"PCI-DSS", legacy, false, false},
+		{"NIST-800-52", modern, false, false},
+		{"NIST-800-52", modern, true, true},
+		{"Mozilla Modern", modern, true, false},
+		{"Mozilla Modern", nil, true, true},
+	}
+	for _, test := range tests {
+		result := evaluateCompliance(test.profile, ComplianceProfiles[test.profile], test.cvList, test.tls13, leaf)
+		if result.Compliant != test.compliant {
+			t.Errorf("%s: compliant = %v, want %v: %+v", test.profile, result.Compliant, test.compliant, result.Requirements)
+		}
+	}
+}
@@ -2,11 +2,25 @@ package scan
 
 import (
 	"bufio"
+	stdcontext "context"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"math/rand"
 	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/cloudflare/cfssl/log"
 	"github.com/cloudflare/cfssl/scan/crypto/tls"
 )
 
@@ -15,26 +29,116 @@ var Connectivity = &Family{
 	Description: "Scans for basic connectivity with the host through DNS and TCP/TLS dials",
 	Scanners: map[string]*Scanner{
 		"DNSLookup": {
-			"Host can be resolved through DNS",
-			dnsLookupScan,
+			Description: "Host can be resolved through DNS",
+			scan:        dnsLookupScan,
+			Summarize:   summarizeAddresses,
+		},
+		"DNSConsistency": {
+			Description: "Host resolves to the same addresses on repeated lookups",
+			scan:        dnsConsistencyScan,
 		},
 		"CloudFlareStatus": {
-			"Host is on CloudFlare",
-			onCloudFlareScan,
+			Description: "Host is on CloudFlare",
+			scan:        onCloudFlareScan,
+			Summarize:   summarizeCloudFlareStatus,
+		},
+		"IPLocation": {
+			Description: "Determines the network and country of each of host's addresses",
+			scan:        ipLocationScan,
+		},
+		"CDNDetection": {
+			Description: "Determines which CDN, if any, the host is behind",
+			scan:        cdnDetectionScan,
 		},
 		"TCPDial": {
-			"Host accepts TCP connection",
-			tcpDialScan,
+			Description: "Host accepts TCP connection",
+			scan:        tcpDialScan,
+		},
+		"TCPConnectTime": {
+			Description: "Host's TCP handshake completes with a low round trip time",
+			scan:        tcpConnectTimeScan,
 		},
 		"TLSDial": {
-			"Host can perform TLS handshake",
-			tlsDialScan,
+			Description: "Host can perform TLS handshake",
+			scan:        tlsDialScan,
+		},
+		"ClientHelloSpec": {
+			Description: "Host completes a handshake with the configured ClientHello",
+			scan:        clientHelloSpecScan,
+		},
+		"CloseNotify": {
+			Description: "Host sends a TLS close_notify before closing the connection",
+			scan:        closeNotifyScan,
+			Summarize:   summarizeString,
+		},
+		"SmallMSS": {
+			Description: "Host completes a TLS handshake over a connection with a small TCP MSS",
+			scan:        smallMSSScan,
+		},
+		"HandshakeSuccessRate": {
+			Description: "Host completes repeated handshakes without intermittent failures",
+			scan:        handshakeSuccessRateScan,
+		},
+		"LossyLink": {
+			Description: "Determines how long the handshake takes over a simulated high-latency, lossy link",
+			scan:        lossyLinkScan,
+		},
+		"PortConsistency": {
+			Description: "Host's TLS ports serve the same certificate with equally strong configurations",
+			scan:        portConsistencyScan,
+		},
+		"PlaintextExposure": {
+			Description: "Host's plaintext HTTP port is closed or redirects to HTTPS",
+			scan:        plaintextExposureScan,
+		},
+		"CrossWiredListener": {
+			Description: "Host's plaintext HTTP port doesn't speak TLS, nor its TLS port plaintext",
+			scan:        crossWiredListenerScan,
+		},
+		"QUIC": {
+			Description: "Host offers HTTP/3, advancing a QUIC handshake on UDP port 443",
+			scan:        quicScan,
 		},
 	},
 }
 
-// dnsLookupScan tests that DNS resolution of the host returns at least one address
-func dnsLookupScan(addr, hostname string) (grade Grade, output Output, err error) {
+// summarizeString summarizes Output that is already a short string.
+func summarizeString(output Output) string {
+	return fmt.Sprint(output)
+}
+
+// summarizeAddresses summarizes a list of addresses.
+func summarizeAddresses(output Output) string {
+	addrs, ok := output.([]string)
+	if !ok {
+		return fmt.Sprint(output)
+	}
+	return fmt.Sprintf("%d addresses: %s", len(addrs), strings.Join(addrs, ", "))
+}
+
+// summarizeCloudFlareStatus summarizes which addresses are on CloudFlare.
+func summarizeCloudFlareStatus(output Output) string {
+	cfStatus, ok := output.(map[string]bool)
+	if !ok {
+		return fmt.Sprint(output)
+	}
+	onCloudFlare := 0
+	for _, on := range cfStatus {
+		if on {
+			onCloudFlare++
+		}
+	}
+	return fmt.Sprintf("%d of %d addresses on CloudFlare", onCloudFlare, len(cfStatus))
+}
+
+// dnsLookupScan tests that DNS resolution of the host returns at least one address.
+// If opts overrides the host's address, that address is returned without a lookup.
+func dnsLookupScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	if ip := opts.overrideIP(); ip != "" {
+		grade, output = Good, []string{ip}
+		return
+	}
+
 	addrs, err := net.LookupHost(hostname)
 	if err != nil {
 		return
@@ -48,9 +152,59 @@ func dnsLookupScan(addr, hostname string) (grade Grade, output Output, err error
 	return
 }
 
+// DNSConsistencyQueries is the number of lookups dnsConsistencyScan compares.
+var DNSConsistencyQueries = 5
+
+// dnsConsistency lists the distinct address sets a host resolved to.
+type dnsConsistency struct {
+	Stable bool       `json:"stable"`
+	Sets   [][]string `json:"sets"`
+}
+
+// dnsConsistencyScan resolves the host DNSConsistencyQueries times, reporting
+// each distinct set of addresses seen. Hosts whose answer changes between
+// lookups, as with round robin DNS or GSLB, are warned of. Hosts whose address
+// is overridden by opts are skipped.
+func dnsConsistencyScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	if opts.overrideIP() != "" {
+		grade = Skipped
+		return
+	}
+
+	seen := make(map[string]bool)
+	result := dnsConsistency{Sets: [][]string{}}
+	for i := 0; i < DNSConsistencyQueries; i++ {
+		var addrs []string
+		addrs, err = net.LookupHost(hostname)
+		if err != nil {
+			return
+		}
+		sort.Strings(addrs)
+		if key := strings.Join(addrs, ","); !seen[key] {
+			seen[key] = true
+			result.Sets = append(result.Sets, addrs)
+		}
+	}
+	result.Stable = len(result.Sets) <= 1
+	output = result
+
+	if result.Stable {
+		grade = Good
+	} else {
+		grade = Warning
+	}
+	return
+}
+
 var (
 	cfNets    []*net.IPNet
 	cfNetsErr error
+
+	// CloudFlareIPURLs are the lists of CloudFlare's IP ranges.
+	CloudFlareIPURLs = []string{"https://www.cloudflare.com/ips-v4", "https://www.cloudflare.com/ips-v6"}
+	// CloudFlareIPsTimeout bounds the download of CloudFlare's IP ranges,
+	// regardless of any timeout configured on the shared Client.
+	CloudFlareIPsTimeout = 10 * time.Second
 )
 
 func initOnCloudFlareScan() ([]*net.IPNet, error) {
@@ -64,46 +218,83 @@ func initOnCloudFlareScan() ([]*net.IPNet, error) {
 		return cfNets, nil
 	}
 
-	// Download CloudFlare CIDR ranges and parse them.
-	v4resp, err := Client.Get("https://www.cloudflare.com/ips-v4")
+	ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), CloudFlareIPsTimeout)
+	defer cancel()
+
+	nets, err := downloadCloudFlareIPs(ctx)
 	if err != nil {
-		cfNetsErr = fmt.Errorf("Couldn't download CloudFlare IPs: %v", err)
+		if ctx.Err() == stdcontext.DeadlineExceeded {
+			// Don't cache timeouts, so a later scan may retry the download.
+			return nil, fmt.Errorf("Couldn't download CloudFlare IPs: timed out after %v", CloudFlareIPsTimeout)
+		}
+		cfNetsErr = err
 		return nil, cfNetsErr
 	}
-	defer v4resp.Body.Close()
 
-	v6resp, err := Client.Get("https://www.cloudflare.com/ips-v6")
+	cfNets = nets
+	return cfNets, nil
+}
+
+// getWithContext issues a GET for url through the shared Client, bounded by ctx.
+func getWithContext(ctx stdcontext.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		cfNetsErr = fmt.Errorf("Couldn't download CloudFlare IPs: %v", err)
-		return nil, cfNetsErr
+		return nil, err
 	}
-	defer v6resp.Body.Close()
+	return Client.Do(req.WithContext(ctx))
+}
 
-	scanner := bufio.NewScanner(io.MultiReader(v4resp.Body, v6resp.Body))
-	for scanner.Scan() {
-		_, ipnet, err := net.ParseCIDR(scanner.Text())
+// cidrPattern matches substrings that may be CIDR ranges in a published range list.
+var cidrPattern = regexp.MustCompile(`[0-9A-Fa-f:.]+/[0-9]{1,3}`)
+
+// downloadCIDRs downloads the given range lists and parses the CIDR ranges
+// in them. Lists may be plain text or JSON, as any CIDR ranges found are used.
+func downloadCIDRs(ctx stdcontext.Context, urls []string) (nets []*net.IPNet, err error) {
+	for _, url := range urls {
+		resp, err := getWithContext(ctx, url)
 		if err != nil {
-			cfNetsErr = fmt.Errorf("Couldn't parse CIDR range: %v", err)
-			return nil, cfNetsErr
+			return nil, err
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't read %s: %v", url, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("%s returned HTTP status %d", url, resp.StatusCode)
+		}
+
+		found := 0
+		for _, cidr := range cidrPattern.FindAllString(string(body), -1) {
+			if _, ipnet, err := net.ParseCIDR(cidr); err == nil {
+				nets = append(nets, ipnet)
+				found++
+			}
+		}
+		if found == 0 {
+			return nil, fmt.Errorf("Couldn't find any CIDR ranges in %s", url)
 		}
-		cfNets = append(cfNets, ipnet)
-	}
-	if err := scanner.Err(); err != nil {
-		cfNetsErr = fmt.Errorf("Couldn't read IP bodies: %v", err)
-		return nil, cfNetsErr
 	}
+	return nets, nil
+}
 
-	return cfNets, nil
+// downloadCloudFlareIPs downloads CloudFlare's CIDR ranges and parses them.
+func downloadCloudFlareIPs(ctx stdcontext.Context) ([]*net.IPNet, error) {
+	nets, err := downloadCIDRs(ctx, CloudFlareIPURLs)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't download CloudFlare IPs: %v", err)
+	}
+	return nets, nil
 }
 
-func onCloudFlareScan(addr, hostname string) (grade Grade, output Output, err error) {
+func onCloudFlareScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
 	var cloudflareNets []*net.IPNet
 	if cloudflareNets, err = initOnCloudFlareScan(); err != nil {
 		grade = Skipped
 		return
 	}
 
-	_, addrs, err := dnsLookupScan(addr, hostname)
+	_, addrs, err := dnsLookupScan(addr, hostname, opts)
 	if err != nil {
 		return
 	}
@@ -128,8 +319,101 @@ func onCloudFlareScan(addr, hostname string) (grade Grade, output Output, err er
 	return
 }
 
+var (
+	// CDNRangeURLs lists, for each CDN recognized by CDNDetection, the lists of
+	// its published IP ranges. Akamai doesn't publish its ranges at a stable
+	// URL, so it's only detected once its range lists are configured here, and
+	// is reported as not configured until then.
+	CDNRangeURLs = map[string][]string{
+		"CloudFlare": CloudFlareIPURLs,
+		"Fastly":     {"https://api.fastly.com/public-ip-list"},
+		"CloudFront": {"https://d7uri8nf7uskq.cloudfront.net/tools/list-cloudfront-ips"},
+		"Akamai":     nil,
+	}
+	// CDNRangesTimeout bounds the download of each CDN's IP ranges.
+	CDNRangesTimeout = 10 * time.Second
+
+	cdnNets   = make(map[string][]*net.IPNet)
+	cdnNetsMu sync.Mutex
+)
+
+// cdnRanges returns the IP ranges of the given CDN, downloading them if they
+// haven't been already. Failed downloads aren't cached, so they may be retried.
+func cdnRanges(cdn string) ([]*net.IPNet, error) {
+	cdnNetsMu.Lock()
+	defer cdnNetsMu.Unlock()
+
+	if nets, ok := cdnNets[cdn]; ok {
+		return nets, nil
+	}
+
+	ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), CDNRangesTimeout)
+	defer cancel()
+
+	nets, err := downloadCIDRs(ctx, CDNRangeURLs[cdn])
+	if err != nil {
+		return nil, err
+	}
+	cdnNets[cdn] = nets
+	return nets, nil
+}
+
+// cdnDetection gives the CDN each of the host's addresses belongs to, and the
+// CDNs that couldn't be checked for lack of configured range lists.
+type cdnDetection struct {
+	Addresses     map[string]string `json:"addresses"`
+	NotConfigured []string          `json:"not_configured,omitempty"`
+}
+
+// cdnDetectionScan reports which CDN, if any, each of the host's addresses
+// belongs to, or "origin" for those that belong to none of the CDNs with range
+// lists in CDNRangeURLs. Those without any are listed as not configured.
+func cdnDetectionScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	_, addrs, err := dnsLookupScan(addr, hostname, opts)
+	if err != nil {
+		return
+	}
+
+	var cdns, notConfigured []string
+	for cdn, urls := range CDNRangeURLs {
+		if len(urls) > 0 {
+			cdns = append(cdns, cdn)
+		} else {
+			notConfigured = append(notConfigured, cdn)
+		}
+	}
+	sort.Strings(cdns)
+	sort.Strings(notConfigured)
+
+	nets := make(map[string][]*net.IPNet, len(cdns))
+	for _, cdn := range cdns {
+		if nets[cdn], err = cdnRanges(cdn); err != nil {
+			log.Warningf("Couldn't download %s IP ranges: %v", cdn, err)
+			err = nil
+		}
+	}
+
+	detected := make(map[string]string)
+	for _, addr := range addrs.([]string) {
+		detected[addr] = "origin"
+		ip := net.ParseIP(addr)
+	cdnLoop:
+		for _, cdn := range cdns {
+			for _, ipnet := range nets[cdn] {
+				if ipnet.Contains(ip) {
+					detected[addr] = cdn
+					break cdnLoop
+				}
+			}
+		}
+	}
+
+	grade, output = Good, cdnDetection{detected, notConfigured}
+	return
+}
+
 // tcpDialScan tests that the host can be connected to through TCP.
-func tcpDialScan(addr, hostname string) (grade Grade, output Output, err error) {
+func tcpDialScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
 	conn, err := Dialer.Dial(Network, addr)
 	if err != nil {
 		return
@@ -139,11 +423,61 @@ func tcpDialScan(addr, hostname string) (grade Grade, output Output, err error)
 	return
 }
 
+var (
+	// tcpGoodRTT and tcpWarningRTT are the TCP connect times under which
+	// hosts are graded Good and Warning respectively.
+	tcpGoodRTT    = 50 * time.Millisecond
+	tcpWarningRTT = 200 * time.Millisecond
+)
+
+// tcpConnectTime reports the duration of a TCP handshake with an address.
+type tcpConnectTime struct {
+	IP    string  `json:"ip"`
+	RTTMS float64 `json:"rtt_ms"`
+}
+
+// tcpConnectTimeScan times the TCP three-way handshake with the host, which
+// takes a single network round trip, apart from any TLS negotiation. The host
+// is resolved beforehand, so that only the handshake with its first address
+// is timed.
+func tcpConnectTimeScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return
+	}
+	if len(ips) == 0 {
+		err = fmt.Errorf("%s has no addresses", host)
+		return
+	}
+	ip := ips[0].String()
+
+	start := time.Now()
+	conn, err := Dialer.Dial(Network, net.JoinHostPort(ip, port))
+	rtt := time.Since(start)
+	if err != nil {
+		return
+	}
+	conn.Close()
+
+	output = tcpConnectTime{IP: ip, RTTMS: rtt.Seconds() * 1000}
+	switch {
+	case rtt < tcpGoodRTT:
+		grade = Good
+	case rtt < tcpWarningRTT:
+		grade = Warning
+	}
+	return
+}
+
 // tlsDialScan tests that the host can perform a TLS Handshake
 // and warns if the server's certificate can't be verified.
-func tlsDialScan(addr, hostname string) (grade Grade, output Output, err error) {
+func tlsDialScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
 	var conn *tls.Conn
-	config := defaultTLSConfig(hostname)
+	config := opts.tlsConfig(hostname)
 
 	if conn, err = tls.DialWithDialer(Dialer, Network, addr, config); err != nil {
 		return
@@ -160,3 +494,568 @@ func tlsDialScan(addr, hostname string) (grade Grade, output Output, err error)
 	grade = Good
 	return
 }
+
+// clientHelloSpecScan tests that the host completes a handshake when sent the
+// ClientHello described by the scan's ClientHelloSpec, reporting the version
+// and cipher suite negotiated.
+func clientHelloSpecScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	if opts.ClientHello == nil {
+		grade = Skipped
+		return
+	}
+
+	conn, err := tls.DialWithDialer(Dialer, Network, addr, opts.tlsConfig(hostname))
+	if err != nil {
+		output = "handshake failed"
+		return
+	}
+	defer conn.Close()
+
+	state := conn.ConnectionState()
+	grade = Good
+	output = fmt.Sprintf("handshake succeeded: %s with %s", tls.Versions[state.Version], tls.CipherSuites[state.CipherSuite])
+	return
+}
+
+// closeNotifyTimeout bounds how long closeNotifyScan waits for the host to
+// close the connection after responding.
+var closeNotifyTimeout = 5 * time.Second
+
+// closeNotifyScan tests that the host sends a TLS close_notify alert before
+// closing the connection, rather than simply closing or resetting it.
+func closeNotifyScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	conn, err := tls.DialWithDialer(Dialer, Network, addr, opts.tlsConfig(hostname))
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// Ask the host to close the connection once it has responded.
+	if _, err = fmt.Fprintf(conn, "HEAD / HTTP/1.1\r\nHost: %s\r\nConnection: close\r\n\r\n", hostname); err != nil {
+		return
+	}
+
+	conn.SetReadDeadline(time.Now().Add(closeNotifyTimeout))
+	if _, err = io.Copy(ioutil.Discard, conn); err != nil {
+		if e, ok := err.(net.Error); ok && e.Timeout() {
+			err = fmt.Errorf("host didn't close the connection within %v", closeNotifyTimeout)
+			return
+		}
+		err = nil
+	}
+
+	if conn.ReceivedCloseNotify() {
+		grade, output = Good, "clean close"
+	} else {
+		grade, output = Warning, "abrupt close"
+	}
+	return
+}
+
+// DefaultTLSPorts are the ports commonly offering TLS that DiscoverTLSPorts
+// probes when none are given.
+var DefaultTLSPorts = []int{443, 8443, 993, 995, 465, 636}
+
+// PortResult describes whether a TLS service was found on a port.
+type PortResult struct {
+	Grade   string `json:"grade"`
+	Subject string `json:"subject,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// DiscoverTLSPorts concurrently probes the given ports of host, or DefaultTLSPorts
+// if none are given, for TLS services. Ports completing a handshake are graded
+// Good and report their leaf's subject, ports accepting TCP but failing the
+// handshake are graded Bad, and ports refusing connections are Skipped.
+func DiscoverTLSPorts(host string, ports []int) map[int]PortResult {
+	if len(ports) == 0 {
+		ports = DefaultTLSPorts
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	results := make(map[int]PortResult, len(ports))
+	wg.Add(len(ports))
+	for _, port := range ports {
+		go func(port int) {
+			defer wg.Done()
+			result := discoverTLSPort(net.JoinHostPort(host, strconv.Itoa(port)), host)
+			mu.Lock()
+			results[port] = result
+			mu.Unlock()
+		}(port)
+	}
+	wg.Wait()
+	return results
+}
+
+// discoverTLSPort probes a single address for a TLS service.
+func discoverTLSPort(addr, hostname string) (result PortResult) {
+	opts := new(Options)
+	if _, _, err := tcpDialScan(addr, hostname, opts); err != nil {
+		result.Grade, result.Error = Skipped.String(), err.Error()
+		return
+	}
+
+	// tlsDialScan only grades Bad when the handshake itself fails.
+	if grade, _, err := tlsDialScan(addr, hostname, opts); grade == Bad {
+		result.Grade, result.Error = Bad.String(), err.Error()
+		return
+	}
+
+	result.Grade = Good.String()
+	if chain, err := getChain(addr, opts.tlsConfig(hostname)); err == nil {
+		result.Subject = chain[0].Subject.CommonName
+	}
+	return
+}
+
+// portHandshakeTimeout bounds each handshake of portConsistencyScan, so that
+// ports not speaking TLS don't stall it.
+var portHandshakeTimeout = 10 * time.Second
+
+// portConfig describes the handshake negotiated on one of the host's ports.
+type portConfig struct {
+	Version     string `json:"version,omitempty"`
+	CipherSuite string `json:"cipher_suite,omitempty"`
+	// Fingerprint is the SHA-256 fingerprint of the port's leaf certificate.
+	Fingerprint string `json:"fingerprint,omitempty"`
+	Error       string `json:"error,omitempty"`
+
+	version       uint16
+	forwardSecret bool
+}
+
+// weaker reports whether c is a weaker configuration than other: an older
+// version, or the same version without forward secrecy where other has it.
+func (c *portConfig) weaker(other *portConfig) bool {
+	if c.version != other.version {
+		return c.version < other.version
+	}
+	return !c.forwardSecret && other.forwardSecret
+}
+
+// portConsistency compares the handshakes of the host's TLS ports.
+type portConsistency struct {
+	Ports map[int]*portConfig `json:"ports"`
+	// Divergent lists the properties that differ between ports.
+	Divergent []string `json:"divergent,omitempty"`
+}
+
+// portConsistencyScan handshakes with the scanned port and each of
+// opts.Ports, or DefaultTLSPorts, comparing the version, cipher suite, and
+// leaf certificate each negotiates. Ports refusing connections are left out.
+// Hosts with a port negotiating a weaker configuration than another, or
+// failing the handshake, are warned of.
+func portConsistencyScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	host, scanned, err := net.SplitHostPort(addr)
+	if err != nil {
+		return
+	}
+	ports := opts.Ports
+	if len(ports) == 0 {
+		ports = DefaultTLSPorts
+	}
+	if p, perr := strconv.Atoi(scanned); perr == nil {
+		ports = append([]int{p}, ports...)
+	}
+
+	result := portConsistency{Ports: make(map[int]*portConfig)}
+	for _, port := range ports {
+		if _, seen := result.Ports[port]; seen {
+			continue
+		}
+		portAddr := net.JoinHostPort(host, strconv.Itoa(port))
+		tcpConn, derr := Dialer.Dial(Network, portAddr)
+		if derr != nil {
+			continue
+		}
+		tcpConn.SetDeadline(time.Now().Add(portHandshakeTimeout))
+		conn := tls.Client(tcpConn, opts.tlsConfig(hostname))
+		herr := conn.Handshake()
+		conn.Close()
+		if herr != nil {
+			result.Ports[port] = &portConfig{Error: herr.Error()}
+			continue
+		}
+
+		state := conn.ConnectionState()
+		config := &portConfig{
+			Version:       tls.Versions[state.Version],
+			CipherSuite:   tls.CipherSuites[state.CipherSuite].String(),
+			version:       state.Version,
+			forwardSecret: tls.CipherSuites[state.CipherSuite].ForwardSecret,
+		}
+		if leaf, lerr := leafCert(state); lerr == nil {
+			config.Fingerprint = fmt.Sprintf("%x", sha256.Sum256(leaf.Raw))
+		}
+		result.Ports[port] = config
+	}
+	output = &result
+
+	grade = Good
+	divergent := make(map[string]bool)
+	for _, a := range result.Ports {
+		if a.Error != "" {
+			grade = Warning
+			continue
+		}
+		for _, b := range result.Ports {
+			if b.Error != "" {
+				continue
+			}
+			if a.weaker(b) {
+				grade = Warning
+			}
+			divergent["version"] = divergent["version"] || a.Version != b.Version
+			divergent["cipher_suite"] = divergent["cipher_suite"] || a.CipherSuite != b.CipherSuite
+			divergent["certificate"] = divergent["certificate"] || a.Fingerprint != b.Fingerprint
+		}
+	}
+	for _, property := range []string{"version", "cipher_suite", "certificate"} {
+		if divergent[property] {
+			result.Divergent = append(result.Divergent, property)
+		}
+	}
+	return
+}
+
+var (
+	// smallMSS is the TCP maximum segment size smallMSSScan advertises,
+	// the minimum every IPv4 host must accept.
+	smallMSS = 536
+	// smallMSSTimeout bounds how long smallMSSScan waits for the handshake
+	// to complete before judging it stalled.
+	smallMSSTimeout = 10 * time.Second
+)
+
+// errMSSUnsupported is returned by setMSS on platforms where it isn't implemented.
+var errMSSUnsupported = errors.New("setting the TCP MSS isn't supported on this platform")
+
+// smallMSSResult describes a handshake attempted with a small TCP MSS.
+type smallMSSResult struct {
+	MSS       int  `json:"mss"`
+	Completed bool `json:"completed"`
+}
+
+// smallMSSScan attempts a TLS handshake over a connection advertising a small
+// TCP MSS, so that the host must split its flight of handshake messages into
+// many segments. A handshake that stalls indicates a path MTU problem.
+func smallMSSScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	dialer := &net.Dialer{
+		Timeout: Dialer.Timeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			return setMSS(c, smallMSS)
+		},
+	}
+	conn, err := dialer.Dial(Network, addr)
+	if err != nil {
+		if e, ok := err.(*net.OpError); ok && e.Err == errMSSUnsupported {
+			grade, err = Skipped, nil
+		}
+		return
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(smallMSSTimeout))
+	err = tls.Client(conn, opts.tlsConfig(hostname)).Handshake()
+	if e, ok := err.(net.Error); ok && e.Timeout() {
+		output = smallMSSResult{MSS: smallMSS}
+		err = fmt.Errorf("handshake stalled for %v", smallMSSTimeout)
+		return
+	} else if err != nil {
+		return
+	}
+
+	grade, output = Good, smallMSSResult{MSS: smallMSS, Completed: true}
+	return
+}
+
+// plaintextReadTimeout bounds how long plaintextExposureScan waits for the
+// host to respond on its plaintext HTTP port.
+var plaintextReadTimeout = 5 * time.Second
+
+// plaintextExposure describes the host's response on its plaintext HTTP port.
+type plaintextExposure struct {
+	Open          bool `json:"open"`
+	StatusCode    int  `json:"status_code,omitempty"`
+	HTTPSRedirect bool `json:"https_redirect"`
+}
+
+// plaintextExposureScan tests that port 80 of the host is either closed or
+// redirects to HTTPS, rather than serving content in plaintext.
+func plaintextExposureScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return
+	}
+
+	conn, err := Dialer.Dial(Network, net.JoinHostPort(host, "80"))
+	if err != nil {
+		grade, output, err = Good, plaintextExposure{}, nil
+		return
+	}
+	defer conn.Close()
+
+	if _, err = fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: %s\r\nConnection: close\r\n\r\n", hostname); err != nil {
+		return
+	}
+	conn.SetReadDeadline(time.Now().Add(plaintextReadTimeout))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	result := plaintextExposure{Open: true, StatusCode: resp.StatusCode}
+	if location, lerr := resp.Location(); lerr == nil {
+		result.HTTPSRedirect = location.Scheme == "https"
+	}
+	output = result
+
+	switch {
+	case result.HTTPSRedirect:
+		grade = Good
+	case resp.StatusCode == http.StatusOK:
+		// Bad if the host serves any content at all.
+		n, _ := io.CopyN(ioutil.Discard, resp.Body, 1)
+		if n == 0 {
+			grade = Warning
+		}
+	default:
+		grade = Warning
+	}
+	return
+}
+
+// crossWiredListener describes the protocols spoken on the host's plaintext
+// HTTP port and on the scanned TLS port.
+type crossWiredListener struct {
+	// PlaintextPortTLS is whether port 80 completed a TLS handshake.
+	PlaintextPortTLS bool `json:"plaintext_port_tls"`
+	// TLSPortPlaintext is whether the scanned port, failing the TLS handshake,
+	// answered a plaintext HTTP request.
+	TLSPortPlaintext bool `json:"tls_port_plaintext"`
+}
+
+// speaksPlaintextHTTP reports whether the host answers a plaintext HTTP
+// request on addr.
+func speaksPlaintextHTTP(addr, hostname string) bool {
+	conn, err := Dialer.Dial(Network, addr)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+
+	if _, err = fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: %s\r\nConnection: close\r\n\r\n", hostname); err != nil {
+		return false
+	}
+	conn.SetReadDeadline(time.Now().Add(plaintextReadTimeout))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return true
+}
+
+// crossWiredListenerScan attempts a TLS handshake on port 80 of the host, and
+// if the handshake on the scanned port fails, a plaintext HTTP request there,
+// detecting listeners wired to the wrong protocol. Hosts speaking TLS on port
+// 80 or plaintext on the TLS port are warned of.
+func crossWiredListenerScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return
+	}
+
+	var result crossWiredListener
+	if tcpConn, derr := Dialer.Dial(Network, net.JoinHostPort(host, "80")); derr == nil {
+		tcpConn.SetDeadline(time.Now().Add(plaintextReadTimeout))
+		result.PlaintextPortTLS = tls.Client(tcpConn, opts.tlsConfig(hostname)).Handshake() == nil
+		tcpConn.Close()
+	}
+
+	tcpConn, err := Dialer.Dial(Network, addr)
+	if err != nil {
+		return
+	}
+	tcpConn.SetDeadline(time.Now().Add(plaintextReadTimeout))
+	herr := tls.Client(tcpConn, opts.tlsConfig(hostname)).Handshake()
+	tcpConn.Close()
+	if herr != nil {
+		result.TLSPortPlaintext = speaksPlaintextHTTP(addr, hostname)
+	}
+	output = result
+
+	if result.PlaintextPortTLS || result.TLSPortPlaintext {
+		grade = Warning
+	} else {
+		grade = Good
+	}
+	return
+}
+
+// classifyNetError returns the category of a failure to connect or handshake
+// with a host, such as "timeout" or "alert: handshake failure".
+func classifyNetError(err error) string {
+	if e, ok := err.(net.Error); ok && e.Timeout() {
+		return "timeout"
+	}
+	// Dial and read errors wrap the errno in *net.OpError and *os.SyscallError.
+	cause := err
+	if e, ok := cause.(*net.OpError); ok {
+		cause = e.Err
+	}
+	if e, ok := cause.(*os.SyscallError); ok {
+		cause = e.Err
+	}
+	if _, ok := cause.(*net.DNSError); ok {
+		return "dns"
+	}
+	switch cause {
+	case syscall.ECONNREFUSED:
+		return "connection refused"
+	case syscall.ECONNRESET:
+		return "connection reset"
+	case io.EOF, io.ErrUnexpectedEOF:
+		return "connection closed"
+	}
+	if e, ok := err.(*net.OpError); ok && e.Op == "remote error" {
+		return "alert: " + e.Err.Error()
+	}
+	if strings.HasPrefix(err.Error(), "tls: ") {
+		return "tls"
+	}
+	return "other"
+}
+
+// HandshakeAttempts is the number of handshakes handshakeSuccessRateScan attempts.
+var HandshakeAttempts = 10
+
+var (
+	// handshakeWarnRate is the success rate below which handshakeSuccessRateScan warns.
+	handshakeWarnRate = 0.95
+	// handshakeBadRate is the success rate below which handshakeSuccessRateScan fails.
+	handshakeBadRate = 0.5
+)
+
+// handshakeSuccessRate summarizes repeated handshakes with the host.
+type handshakeSuccessRate struct {
+	Attempts  int `json:"attempts"`
+	Successes int `json:"successes"`
+	// Failures counts the failed handshakes by classifyNetError category.
+	Failures map[string]int `json:"failures,omitempty"`
+}
+
+// handshakeSuccessRateScan handshakes with the host HandshakeAttempts times,
+// counting failures by category, to catch intermittent failures such as those
+// of one misconfigured backend in a pool. Hosts succeeding less often than
+// handshakeWarnRate are warned of, and less often than handshakeBadRate graded Bad.
+func handshakeSuccessRateScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	result := handshakeSuccessRate{Attempts: HandshakeAttempts, Failures: make(map[string]int)}
+	for i := 0; i < HandshakeAttempts; i++ {
+		opts.progress(i, HandshakeAttempts)
+		conn, herr := tls.DialWithDialer(Dialer, Network, addr, opts.tlsConfig(hostname))
+		if herr != nil {
+			result.Failures[classifyNetError(herr)]++
+			continue
+		}
+		conn.Close()
+		result.Successes++
+	}
+	opts.progress(HandshakeAttempts, HandshakeAttempts)
+	output = result
+
+	if HandshakeAttempts == 0 {
+		grade = Skipped
+		return
+	}
+	switch rate := float64(result.Successes) / float64(HandshakeAttempts); {
+	case rate < handshakeBadRate:
+	case rate < handshakeWarnRate:
+		grade = Warning
+	default:
+		grade = Good
+	}
+	return
+}
+
+var (
+	// LossyLinkLatency is the round trip time added by lossyLinkScan.
+	LossyLinkLatency = 300 * time.Millisecond
+	// LossyLinkDropRate is the fraction of writes and reads lossyLinkScan
+	// treats as lost.
+	LossyLinkDropRate = 0.05
+)
+
+var (
+	// lossyRetransmitDelay is the delay a lost segment incurs, TCP's minimum
+	// retransmission timeout.
+	lossyRetransmitDelay = time.Second
+	// lossyLinkTimeout bounds the handshake of lossyLinkScan.
+	lossyLinkTimeout = 30 * time.Second
+)
+
+// A lossyConn delays each write and read by half of LossyLinkLatency, and by
+// lossyRetransmitDelay more for those lost at LossyLinkDropRate. Since the
+// conn sits above TCP, losses are simulated by the retransmissions they cause.
+type lossyConn struct {
+	net.Conn
+}
+
+func (c lossyConn) delay() {
+	d := LossyLinkLatency / 2
+	if rand.Float64() < LossyLinkDropRate {
+		d += lossyRetransmitDelay
+	}
+	time.Sleep(d)
+}
+
+func (c lossyConn) Write(b []byte) (int, error) {
+	c.delay()
+	return c.Conn.Write(b)
+}
+
+func (c lossyConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.delay()
+	}
+	return n, err
+}
+
+// lossyLink describes a handshake over a simulated lossy link.
+type lossyLink struct {
+	LatencyMS int64   `json:"latency_ms"`
+	DropRate  float64 `json:"drop_rate"`
+	Completed bool    `json:"completed"`
+	TimeMS    int64   `json:"time_ms,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// lossyLinkScan handshakes with the host through a lossyConn, reporting how
+// long the handshake takes, as an indication of the experience of distant
+// clients or those on poor networks. It is informational, but handshakes not
+// completing within lossyLinkTimeout are warned of.
+func lossyLinkScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	conn, err := Dialer.Dial(Network, addr)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(lossyLinkTimeout))
+
+	result := lossyLink{LatencyMS: int64(LossyLinkLatency / time.Millisecond), DropRate: LossyLinkDropRate}
+	start := time.Now()
+	if herr := tls.Client(lossyConn{conn}, opts.tlsConfig(hostname)).Handshake(); herr != nil {
+		result.Error = herr.Error()
+		grade, output = Warning, result
+		return
+	}
+	result.Completed = true
+	result.TimeMS = int64(time.Since(start) / time.Millisecond)
+
+	grade, output = Good, result
+	return
+}
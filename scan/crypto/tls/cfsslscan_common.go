@@ -2,6 +2,7 @@ package tls
 
 import (
 	"fmt"
+	"strings"
 )
 
 type hashAlgID uint8
@@ -77,6 +78,40 @@ func (sigAlg SignatureAndHash) MarshalJSON() ([]byte, error) {
 	return []byte(fmt.Sprintf(`{"signature":"%s","hash":"%s"}`, sigAlg.s, sigAlg.h)), nil
 }
 
+// Hash returns the hash algorithm of the pair.
+func (sigAlg SignatureAndHash) Hash() hashAlgID {
+	return sigAlg.h
+}
+
+// Signature returns the signature algorithm of the pair.
+func (sigAlg SignatureAndHash) Signature() sigAlgID {
+	return sigAlg.s
+}
+
+// SchemeName returns the TLS 1.3 SignatureScheme name (see RFC 8446, section
+// 4.2.3) corresponding to the pair, or its String form if it has none.
+func (sigAlg SignatureAndHash) SchemeName() string {
+	switch sigAlg.s {
+	case SigRSA:
+		switch sigAlg.h {
+		case HashMD5, HashSHA1, HashSHA224, HashSHA256, HashSHA384, HashSHA512:
+			return "rsa_pkcs1_" + strings.ToLower(sigAlg.h.String())
+		}
+	case SigECDSA:
+		switch sigAlg.h {
+		case HashSHA1:
+			return "ecdsa_sha1"
+		case HashSHA256:
+			return "ecdsa_secp256r1_sha256"
+		case HashSHA384:
+			return "ecdsa_secp384r1_sha384"
+		case HashSHA512:
+			return "ecdsa_secp521r1_sha512"
+		}
+	}
+	return sigAlg.String()
+}
+
 func (sigAlg SignatureAndHash) internal() signatureAndHash {
 	return signatureAndHash{uint8(sigAlg.h), uint8(sigAlg.s)}
 }
@@ -105,6 +140,9 @@ var Versions = map[uint16]string{
 	VersionTLS12: "TLS 1.2",
 }
 
+// VersionTLS13 identifies TLS 1.3, which cf-tls can only probe for.
+const VersionTLS13 = 0x0304
+
 // CipherSuite describes an individual cipher suite, with long and short names
 // and security properties.
 type CipherSuite struct {
@@ -451,6 +489,23 @@ var CipherSuites = map[uint16]CipherSuite{
 	0XCC15: {Name: "TLS_DHE_RSA_WITH_CHACHA20_POLY1305_SHA256", ForwardSecret: true, EllipticCurve: true},
 }
 
+// TLS13CipherSuites contains the cipher suites defined for TLS 1.3, which
+// cf-tls doesn't implement. See RFC 8446, section B.4.
+var TLS13CipherSuites = map[uint16]CipherSuite{
+	0x1301: {Name: "TLS_AES_128_GCM_SHA256", ForwardSecret: true},
+	0x1302: {Name: "TLS_AES_256_GCM_SHA384", ForwardSecret: true},
+	0x1303: {Name: "TLS_CHACHA20_POLY1305_SHA256", ForwardSecret: true},
+	0x1304: {Name: "TLS_AES_128_CCM_SHA256", ForwardSecret: true},
+	0x1305: {Name: "TLS_AES_128_CCM_8_SHA256", ForwardSecret: true},
+}
+
+// PostQuantumGroups contains the hybrid post-quantum key exchange groups,
+// which are only negotiated in TLS 1.3 and aren't implemented by cf-tls.
+var PostQuantumGroups = map[CurveID]string{
+	0x11ec: "X25519MLKEM768",
+	0x6399: "X25519Kyber768Draft00",
+}
+
 var Curves = map[CurveID]string{
 	0:     "Unassigned",
 	1:     "sect163k1",
@@ -481,6 +536,61 @@ var Curves = map[CurveID]string{
 	26:    "brainpoolP256r1",
 	27:    "brainpoolP384r1",
 	28:    "brainpoolP512r1",
+	29:    "x25519",
+	30:    "x448",
 	65281: "arbitrary_explicit_prime_curves",
 	65282: "arbitrary_explicit_char2_curves",
 }
+
+// Extensions contains the names of values in the TLS ExtensionType Values registry
+// https://www.iana.org/assignments/tls-extensiontype-values/tls-extensiontype-values.xhtml
+var Extensions = map[uint16]string{
+	0:     "server_name",
+	1:     "max_fragment_length",
+	2:     "client_certificate_url",
+	3:     "trusted_ca_keys",
+	4:     "truncated_hmac",
+	5:     "status_request",
+	6:     "user_mapping",
+	7:     "client_authz",
+	8:     "server_authz",
+	9:     "cert_type",
+	10:    "supported_groups",
+	11:    "ec_point_formats",
+	12:    "srp",
+	13:    "signature_algorithms",
+	14:    "use_srtp",
+	15:    "heartbeat",
+	16:    "application_layer_protocol_negotiation",
+	17:    "status_request_v2",
+	18:    "signed_certificate_timestamp",
+	19:    "client_certificate_type",
+	20:    "server_certificate_type",
+	21:    "padding",
+	22:    "encrypt_then_mac",
+	23:    "extended_master_secret",
+	24:    "token_binding",
+	25:    "cached_info",
+	26:    "tls_lts",
+	27:    "compress_certificate",
+	28:    "record_size_limit",
+	29:    "pwd_protect",
+	30:    "pwd_clear",
+	31:    "password_salt",
+	32:    "ticket_pinning",
+	33:    "tls_cert_with_extern_psk",
+	34:    "delegated_credential",
+	35:    "session_ticket",
+	41:    "pre_shared_key",
+	42:    "early_data",
+	43:    "supported_versions",
+	44:    "cookie",
+	45:    "psk_key_exchange_modes",
+	47:    "certificate_authorities",
+	48:    "oid_filters",
+	49:    "post_handshake_auth",
+	50:    "signature_algorithms_cert",
+	51:    "key_share",
+	13172: "next_protocol_negotiation",
+	65281: "renegotiation_info",
+}
@@ -0,0 +1,121 @@
+package tls
+
+import (
+	"errors"
+	"io"
+	"net"
+)
+
+// ReceivedCloseNotify reports whether the peer has sent a close_notify alert.
+// Both a close_notify and the underlying connection closing are reported to
+// Read as io.EOF, so this distinguishes a clean TLS shutdown from the latter.
+func (c *Conn) ReceivedCloseNotify() bool {
+	c.in.Lock()
+	defer c.in.Unlock()
+	return c.receivedCloseNotify
+}
+
+// ServerKeyExchangeSignature returns the signature and hash algorithm the
+// server used to sign its ServerKeyExchange message during the handshake. ok
+// is false if the server did not send a signed key exchange, as is the case
+// for static RSA cipher suites. Prior to TLS 1.2 the hash is not negotiated
+// and is reported as HashNone.
+func (c *Conn) ServerKeyExchangeSignature() (sigAlg SignatureAndHash, ok bool) {
+	c.handshakeMutex.Lock()
+	defer c.handshakeMutex.Unlock()
+	if c.serverKeyExchangeSig == nil {
+		return
+	}
+	return SignatureAndHash{hashAlgID(c.serverKeyExchangeSig.hash), sigAlgID(c.serverKeyExchangeSig.signature)}, true
+}
+
+// ServerHelloExtensions returns the types of the extensions the server included
+// in its ServerHello, in the order they were sent. Names for them can be looked
+// up in Extensions.
+func (c *Conn) ServerHelloExtensions() []uint16 {
+	c.handshakeMutex.Lock()
+	defer c.handshakeMutex.Unlock()
+	return c.serverHelloExtensions
+}
+
+// extensionTypes returns the types of the extensions in a ServerHello that
+// has been successfully unmarshaled.
+func (m *serverHelloMsg) extensionTypes() (types []uint16) {
+	for _, ext := range m.extensions() {
+		types = append(types, ext.Type)
+	}
+	return
+}
+
+// extensions returns the raw extensions in a ServerHello that has been
+// successfully unmarshaled, in the order they were sent.
+func (m *serverHelloMsg) extensions() (extensions []Extension) {
+	sessionIdLen := int(m.raw[38])
+	data := m.raw[39+sessionIdLen+3:]
+	if len(data) < 2 {
+		return nil
+	}
+	for data = data[2:]; len(data) >= 4; {
+		length := int(data[2])<<8 | int(data[3])
+		extensions = append(extensions, Extension{uint16(data[0])<<8 | uint16(data[1]), data[4 : 4+length]})
+		data = data[4+length:]
+	}
+	return
+}
+
+// AlertUnrecognizedName is the unrecognized_name alert code, sent by servers
+// which don't host the name requested through SNI (RFC 6066, section 3).
+const AlertUnrecognizedName = 112
+
+// RemoteAlert returns the code of the fatal alert the peer sent, if err is
+// the error it caused.
+func RemoteAlert(err error) (code uint8, ok bool) {
+	if e, isOpError := err.(*net.OpError); isOpError && e.Op == "remote error" {
+		if a, isAlert := e.Err.(alert); isAlert {
+			return uint8(a), true
+		}
+	}
+	return
+}
+
+// AlertText returns the description of an alert code, such as "decode error".
+func AlertText(code uint8) string {
+	return alert(code).String()
+}
+
+// WritePaddedRecord writes an application data record of length bytes of
+// plaintext, ending in valid CBC padding of the given length but otherwise
+// random, so that its MAC is invalid. The connection must have completed a
+// handshake negotiating a CBC cipher suite under TLS 1.1 or later, and since
+// the peer will reject the record, can't be used afterwards.
+func (c *Conn) WritePaddedRecord(length int, padding uint8) error {
+	c.out.Lock()
+	defer c.out.Unlock()
+
+	cbc, ok := c.out.cipher.(cbcMode)
+	if !ok || c.out.version < VersionTLS11 {
+		return errors.New("tls: connection doesn't use a CBC cipher suite with explicit IVs")
+	}
+	blockSize := cbc.BlockSize()
+	if length%blockSize != 0 || int(padding) >= length {
+		return errors.New("tls: invalid padded record length")
+	}
+
+	record := make([]byte, recordHeaderLen+blockSize+length)
+	record[0] = byte(recordTypeApplicationData)
+	record[1], record[2] = byte(c.vers>>8), byte(c.vers)
+	record[3], record[4] = byte((blockSize+length)>>8), byte(blockSize+length)
+	if _, err := io.ReadFull(c.config.rand(), record[recordHeaderLen:]); err != nil {
+		return err
+	}
+	plaintext := record[recordHeaderLen+blockSize:]
+	for i := len(plaintext) - int(padding) - 1; i < len(plaintext); i++ {
+		plaintext[i] = padding
+	}
+	cbc.SetIV(record[recordHeaderLen : recordHeaderLen+blockSize])
+	cbc.CryptBlocks(plaintext, plaintext)
+	c.out.incSeq()
+
+	_, err := c.conn.Write(record)
+	return err
+}
@@ -1,5 +1,12 @@
 package tls
 
+import (
+	"bytes"
+	"errors"
+	"io"
+	"time"
+)
+
 // SayHello constructs a simple Client Hello to a server, parses its serverHelloMsg response
 // and returns the negotiated ciphersuite ID, and, if an EC cipher suite, the curve ID
 func (c *Conn) SayHello(newSigAls []SignatureAndHash) (cipherID, curveType uint16, curveID CurveID, version uint16, certs [][]byte, err error) {
@@ -107,3 +114,243 @@ func (c *Conn) exchangeKeys() (serverKeyExchange *serverKeyExchangeMsg, err erro
 	}
 	return
 }
+
+// An Extension is a raw TLS extension.
+type Extension struct {
+	Type uint16
+	Data []byte
+}
+
+// ServerHello describes a server's response to a ClientHello.
+type ServerHello struct {
+	Version     uint16
+	Random      []byte
+	CipherSuite uint16
+	// Extensions are the types of the extensions in the ServerHello, in
+	// the order they were sent.
+	Extensions []uint16
+	// ExtensionData maps the type of each extension to its raw data.
+	ExtensionData map[uint16][]byte
+}
+
+// HelloWithExtensions sends a ClientHello like that of SayHello, offering the
+// default signature and hash algorithms, with the given raw extensions added
+// after its own. Given extensions replace any of its own of the same type. It
+// returns the server's ServerHello, leaving the handshake incomplete. Since the
+// extensions are opaque to cf-tls, the handshake can't continue if the server
+// agrees to any of them.
+func (c *Conn) HelloWithExtensions(extensions []Extension) (serverHello *ServerHello, err error) {
+	return c.HelloOmittingExtensions(extensions, nil)
+}
+
+// HelloOmittingExtensions is like HelloWithExtensions, but also leaves out
+// any of its own extensions of the types in omit.
+func (c *Conn) HelloOmittingExtensions(extensions []Extension, omit []uint16) (serverHello *ServerHello, err error) {
+	hello := c.extensionsHello()
+	hello.raw = appendExtensions(hello.marshal(), extensions, omit)
+
+	msg, err := c.sayHello(hello)
+	if err != nil {
+		return
+	}
+	return newServerHello(msg), nil
+}
+
+// HelloWithTicket sends the same ClientHello as HelloWithExtensions, also
+// offering the given session ticket under a random session ID. It returns the
+// server's ServerHello and whether the server echoed the session ID, which
+// before TLS 1.3 means it accepted the ticket and is resuming the session.
+func (c *Conn) HelloWithTicket(ticket []byte, extensions []Extension) (serverHello *ServerHello, resumed bool, err error) {
+	hello := c.extensionsHello()
+	hello.ticketSupported = true
+	hello.sessionTicket = ticket
+	hello.sessionId = make([]byte, 16)
+	if _, err = io.ReadFull(c.config.rand(), hello.sessionId); err != nil {
+		return
+	}
+	hello.raw = appendExtensions(hello.marshal(), extensions, nil)
+
+	msg, err := c.sayHello(hello)
+	if err != nil {
+		return
+	}
+	return newServerHello(msg), bytes.Equal(msg.sessionId, hello.sessionId), nil
+}
+
+// Ticket returns the session ticket the server issued for the session, if any.
+func (s *ClientSessionState) Ticket() []byte {
+	return s.sessionTicket
+}
+
+// LifetimeHint returns how long the server suggested the session ticket be
+// kept for, zero if it didn't say.
+func (s *ClientSessionState) LifetimeHint() time.Duration {
+	return time.Duration(s.lifetimeHint) * time.Second
+}
+
+// WithTicket returns a copy of the session state carrying the given session
+// ticket in place of the one the server issued.
+func (s *ClientSessionState) WithTicket(ticket []byte) *ClientSessionState {
+	copied := *s
+	copied.sessionTicket = ticket
+	return &copied
+}
+
+// extensionsHello returns the ClientHello sent by HelloWithExtensions, before
+// the raw extensions are added.
+func (c *Conn) extensionsHello() *clientHelloMsg {
+	return &clientHelloMsg{
+		vers:                c.config.maxVersion(),
+		compressionMethods:  []uint8{compressionNone},
+		random:              make([]byte, 32),
+		ocspStapling:        true,
+		serverName:          c.config.ServerName,
+		supportedCurves:     c.config.curvePreferences(),
+		supportedPoints:     []uint8{pointFormatUncompressed},
+		nextProtoNeg:        len(c.config.NextProtos) > 0,
+		secureRenegotiation: true,
+		cipherSuites:        c.config.cipherSuites(),
+		signatureAndHashes:  defaultSignatureAndHashAlgorithms,
+	}
+}
+
+// newServerHello summarizes a ServerHello message.
+func newServerHello(msg *serverHelloMsg) *ServerHello {
+	serverHello := &ServerHello{
+		Version:       msg.vers,
+		Random:        msg.random,
+		CipherSuite:   msg.cipherSuite,
+		ExtensionData: make(map[uint16][]byte),
+	}
+	for _, ext := range msg.extensions() {
+		serverHello.Extensions = append(serverHello.Extensions, ext.Type)
+		serverHello.ExtensionData[ext.Type] = ext.Data
+	}
+	return serverHello
+}
+
+// appendExtensions returns a copy of the marshaled ClientHello m with the
+// given extensions appended to its own, less any of the same types or of the
+// types in omit, updating the lengths that cover them.
+func appendExtensions(m []byte, extensions []Extension, omit []uint16) []byte {
+	sessionIdLen := int(m[38])
+	off := 39 + sessionIdLen
+	cipherSuitesLen := int(m[off])<<8 | int(m[off+1])
+	off += 2 + cipherSuitesLen
+	compressionMethodsLen := int(m[off])
+	off += 1 + compressionMethodsLen
+
+	replaced := make(map[uint16]bool)
+	for _, ext := range extensions {
+		replaced[ext.Type] = true
+	}
+	for _, typ := range omit {
+		replaced[typ] = true
+	}
+
+	exts := []byte{}
+	if off < len(m) {
+		for own := m[off+2:]; len(own) >= 4; {
+			length := 4 + (int(own[2])<<8 | int(own[3]))
+			if !replaced[uint16(own[0])<<8|uint16(own[1])] {
+				exts = append(exts, own[:length]...)
+			}
+			own = own[length:]
+		}
+	}
+	for _, ext := range extensions {
+		exts = append(exts, byte(ext.Type>>8), byte(ext.Type), byte(len(ext.Data)>>8), byte(len(ext.Data)))
+		exts = append(exts, ext.Data...)
+	}
+
+	out := make([]byte, off, off+2+len(exts))
+	copy(out, m[:off])
+	out = append(out, byte(len(exts)>>8), byte(len(exts)))
+	out = append(out, exts...)
+
+	length := len(out) - 4
+	out[1], out[2], out[3] = byte(length>>16), byte(length>>8), byte(length)
+	return out
+}
+
+// The status_request_v2 extension and its ocsp_multi CertificateStatus type (RFC 6961).
+const (
+	extensionStatusRequestV2 uint16 = 17
+	statusTypeOCSPMulti      uint8  = 2
+)
+
+// HelloForCertificates sends the same ClientHello as HelloWithExtensions,
+// continuing the handshake to read the server's certificates and any OCSP
+// responses it staples, whether through status_request or status_request_v2.
+// responses holds one entry per certificate with ocsp_multi stapling, nil for
+// those the server has no response for, and otherwise just the leaf's.
+func (c *Conn) HelloForCertificates(extensions []Extension) (serverHello *ServerHello, certs, responses [][]byte, err error) {
+	serverHello, err = c.HelloWithExtensions(extensions)
+	if err != nil {
+		return
+	}
+
+	msg, err := c.readHandshake()
+	if err != nil {
+		return
+	}
+	certMsg, ok := msg.(*certificateMsg)
+	if !ok || len(certMsg.certificates) == 0 {
+		err = unexpectedMessageError(certMsg, msg)
+		return
+	}
+	certs = certMsg.certificates
+
+	if _, v1 := serverHello.ExtensionData[extensionStatusRequest]; !v1 {
+		if _, v2 := serverHello.ExtensionData[extensionStatusRequestV2]; !v2 {
+			return
+		}
+	}
+	if msg, err = c.readHandshake(); err != nil {
+		return
+	}
+	statusMsg, ok := msg.(*certificateStatusMsg)
+	if !ok {
+		// Servers may agree to stapling without a response to staple.
+		return
+	}
+	responses, err = statusMsg.responses()
+	return
+}
+
+// errMalformedStatus is returned for CertificateStatus messages that can't be parsed.
+var errMalformedStatus = errors.New("tls: malformed CertificateStatus message")
+
+// responses returns the OCSP responses in a CertificateStatus message of
+// either the ocsp or ocsp_multi type.
+func (m *certificateStatusMsg) responses() ([][]byte, error) {
+	switch m.statusType {
+	case statusTypeOCSP:
+		return [][]byte{m.response}, nil
+	case statusTypeOCSPMulti:
+	default:
+		return nil, errMalformedStatus
+	}
+
+	data := m.raw[5:]
+	if len(data) < 3 || len(data) != 3+(int(data[0])<<16|int(data[1])<<8|int(data[2])) {
+		return nil, errMalformedStatus
+	}
+	var responses [][]byte
+	for data = data[3:]; len(data) > 0; {
+		if len(data) < 3 {
+			return nil, errMalformedStatus
+		}
+		length := int(data[0])<<16 | int(data[1])<<8 | int(data[2])
+		if len(data) < 3+length {
+			return nil, errMalformedStatus
+		}
+		var response []byte
+		if length > 0 {
+			response = data[3 : 3+length]
+		}
+		responses = append(responses, response)
+		data = data[3+length:]
+	}
+	return responses, nil
+}
@@ -0,0 +1,68 @@
+package tls
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestScanAppendExtensions(t *testing.T) {
+	for _, hello := range []*clientHelloMsg{
+		{
+			vers:               VersionTLS12,
+			random:             make([]byte, 32),
+			cipherSuites:       []uint16{TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+			compressionMethods: []uint8{compressionNone},
+			serverName:         "example.com",
+		},
+		{
+			vers:               VersionTLS12,
+			random:             make([]byte, 32),
+			cipherSuites:       []uint16{TLS_RSA_WITH_AES_128_CBC_SHA},
+			compressionMethods: []uint8{compressionNone},
+		},
+	} {
+		m := appendExtensions(hello.marshal(), []Extension{{Type: 23}, {Type: 0x0a0a, Data: []byte{1, 2, 3}}}, nil)
+
+		parsed := new(clientHelloMsg)
+		if !parsed.unmarshal(m) {
+			t.Fatalf("couldn't unmarshal ClientHello with appended extensions: %x", m)
+		}
+		if parsed.serverName != hello.serverName {
+			t.Errorf("server name = %q, want %q", parsed.serverName, hello.serverName)
+		}
+
+		// A server_name extension for "other.test".
+		serverName := Extension{extensionServerName, []byte{0, 13, 0, 0, 10, 'o', 't', 'h', 'e', 'r', '.', 't', 'e', 's', 't'}}
+		replaced := new(clientHelloMsg)
+		if !replaced.unmarshal(appendExtensions(hello.marshal(), []Extension{serverName}, nil)) || replaced.serverName != "other.test" {
+			t.Errorf("server_name extension wasn't replaced")
+		}
+		omitted := new(clientHelloMsg)
+		if !omitted.unmarshal(appendExtensions(hello.marshal(), nil, []uint16{extensionServerName})) || omitted.serverName != "" {
+			t.Errorf("server_name extension wasn't omitted")
+		}
+		if !bytes.HasSuffix(m, []byte{0, 23, 0, 0, 0x0a, 0x0a, 0, 3, 1, 2, 3}) {
+			t.Errorf("appended extensions missing from %x", m)
+		}
+	}
+}
+
+func TestScanCertificateStatusResponses(t *testing.T) {
+	// An ocsp_multi CertificateStatus with a response for the leaf only.
+	msg := &certificateStatusMsg{}
+	if !msg.unmarshal([]byte{typeCertificateStatus, 0, 0, 11, statusTypeOCSPMulti, 0, 0, 7, 0, 0, 1, 0x30, 0, 0, 0}) {
+		t.Fatal("failed to unmarshal ocsp_multi CertificateStatus")
+	}
+	responses, err := msg.responses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(responses) != 2 || !bytes.Equal(responses[0], []byte{0x30}) || responses[1] != nil {
+		t.Errorf("responses = %x, want a response for the leaf alone", responses)
+	}
+
+	msg.raw = msg.raw[:len(msg.raw)-1]
+	if _, err = msg.responses(); err != errMalformedStatus {
+		t.Errorf("responses of a truncated message returned %v, want %v", err, errMalformedStatus)
+	}
+}
@@ -192,6 +192,7 @@ const (
 // sessions.
 type ClientSessionState struct {
 	sessionTicket      []uint8               // Encrypted ticket used for session resumption with server
+	lifetimeHint       uint32                // Seconds the server suggested the ticket be kept for
 	vers               uint16                // SSL/TLS version negotiated for the session
 	cipherSuite        uint16                // Ciphersuite negotiated for the session
 	masterSecret       []byte                // MasterSecret generated by client on a full handshake
@@ -51,12 +51,22 @@ type Conn struct {
 	clientProtocol         string
 	clientProtocolFallback bool
 
+	// serverKeyExchangeSig is the signature and hash algorithm the server
+	// used to sign its ServerKeyExchange, if it sent a signed one.
+	serverKeyExchangeSig *signatureAndHash
+	// serverHelloExtensions are the types of the extensions in the ServerHello.
+	serverHelloExtensions []uint16
+
 	// input/output
 	in, out  halfConn     // in.Mutex < out.Mutex
 	rawInput *block       // raw input, right off the wire
 	input    *block       // application data waiting to be read
 	hand     bytes.Buffer // handshake data waiting to be read
 
+	// receivedCloseNotify records whether the peer sent a close_notify
+	// alert; protected by in.Mutex.
+	receivedCloseNotify bool
+
 	// activeCall is an atomic int32; the low bit is whether Close has
 	// been called. the rest of the bits are the number of goroutines
 	// in Conn.Write.
@@ -638,6 +648,7 @@ Again:
 			break
 		}
 		if alert(data[1]) == alertCloseNotify {
+			c.receivedCloseNotify = true
 			c.in.setErrorLocked(io.EOF)
 			break
 		}
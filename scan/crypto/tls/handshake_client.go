@@ -155,6 +155,7 @@ NextCipherSuite:
 		c.sendAlert(alertUnexpectedMessage)
 		return unexpectedMessageError(serverHello, msg)
 	}
+	c.serverHelloExtensions = serverHello.extensionTypes()
 
 	vers, ok := c.config.mutualVersion(serverHello.vers)
 	if !ok || vers < VersionTLS10 {
@@ -324,6 +325,9 @@ func (hs *clientHandshakeState) doFullHandshake() error {
 			c.sendAlert(alertUnexpectedMessage)
 			return err
 		}
+		if ka, ok := keyAgreement.(*ecdheKeyAgreement); ok {
+			c.serverKeyExchangeSig = &ka.sigAndHash
+		}
 
 		msg, err = c.readHandshake()
 		if err != nil {
@@ -608,6 +612,7 @@ func (hs *clientHandshakeState) readSessionTicket() error {
 
 	hs.session = &ClientSessionState{
 		sessionTicket:      sessionTicketMsg.ticket,
+		lifetimeHint:       uint32(sessionTicketMsg.raw[4])<<24 | uint32(sessionTicketMsg.raw[5])<<16 | uint32(sessionTicketMsg.raw[6])<<8 | uint32(sessionTicketMsg.raw[7]),
 		vers:               c.vers,
 		cipherSuite:        hs.suite.id,
 		masterSecret:       hs.masterSecret,
@@ -179,6 +179,8 @@ type ecdheKeyAgreement struct {
 	privateKey []byte
 	curve      elliptic.Curve
 	x, y       *big.Int
+	// sigAndHash records the algorithms of a verified ServerKeyExchange signature.
+	sigAndHash signatureAndHash
 }
 
 func (ka *ecdheKeyAgreement) generateServerKeyExchange(config *Config, cert *Certificate, clientHello *clientHelloMsg, hello *serverHelloMsg) (*serverKeyExchangeMsg, error) {
@@ -377,6 +379,7 @@ func (ka *ecdheKeyAgreement) processServerKeyExchange(config *Config, clientHell
 	default:
 		return errors.New("unknown ECDHE signature algorithm")
 	}
+	ka.sigAndHash = sigAndHash
 
 	return nil
 }
@@ -0,0 +1,188 @@
+package scan
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// CAAResolver is the address of the DNS server queried for CAA records, which
+// the standard resolver can't look up. If empty, the first nameserver in
+// /etc/resolv.conf is used.
+var CAAResolver = ""
+
+// dnsTimeout bounds the time taken by a DNS query.
+var dnsTimeout = 5 * time.Second
+
+// dnsTypeCAA is the CAA resource record type (RFC 8659).
+const dnsTypeCAA = 257
+
+// A caaRecord is a single CAA property of a domain.
+type caaRecord struct {
+	Critical bool   `json:"critical"`
+	Tag      string `json:"tag"`
+	Value    string `json:"value"`
+}
+
+// resolverAddr returns the address of the DNS server used for CAA lookups.
+func resolverAddr() string {
+	if CAAResolver != "" {
+		return CAAResolver
+	}
+	if f, err := os.Open("/etc/resolv.conf"); err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if fields := strings.Fields(scanner.Text()); len(fields) >= 2 && fields[0] == "nameserver" {
+				return net.JoinHostPort(fields[1], "53")
+			}
+		}
+	}
+	return "127.0.0.1:53"
+}
+
+// relevantCAA returns the CAA records applying to name: those of the closest
+// of name and its parent domains to have any (RFC 8659, section 3).
+func relevantCAA(name string) (records []caaRecord, domain string, err error) {
+	domain = strings.TrimSuffix(strings.ToLower(name), ".")
+	for strings.Contains(domain, ".") {
+		records, err = lookupCAA(domain)
+		if err != nil || len(records) > 0 {
+			return
+		}
+		domain = domain[strings.Index(domain, ".")+1:]
+	}
+	return nil, "", nil
+}
+
+// lookupCAA queries the CAA records of name over TCP, which avoids
+// truncated responses. CNAMEs are followed by the resolver.
+func lookupCAA(name string) ([]caaRecord, error) {
+	query, id, err := caaQuery(name)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := Dialer.Dial("tcp", resolverAddr())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(dnsTimeout))
+
+	msg := make([]byte, 2, 2+len(query))
+	binary.BigEndian.PutUint16(msg, uint16(len(query)))
+	if _, err = conn.Write(append(msg, query...)); err != nil {
+		return nil, err
+	}
+
+	if _, err = io.ReadFull(conn, msg[:2]); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, binary.BigEndian.Uint16(msg))
+	if _, err = io.ReadFull(conn, resp); err != nil {
+		return nil, err
+	}
+	return parseCAAResponse(resp, id)
+}
+
+// caaQuery returns a recursive DNS query for the CAA records of name, along
+// with its random ID.
+func caaQuery(name string) (query []byte, id uint16, err error) {
+	query = make([]byte, 12)
+	if _, err = rand.Read(query[:2]); err != nil {
+		return
+	}
+	id = binary.BigEndian.Uint16(query)
+	query[2] = 0x01 // recursion desired
+	query[5] = 1    // one question
+
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return nil, 0, fmt.Errorf("invalid domain name %q", name)
+		}
+		query = append(query, byte(len(label)))
+		query = append(query, label...)
+	}
+	query = append(query, 0, byte(dnsTypeCAA>>8), byte(dnsTypeCAA&0xff), 0, 1)
+	return
+}
+
+var errMalformedDNS = errors.New("malformed DNS response")
+
+// skipName returns the offset just past the possibly compressed domain name
+// at off in msg.
+func skipName(msg []byte, off int) (int, error) {
+	for off < len(msg) {
+		switch length := int(msg[off]); {
+		case length == 0:
+			return off + 1, nil
+		case length&0xc0 == 0xc0:
+			return off + 2, nil
+		default:
+			off += 1 + length
+		}
+	}
+	return 0, errMalformedDNS
+}
+
+// parseCAAResponse returns the CAA records answering the query with the given ID.
+func parseCAAResponse(msg []byte, id uint16) (records []caaRecord, err error) {
+	if len(msg) < 12 || binary.BigEndian.Uint16(msg) != id {
+		return nil, errMalformedDNS
+	}
+	switch rcode := msg[3] & 0x0f; rcode {
+	case 0:
+	case 3: // NXDOMAIN
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("DNS query failed with rcode %d", rcode)
+	}
+
+	off := 12
+	for i := 0; i < int(binary.BigEndian.Uint16(msg[4:])); i++ {
+		if off, err = skipName(msg, off); err != nil {
+			return
+		}
+		off += 4
+	}
+	for i := 0; i < int(binary.BigEndian.Uint16(msg[6:])); i++ {
+		if off, err = skipName(msg, off); err != nil {
+			return
+		}
+		if off+10 > len(msg) {
+			return nil, errMalformedDNS
+		}
+		rrType := binary.BigEndian.Uint16(msg[off:])
+		rdata := off + 10
+		off = rdata + int(binary.BigEndian.Uint16(msg[off+8:]))
+		if off > len(msg) {
+			return nil, errMalformedDNS
+		}
+		if rrType != dnsTypeCAA {
+			continue
+		}
+
+		data := msg[rdata:off]
+		if len(data) < 2 {
+			return nil, errMalformedDNS
+		}
+		n := int(data[1])
+		if 2+n > len(data) {
+			return nil, errMalformedDNS
+		}
+		records = append(records, caaRecord{
+			Critical: data[0]&0x80 != 0,
+			Tag:      strings.ToLower(string(data[2 : 2+n])),
+			Value:    string(data[2+n:]),
+		})
+	}
+	return
+}
@@ -0,0 +1,46 @@
+package scan
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCAAResponse(t *testing.T) {
+	query, id, err := caaQuery("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := append([]byte{}, query...)
+	resp[2], resp[3] = 0x81, 0x80 // response, recursion available
+	resp[7] = 2                   // two answers
+	// A CNAME answer, then a CAA answer with a compressed name.
+	resp = append(resp, 0xc0, 12, 0, 5, 0, 1, 0, 0, 0, 60, 0, 2, 0xc0, 12)
+	rdata := append([]byte{0x80, 5}, "issueletsencrypt.org"...)
+	resp = append(resp, 0xc0, 12, 1, 1, 0, 1, 0, 0, 0, 60, 0, byte(len(rdata)))
+	resp = append(resp, rdata...)
+
+	records, err := parseCAAResponse(resp, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []caaRecord{{true, "issue", "letsencrypt.org"}}; !reflect.DeepEqual(records, want) {
+		t.Errorf("parseCAAResponse = %v, want %v", records, want)
+	}
+
+	if _, err = parseCAAResponse(resp, id+1); err != errMalformedDNS {
+		t.Errorf("parseCAAResponse with the wrong ID returned %v, want %v", err, errMalformedDNS)
+	}
+	if _, err = parseCAAResponse(resp[:len(resp)-1], id); err != errMalformedDNS {
+		t.Errorf("parseCAAResponse of a truncated response returned %v, want %v", err, errMalformedDNS)
+	}
+
+	// A tag length whose sum with the header overflows a byte.
+	long := append([]byte{}, resp[:len(resp)-len(rdata)-2]...)
+	rdata = append([]byte{0, 254}, make([]byte, 254)...)
+	long = append(long, byte(len(rdata)>>8), byte(len(rdata)))
+	long = append(long, rdata...)
+	if records, err = parseCAAResponse(long, id); err != nil || len(records) != 1 || len(records[0].Tag) != 254 {
+		t.Errorf("parseCAAResponse with a 254-byte tag returned %v, %v", records, err)
+	}
+}
@@ -0,0 +1,194 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/cfssl/log"
+)
+
+// EncodeResults writes the results of RunScans to w as indented JSON.
+func EncodeResults(w io.Writer, results map[string]FamilyResult) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
+
+// RedactOptions controls which sensitive data EncodeResultsRedacted removes.
+type RedactOptions struct {
+	// MaskIPs zeroes the host bits of every IP address found in scan output and errors.
+	MaskIPs bool
+	// IPv4PrefixLen and IPv6PrefixLen are the number of leading network bits
+	// kept when masking; they default to 24 and 48 respectively.
+	IPv4PrefixLen, IPv6PrefixLen int
+	// StripPTR removes reverse DNS hostnames, reported under "ptr" keys, from scan output.
+	StripPTR bool
+}
+
+// ipCandidate matches substrings that may be IPv4 or IPv6 addresses.
+var ipCandidate = regexp.MustCompile(`[0-9A-Fa-f]*:[0-9A-Fa-f:.]*[0-9A-Fa-f]|\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+
+// EncodeResultsRedacted is like EncodeResults, but first redacts sensitive data
+// from each scanner's output and error according to opts. Grades are preserved.
+func EncodeResultsRedacted(w io.Writer, results map[string]FamilyResult, opts RedactOptions) error {
+	if opts.IPv4PrefixLen == 0 {
+		opts.IPv4PrefixLen = 24
+	}
+	if opts.IPv6PrefixLen == 0 {
+		opts.IPv6PrefixLen = 48
+	}
+
+	redacted := make(map[string]FamilyResult, len(results))
+	for familyName, familyResult := range results {
+		redacted[familyName] = make(FamilyResult, len(familyResult))
+		for scannerName, result := range familyResult {
+			output, err := opts.redactOutput(result.Output)
+			if err != nil {
+				return err
+			}
+			result.Output = output
+			result.Error = opts.redactString(result.Error)
+			redacted[familyName][scannerName] = result
+		}
+	}
+	return EncodeResults(w, redacted)
+}
+
+// redactOutput converts output to its generic JSON form and redacts it.
+func (opts RedactOptions) redactOutput(output Output) (Output, error) {
+	if output == nil {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(output)
+	if err != nil {
+		return nil, err
+	}
+
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err = dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return opts.redactValue(v), nil
+}
+
+// redactValue redacts a value decoded from JSON.
+func (opts RedactOptions) redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return opts.redactString(v)
+	case []interface{}:
+		for i := range v {
+			v[i] = opts.redactValue(v[i])
+		}
+		return v
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			if opts.StripPTR && strings.EqualFold(key, "ptr") {
+				continue
+			}
+			m[opts.redactString(key)] = opts.redactValue(value)
+		}
+		return m
+	default:
+		return v
+	}
+}
+
+// redactString masks any IP addresses found in s.
+func (opts RedactOptions) redactString(s string) string {
+	if !opts.MaskIPs {
+		return s
+	}
+	return ipCandidate.ReplaceAllStringFunc(s, opts.maskIP)
+}
+
+// maskIP zeroes the host bits of s if it is an IP address.
+func (opts RedactOptions) maskIP(s string) string {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return s
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(opts.IPv4PrefixLen, 8*net.IPv4len)).String()
+	}
+	return ip.Mask(net.CIDRMask(opts.IPv6PrefixLen, 8*net.IPv6len)).String()
+}
+
+// hostResult is a single line of ScanNDJSON output.
+type hostResult struct {
+	Host    string `json:"host"`
+	Family  string `json:"family"`
+	Scanner string `json:"scanner"`
+	ScannerResult
+}
+
+// ScanNDJSON reads hosts, one per line, from hosts and runs the Default scans
+// matching the family and scanner regular expressions against each in turn.
+// As each scan completes, its result is written to w as a single line of JSON
+// carrying the host, family, scanner, grade, output, and any error. Blank lines
+// are ignored. As with RunScansWithOptions, a host's scans are abandoned once
+// timeout passes without a result, unless timeout isn't positive. Abandoned
+// scans run to completion in the background, their results discarded. Only
+// errors reading hosts or writing results stop the stream.
+func ScanNDJSON(hosts io.Reader, w io.Writer, familyRegex, scannerRegex string, timeout time.Duration) error {
+	familyRegexp, err := regexp.Compile(familyRegex)
+	if err != nil {
+		return err
+	}
+	scannerRegexp, err := regexp.Compile(scannerRegex)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	scanner := bufio.NewScanner(hosts)
+	for scanner.Scan() {
+		host := strings.TrimSpace(scanner.Text())
+		if host == "" {
+			continue
+		}
+
+		opts := new(Options)
+		addr, hostname := opts.dialAddr(host)
+		ctx := Default.runScans(addr, hostname, familyRegexp, scannerRegexp, opts)
+	results:
+		for {
+			var timedOut <-chan time.Time
+			if timeout > 0 {
+				timedOut = time.After(timeout)
+			}
+			var result *Result
+			select {
+			case <-timedOut:
+				log.Warningf("Scan of %s timed out after %v", host, timeout)
+				// Unblock the abandoned scans so they finish and close their connections.
+				go func(results chan *Result) {
+					for range results {
+					}
+				}(ctx.resultChan)
+				break results
+			case result = <-ctx.resultChan:
+				if result == nil {
+					break results
+				}
+			}
+			if err == nil {
+				err = enc.Encode(hostResult{host, result.Family, result.Scanner, result.ScannerResult})
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,56 @@
+package scan
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestEncodeResultsRedacted(t *testing.T) {
+	results := map[string]FamilyResult{
+		"Connectivity": {
+			"DNSLookup": {
+				Grade:  Good.String(),
+				Output: []string{"192.0.2.17", "2001:db8:1234:5678::1"},
+			},
+			"CloudFlareStatus": {
+				Grade:  Bad.String(),
+				Output: map[string]interface{}{"198.51.100.7": false, "ptr": "host.internal"},
+			},
+			"TCPDial": {
+				Grade: Bad.String(),
+				Error: "dial tcp 203.0.113.99:443: connection refused",
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	err := EncodeResultsRedacted(&buf, results, RedactOptions{MaskIPs: true, StripPTR: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var redacted map[string]map[string]struct {
+		Grade  string      `json:"grade"`
+		Output interface{} `json:"output"`
+		Error  string      `json:"error"`
+	}
+	if err = json.Unmarshal(buf.Bytes(), &redacted); err != nil {
+		t.Fatal(err)
+	}
+
+	conn := redacted["Connectivity"]
+	if want := []interface{}{"192.0.2.0", "2001:db8:1234::"}; !reflect.DeepEqual(conn["DNSLookup"].Output, want) {
+		t.Errorf("DNSLookup output = %v, want %v", conn["DNSLookup"].Output, want)
+	}
+	if want := map[string]interface{}{"198.51.100.0": false}; !reflect.DeepEqual(conn["CloudFlareStatus"].Output, want) {
+		t.Errorf("CloudFlareStatus output = %v, want %v", conn["CloudFlareStatus"].Output, want)
+	}
+	if conn["CloudFlareStatus"].Grade != Bad.String() {
+		t.Errorf("CloudFlareStatus grade = %s, want %s", conn["CloudFlareStatus"].Grade, Bad)
+	}
+	if want := "dial tcp 203.0.113.0:443: connection refused"; conn["TCPDial"].Error != want {
+		t.Errorf("TCPDial error = %q, want %q", conn["TCPDial"].Error, want)
+	}
+}
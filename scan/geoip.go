@@ -0,0 +1,356 @@
+package scan
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+)
+
+// An IPLocator looks up who hosts an IP address and where.
+type IPLocator interface {
+	Locate(ip net.IP) (*IPLocation, error)
+}
+
+// IPLocation describes the network and country an IP address belongs to.
+// Fields a locator has no data for are left empty.
+type IPLocation struct {
+	ASN     uint32 `json:"asn,omitempty"`
+	Org     string `json:"org,omitempty"`
+	Country string `json:"country,omitempty"`
+}
+
+// merge fills the empty fields of l from other.
+func (l *IPLocation) merge(other *IPLocation) {
+	if l.ASN == 0 {
+		l.ASN = other.ASN
+	}
+	if l.Org == "" {
+		l.Org = other.Org
+	}
+	if l.Country == "" {
+		l.Country = other.Country
+	}
+}
+
+// IPLocators are consulted in order by the IPLocation scanner, each filling
+// in what the ones before it didn't, so that for example a MaxMind ASN
+// database can be combined with a country database. The scanner is skipped
+// if there are none.
+var IPLocators []IPLocator
+
+// IPLocationService is an IPLocator querying an HTTP service through the
+// shared Client. URL is a format string taking the IP address, whose response
+// is a JSON object with "asn", "org", and "country" fields.
+type IPLocationService struct {
+	URL string
+}
+
+// Locate queries the service for ip.
+func (s IPLocationService) Locate(ip net.IP) (*IPLocation, error) {
+	resp, err := Client.Get(fmt.Sprintf(s.URL, ip))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("IP location service returned HTTP status %d", resp.StatusCode)
+	}
+
+	location := new(IPLocation)
+	if err = json.NewDecoder(io.LimitReader(resp.Body, maxHTTPBodySize)).Decode(location); err != nil {
+		return nil, err
+	}
+	return location, nil
+}
+
+// MMDB is an IPLocator backed by a MaxMind DB file, such as a GeoLite2 ASN or
+// Country database.
+type MMDB struct {
+	data       []byte
+	tree       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+}
+
+var errMalformedMMDB = errors.New("malformed MaxMind DB")
+
+// mmdbMetadataMarker precedes the metadata at the end of a MaxMind DB.
+var mmdbMetadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// OpenMMDB reads the MaxMind DB at path.
+func OpenMMDB(path string) (*MMDB, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseMMDB(buf)
+}
+
+// parseMMDB parses a MaxMind DB held in buf.
+func parseMMDB(buf []byte) (*MMDB, error) {
+	i := bytes.LastIndex(buf, mmdbMetadataMarker)
+	if i < 0 {
+		return nil, errMalformedMMDB
+	}
+	metadata, _, err := decodeMMDB(buf[i+len(mmdbMetadataMarker):], 0)
+	if err != nil {
+		return nil, err
+	}
+	fields, ok := metadata.(map[string]interface{})
+	if !ok {
+		return nil, errMalformedMMDB
+	}
+
+	db := new(MMDB)
+	for key, field := range map[string]*uint{"node_count": &db.nodeCount, "record_size": &db.recordSize, "ip_version": &db.ipVersion} {
+		v, ok := fields[key].(uint64)
+		if !ok {
+			return nil, errMalformedMMDB
+		}
+		*field = uint(v)
+	}
+	if db.recordSize != 24 && db.recordSize != 28 && db.recordSize != 32 {
+		return nil, fmt.Errorf("unsupported MaxMind DB record size %d", db.recordSize)
+	}
+
+	treeSize := db.nodeCount * db.recordSize / 4
+	if treeSize+16 > uint(i) {
+		return nil, errMalformedMMDB
+	}
+	db.tree, db.data = buf[:treeSize], buf[treeSize+16:i]
+	return db, nil
+}
+
+// record returns the left or right record of a node in the search tree.
+func (db *MMDB) record(node uint, right bool) uint {
+	b := db.tree[node*db.recordSize/4:]
+	switch db.recordSize {
+	case 24:
+		if right {
+			b = b[3:]
+		}
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if right {
+			return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+		}
+		return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	}
+	if right {
+		b = b[4:]
+	}
+	return uint(binary.BigEndian.Uint32(b))
+}
+
+// lookup returns the data record for ip, or nil if the database has none.
+func (db *MMDB) lookup(ip net.IP) (interface{}, error) {
+	// IPv4 addresses are found under ::/96 in IPv6 databases.
+	addr := ip.To16()
+	if v4 := ip.To4(); v4 != nil && db.ipVersion == 4 {
+		addr = v4
+	} else if v4 != nil {
+		addr = append(make([]byte, 12), v4...)
+	} else if db.ipVersion == 4 {
+		return nil, nil
+	}
+
+	node := uint(0)
+	for bit := 0; bit < 8*len(addr) && node < db.nodeCount; bit++ {
+		node = db.record(node, addr[bit/8]&(0x80>>uint(bit%8)) != 0)
+	}
+	switch {
+	case node == db.nodeCount:
+		return nil, nil
+	case node < db.nodeCount:
+		return nil, errMalformedMMDB
+	}
+
+	offset := node - db.nodeCount - 16
+	if offset >= uint(len(db.data)) {
+		return nil, errMalformedMMDB
+	}
+	value, _, err := decodeMMDB(db.data, offset)
+	return value, err
+}
+
+// Locate looks ip up in the database, understanding the fields of the
+// GeoLite2 ASN, Country, and City databases.
+func (db *MMDB) Locate(ip net.IP) (*IPLocation, error) {
+	value, err := db.lookup(ip)
+	if err != nil {
+		return nil, err
+	}
+
+	location := new(IPLocation)
+	record, _ := value.(map[string]interface{})
+	if asn, ok := record["autonomous_system_number"].(uint64); ok {
+		location.ASN = uint32(asn)
+	}
+	location.Org, _ = record["autonomous_system_organization"].(string)
+	for _, key := range []string{"country", "registered_country"} {
+		if country, ok := record[key].(map[string]interface{}); ok && location.Country == "" {
+			location.Country, _ = country["iso_code"].(string)
+		}
+	}
+	return location, nil
+}
+
+// decodeMMDB decodes the value at offset in a MaxMind DB data section,
+// returning it along with the offset following it. Maps are decoded as
+// map[string]interface{}, arrays as []interface{}, and unsigned integers as
+// uint64.
+func decodeMMDB(data []byte, offset uint) (value interface{}, next uint, err error) {
+	if offset >= uint(len(data)) {
+		return nil, 0, errMalformedMMDB
+	}
+	ctrl := data[offset]
+	offset++
+	typ := uint(ctrl >> 5)
+
+	if typ == 1 { // pointer
+		n := uint(ctrl>>3&0x3) + 1
+		if offset+n > uint(len(data)) {
+			return nil, 0, errMalformedMMDB
+		}
+		p := uint(0)
+		if n < 4 {
+			p = uint(ctrl & 0x7)
+		}
+		for _, b := range data[offset : offset+n] {
+			p = p<<8 | uint(b)
+		}
+		p += []uint{0, 2048, 526336, 0}[n-1]
+		// Pointers can't point to pointers, which could loop.
+		if p < uint(len(data)) && data[p]>>5 == 1 {
+			return nil, 0, errMalformedMMDB
+		}
+		value, _, err = decodeMMDB(data, p)
+		return value, offset + n, err
+	}
+
+	if typ == 0 { // extended
+		if offset >= uint(len(data)) {
+			return nil, 0, errMalformedMMDB
+		}
+		typ = 7 + uint(data[offset])
+		offset++
+	}
+
+	size := uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if offset+n > uint(len(data)) {
+			return nil, 0, errMalformedMMDB
+		}
+		size = 0
+		for _, b := range data[offset : offset+n] {
+			size = size<<8 | uint(b)
+		}
+		size += []uint{29, 285, 65821}[n-1]
+		offset += n
+	}
+
+	switch typ {
+	case 7: // map
+		m := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			var k, v interface{}
+			if k, offset, err = decodeMMDB(data, offset); err != nil {
+				return
+			}
+			if v, offset, err = decodeMMDB(data, offset); err != nil {
+				return
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, errMalformedMMDB
+			}
+			m[key] = v
+		}
+		return m, offset, nil
+	case 11: // array
+		a := make([]interface{}, size)
+		for i := range a {
+			if a[i], offset, err = decodeMMDB(data, offset); err != nil {
+				return
+			}
+		}
+		return a, offset, nil
+	case 14: // boolean
+		return size != 0, offset, nil
+	}
+
+	if offset+size > uint(len(data)) {
+		return nil, 0, errMalformedMMDB
+	}
+	b := data[offset : offset+size]
+	next = offset + size
+	switch typ {
+	case 2: // UTF-8 string
+		return string(b), next, nil
+	case 3: // double
+		if size != 8 {
+			return nil, 0, errMalformedMMDB
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), next, nil
+	case 15: // float
+		if size != 4 {
+			return nil, 0, errMalformedMMDB
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), next, nil
+	case 5, 6, 9, 8: // uint16, uint32, uint64, int32
+		if size > 8 {
+			return nil, 0, errMalformedMMDB
+		}
+		var u uint64
+		for _, c := range b {
+			u = u<<8 | uint64(c)
+		}
+		if typ == 8 {
+			return int64(int32(u)), next, nil
+		}
+		return u, next, nil
+	case 4, 10: // bytes, uint128
+		return b, next, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported MaxMind DB data type %d", typ)
+}
+
+// ipLocationScan looks up each of the host's addresses with IPLocators,
+// reporting the ASN, organization, and country of each. It is informational.
+func ipLocationScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	if len(IPLocators) == 0 {
+		grade = Skipped
+		return
+	}
+
+	var ips []net.IP
+	if ip := net.ParseIP(opts.overrideIP()); ip != nil {
+		ips = []net.IP{ip}
+	} else if ips, err = net.LookupIP(hostname); err != nil {
+		return
+	}
+
+	locations := make(map[string]*IPLocation)
+	for _, ip := range ips {
+		location := new(IPLocation)
+		for _, locator := range IPLocators {
+			var l *IPLocation
+			if l, err = locator.Locate(ip); err != nil {
+				return
+			}
+			location.merge(l)
+		}
+		locations[ip.String()] = location
+	}
+
+	grade, output = Good, locations
+	return
+}
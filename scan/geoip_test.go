@@ -0,0 +1,53 @@
+package scan
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+// mmdbString encodes a short UTF-8 string in the MaxMind DB data format.
+func mmdbString(s string) []byte {
+	if len(s) < 29 {
+		return append([]byte{0x40 | byte(len(s))}, s...)
+	}
+	return append([]byte{0x40 | 29, byte(len(s) - 29)}, s...)
+}
+
+func TestMMDBLocate(t *testing.T) {
+	// An IPv4 database with a single node, whose left record points to the
+	// data at offset 0, covering 0.0.0.0/1.
+	db := []byte{0, 0, 17, 0, 0, 1}
+	db = append(db, make([]byte, 16)...)
+	db = append(db, 0xe2)
+	db = append(db, mmdbString("autonomous_system_number")...)
+	db = append(db, 0xc2, 0x34, 0x17)
+	db = append(db, mmdbString("autonomous_system_organization")...)
+	db = append(db, mmdbString("CLOUDFLARENET")...)
+
+	db = append(db, mmdbMetadataMarker...)
+	db = append(db, 0xe3)
+	db = append(db, mmdbString("node_count")...)
+	db = append(db, 0xc1, 1)
+	db = append(db, mmdbString("record_size")...)
+	db = append(db, 0xa1, 24)
+	db = append(db, mmdbString("ip_version")...)
+	db = append(db, 0xa1, 4)
+
+	mmdb, err := parseMMDB(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	location, err := mmdb.Locate(net.ParseIP("1.1.1.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (&IPLocation{ASN: 13335, Org: "CLOUDFLARENET"}); !reflect.DeepEqual(location, want) {
+		t.Errorf("Locate(1.1.1.1) = %+v, want %+v", location, want)
+	}
+
+	if location, err = mmdb.Locate(net.ParseIP("192.0.2.1")); err != nil || *location != (IPLocation{}) {
+		t.Errorf("Locate(192.0.2.1) = %+v, %v, want an empty location", location, err)
+	}
+}
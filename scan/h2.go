@@ -0,0 +1,563 @@
+package scan
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/cfssl/scan/crypto/tls"
+)
+
+// HTTP/2 frame types and flags (RFC 9113, section 6).
+const (
+	h2FrameHeaders   = 0x1
+	h2FrameRSTStream = 0x3
+	h2FrameSettings  = 0x4
+	h2FramePing      = 0x6
+	h2FrameGoAway    = 0x7
+
+	h2FlagEndStream  = 0x1
+	h2FlagAck        = 0x1
+	h2FlagEndHeaders = 0x4
+	h2FlagPadded     = 0x8
+	h2FlagPriority   = 0x20
+
+	h2SettingMaxConcurrentStreams = 0x3
+)
+
+// h2Preface is the connection preface sent by HTTP/2 clients.
+const h2Preface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+// h2ErrorCodes names the HTTP/2 error codes.
+var h2ErrorCodes = []string{
+	"NO_ERROR", "PROTOCOL_ERROR", "INTERNAL_ERROR", "FLOW_CONTROL_ERROR",
+	"SETTINGS_TIMEOUT", "STREAM_CLOSED", "FRAME_SIZE_ERROR", "REFUSED_STREAM",
+	"CANCEL", "COMPRESSION_ERROR", "CONNECT_ERROR", "ENHANCE_YOUR_CALM",
+	"INADEQUATE_SECURITY", "HTTP_1_1_REQUIRED",
+}
+
+// h2ErrorCode returns the name of an HTTP/2 error code.
+func h2ErrorCode(code uint32) string {
+	if code < uint32(len(h2ErrorCodes)) {
+		return h2ErrorCodes[code]
+	}
+	return "UNKNOWN"
+}
+
+var (
+	// h2Streams is the number of concurrent streams opened by h2StreamsScan,
+	// fewer if the host allows fewer.
+	h2Streams uint32 = 8
+	// h2Timeout bounds how long h2StreamsScan waits on the host.
+	h2Timeout = 10 * time.Second
+	// maxH2FrameSize bounds the size of a frame read from the host.
+	maxH2FrameSize = 1 << 24
+)
+
+var errMalformedH2 = errors.New("malformed HTTP/2 frame")
+
+// writeH2Frame writes a frame of the given type, flags, and stream.
+func writeH2Frame(w io.Writer, typ, flags byte, stream uint32, payload []byte) error {
+	n := len(payload)
+	frame := []byte{byte(n >> 16), byte(n >> 8), byte(n), typ, flags, byte(stream >> 24), byte(stream >> 16), byte(stream >> 8), byte(stream)}
+	_, err := w.Write(append(frame, payload...))
+	return err
+}
+
+// readH2Frame reads a frame, returning its type, flags, stream, and payload.
+func readH2Frame(r io.Reader) (typ, flags byte, stream uint32, payload []byte, err error) {
+	header := make([]byte, 9)
+	if _, err = io.ReadFull(r, header); err != nil {
+		return
+	}
+	length := int(header[0])<<16 | int(header[1])<<8 | int(header[2])
+	if length > maxH2FrameSize {
+		err = errMalformedH2
+		return
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(r, payload); err != nil {
+		return
+	}
+	return header[3], header[4], binary.BigEndian.Uint32(header[5:]) &^ (1 << 31), payload, nil
+}
+
+// hpackGET returns the HPACK header block of a GET request for / on
+// authority, using the static table and literals without Huffman coding.
+func hpackGET(authority string) []byte {
+	// :method GET, :scheme https, :path /
+	block := []byte{0x82, 0x87, 0x84}
+	// :authority, as a literal without indexing with an indexed name.
+	block = append(block, 0x01)
+	n := len(authority)
+	if n < 0x7f {
+		block = append(block, byte(n))
+	} else {
+		block = append(block, 0x7f)
+		for n -= 0x7f; n >= 0x80; n >>= 7 {
+			block = append(block, byte(n&0x7f|0x80))
+		}
+		block = append(block, byte(n))
+	}
+	return append(block, authority...)
+}
+
+// h2Behavior describes how the host handled concurrent HTTP/2 streams and the
+// close of the connection.
+type h2Behavior struct {
+	// MaxConcurrentStreams is the host's SETTINGS_MAX_CONCURRENT_STREAMS, if set.
+	MaxConcurrentStreams *uint32 `json:"max_concurrent_streams,omitempty"`
+	Streams              int     `json:"streams"`
+	Responses            int     `json:"responses"`
+	// Resets counts the streams the host reset, by error code.
+	Resets map[string]int `json:"resets,omitempty"`
+	// GoAway is the error code of the GOAWAY the host sent, if any.
+	GoAway string `json:"goaway,omitempty"`
+	// Close is how the host closed the connection: "clean", "reset", or "timeout".
+	Close string `json:"close"`
+}
+
+// h2StreamsScan negotiates HTTP/2 with the host and opens several concurrent
+// streams requesting /, cancelling each once answered. It then sends GOAWAY
+// and waits for the host to close the connection, reporting how it does.
+// Hosts resetting streams with an error other than REFUSED_STREAM, sending
+// GOAWAY with an error, or resetting the connection are warned of. Hosts not
+// negotiating HTTP/2 are skipped.
+func h2StreamsScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	config := opts.tlsConfig(hostname)
+	config.NextProtos = []string{"h2"}
+	conn, err := tls.DialWithDialer(Dialer, Network, addr, config)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	if conn.ConnectionState().NegotiatedProtocol != "h2" {
+		grade = Skipped
+		return
+	}
+	conn.SetDeadline(time.Now().Add(h2Timeout))
+
+	if _, err = io.WriteString(conn, h2Preface); err != nil {
+		return
+	}
+	if err = writeH2Frame(conn, h2FrameSettings, 0, 0, nil); err != nil {
+		return
+	}
+
+	r := bufio.NewReader(conn)
+	result := h2Behavior{Resets: make(map[string]int)}
+	output = &result
+	// The host's SETTINGS must be the first frame it sends.
+	typ, flags, _, payload, err := readH2Frame(r)
+	if err != nil {
+		return
+	}
+	if typ != h2FrameSettings || flags&h2FlagAck != 0 {
+		err = errMalformedH2
+		return
+	}
+	streams := h2Streams
+	for ; len(payload) >= 6; payload = payload[6:] {
+		if binary.BigEndian.Uint16(payload) == h2SettingMaxConcurrentStreams {
+			max := binary.BigEndian.Uint32(payload[2:])
+			result.MaxConcurrentStreams = &max
+			if max < streams {
+				streams = max
+			}
+		}
+	}
+	if err = writeH2Frame(conn, h2FrameSettings, h2FlagAck, 0, nil); err != nil {
+		return
+	}
+
+	authority := h2Authority(addr, hostname)
+	open := make(map[uint32]bool)
+	for i := uint32(0); i < streams; i++ {
+		id := 2*i + 1
+		if err = writeH2Frame(conn, h2FrameHeaders, h2FlagEndStream|h2FlagEndHeaders, id, hpackGET(authority)); err != nil {
+			return
+		}
+		open[id] = true
+	}
+	result.Streams = len(open)
+
+	var clientGoAway bool
+	for result.Close == "" {
+		if len(open) == 0 && !clientGoAway {
+			if err = writeH2Frame(conn, h2FrameGoAway, 0, 0, make([]byte, 8)); err != nil {
+				return
+			}
+			clientGoAway = true
+		}
+
+		typ, flags, stream, payload, rerr := readH2Frame(r)
+		if rerr != nil {
+			switch e, ok := rerr.(net.Error); {
+			case rerr == io.EOF:
+				result.Close = "clean"
+			case ok && e.Timeout():
+				result.Close = "timeout"
+			default:
+				result.Close = "reset"
+			}
+			continue
+		}
+
+		switch typ {
+		case h2FrameHeaders:
+			if open[stream] {
+				result.Responses++
+				delete(open, stream)
+				if flags&h2FlagEndStream == 0 {
+					// Cancel the rest of the response.
+					if err = writeH2Frame(conn, h2FrameRSTStream, 0, stream, []byte{0, 0, 0, 8}); err != nil {
+						return
+					}
+				}
+			}
+		case h2FrameRSTStream:
+			if len(payload) == 4 {
+				result.Resets[h2ErrorCode(binary.BigEndian.Uint32(payload))]++
+			}
+			delete(open, stream)
+		case h2FrameSettings:
+			if flags&h2FlagAck == 0 {
+				if err = writeH2Frame(conn, h2FrameSettings, h2FlagAck, 0, nil); err != nil {
+					return
+				}
+			}
+		case h2FramePing:
+			if flags&h2FlagAck == 0 {
+				if err = writeH2Frame(conn, h2FramePing, h2FlagAck, 0, payload); err != nil {
+					return
+				}
+			}
+		case h2FrameGoAway:
+			if len(payload) >= 8 {
+				result.GoAway = h2ErrorCode(binary.BigEndian.Uint32(payload[4:]))
+			}
+			// Streams above the last one the host processed won't be answered.
+			if len(payload) >= 4 {
+				last := binary.BigEndian.Uint32(payload) &^ (1 << 31)
+				for id := range open {
+					if id > last {
+						delete(open, id)
+					}
+				}
+			}
+		}
+	}
+
+	grade = Good
+	for code := range result.Resets {
+		if code != "REFUSED_STREAM" {
+			grade = Warning
+		}
+	}
+	if (result.GoAway != "" && result.GoAway != "NO_ERROR") || result.Close == "reset" {
+		grade = Warning
+	}
+	return
+}
+
+// h2Coalescing describes how the host answered a request for another name on
+// its certificate over an HTTP/2 connection established for the host.
+type h2Coalescing struct {
+	Authority string `json:"authority"`
+	Status    int    `json:"status,omitempty"`
+	// Result is "served", or "rejected" if the host answered 421 Misdirected
+	// Request or reset the stream.
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+	// Elsewhere is set if the other name resolves to none of the host's addresses.
+	Elsewhere bool `json:"elsewhere,omitempty"`
+}
+
+// h2CoalescingScan negotiates HTTP/2 with the host and requests / with the
+// :authority of another name its leaf certificate covers, as a client
+// coalescing connections would. Serving the name is fine where it resolves to
+// the host, but hosts serving it though it resolves to none of their addresses
+// are warned of, since they answer for a name DNS sends elsewhere. Hosts not
+// negotiating HTTP/2, or whose certificate names no other host outright, are
+// skipped.
+func h2CoalescingScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	config := opts.tlsConfig(hostname)
+	config.NextProtos = []string{"h2"}
+	conn, err := tls.DialWithDialer(Dialer, Network, addr, config)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	state := conn.ConnectionState()
+	if state.NegotiatedProtocol != "h2" || len(state.PeerCertificates) == 0 {
+		grade = Skipped
+		return
+	}
+
+	var other string
+	for _, name := range state.PeerCertificates[0].DNSNames {
+		name = strings.ToLower(name)
+		if !strings.HasPrefix(name, "*.") && name != strings.ToLower(strings.TrimSuffix(hostname, ".")) {
+			other = name
+			break
+		}
+	}
+	if other == "" {
+		grade = Skipped
+		return
+	}
+	conn.SetDeadline(time.Now().Add(h2Timeout))
+
+	// The connection's SNI stays hostname whatever the request's authority.
+	if _, err = io.WriteString(conn, h2Preface); err != nil {
+		return
+	}
+	if err = writeH2Frame(conn, h2FrameSettings, 0, 0, nil); err != nil {
+		return
+	}
+	if err = writeH2Frame(conn, h2FrameHeaders, h2FlagEndStream|h2FlagEndHeaders, 1, hpackGET(h2Authority(addr, other))); err != nil {
+		return
+	}
+
+	result := h2Coalescing{Authority: other}
+	r := bufio.NewReader(conn)
+	for result.Result == "" {
+		typ, flags, stream, payload, rerr := readH2Frame(r)
+		if rerr != nil {
+			err = rerr
+			return
+		}
+		switch typ {
+		case h2FrameHeaders:
+			if stream != 1 {
+				continue
+			}
+			if result.Status, err = hpackStatus(h2HeaderBlock(flags, payload)); err != nil {
+				return
+			}
+			if result.Status == http.StatusMisdirectedRequest {
+				result.Result = "rejected"
+			} else {
+				result.Result = "served"
+			}
+		case h2FrameRSTStream:
+			if stream == 1 && len(payload) == 4 {
+				result.Result, result.Error = "rejected", "stream reset: "+h2ErrorCode(binary.BigEndian.Uint32(payload))
+			}
+		case h2FrameGoAway:
+			result.Result = "rejected"
+			if len(payload) >= 8 {
+				result.Error = "goaway: " + h2ErrorCode(binary.BigEndian.Uint32(payload[4:]))
+			}
+		case h2FrameSettings:
+			if flags&h2FlagAck == 0 {
+				if err = writeH2Frame(conn, h2FrameSettings, h2FlagAck, 0, nil); err != nil {
+					return
+				}
+			}
+		case h2FramePing:
+			if flags&h2FlagAck == 0 {
+				if err = writeH2Frame(conn, h2FramePing, h2FlagAck, 0, payload); err != nil {
+					return
+				}
+			}
+		}
+	}
+	output = &result
+
+	grade = Good
+	if result.Result == "served" {
+		result.Elsewhere = resolvesElsewhere(addr, other)
+		if result.Elsewhere {
+			grade = Warning
+		}
+	}
+	return
+}
+
+// resolvesElsewhere reports whether name resolves, but to none of the
+// addresses of the host at addr.
+func resolvesElsewhere(addr, name string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	hostAddrs, err := net.LookupHost(host)
+	if err != nil {
+		return false
+	}
+	nameAddrs, err := net.LookupHost(name)
+	if err != nil {
+		return false
+	}
+	for _, a := range nameAddrs {
+		for _, b := range hostAddrs {
+			if net.ParseIP(a).Equal(net.ParseIP(b)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// h2Authority returns the :authority of a request for name on the host at addr,
+// with the port of addr unless it is 443.
+func h2Authority(addr, name string) string {
+	if _, port, err := net.SplitHostPort(addr); err == nil && port != "443" {
+		return net.JoinHostPort(name, port)
+	}
+	return name
+}
+
+// h2HeaderBlock returns the header block fragment of a HEADERS frame payload,
+// removing any padding and priority fields.
+func h2HeaderBlock(flags byte, payload []byte) []byte {
+	if flags&h2FlagPadded != 0 && len(payload) > 0 {
+		pad := int(payload[0])
+		if pad >= len(payload) {
+			return nil
+		}
+		payload = payload[1 : len(payload)-pad]
+	}
+	if flags&h2FlagPriority != 0 {
+		if len(payload) < 5 {
+			return nil
+		}
+		payload = payload[5:]
+	}
+	return payload
+}
+
+// hpackStaticStatus are the :status values of the HPACK static table,
+// entries 8 through 14.
+var hpackStaticStatus = []int{200, 204, 206, 304, 400, 404, 500}
+
+// hpackStatus returns the :status of a response header block, which must come
+// first. Only the static table is consulted, which suffices since nothing
+// precedes it in the first response of a connection.
+func hpackStatus(block []byte) (int, error) {
+	for len(block) > 0 {
+		b := block[0]
+		var index uint64
+		var err error
+		switch {
+		case b&0x80 != 0:
+			// Indexed header field.
+			if index, _, err = hpackInt(block, 7); err != nil {
+				return 0, err
+			}
+			if index < 8 || index > 14 {
+				return 0, errMalformedH2
+			}
+			return hpackStaticStatus[index-8], nil
+		case b&0xe0 == 0x20:
+			// Dynamic table size update.
+			if _, block, err = hpackInt(block, 5); err != nil {
+				return 0, err
+			}
+			continue
+		case b&0xc0 == 0x40:
+			// Literal with incremental indexing.
+			index, block, err = hpackInt(block, 6)
+		default:
+			// Literal without indexing, or never indexed.
+			index, block, err = hpackInt(block, 4)
+		}
+		if err != nil {
+			return 0, err
+		}
+		if index < 8 || index > 14 {
+			return 0, errMalformedH2
+		}
+		value, _, err := hpackString(block)
+		if err != nil {
+			return 0, err
+		}
+		return strconv.Atoi(value)
+	}
+	return 0, errMalformedH2
+}
+
+// hpackInt decodes an HPACK integer with the given prefix length from the
+// start of block, returning it and the rest of block.
+func hpackInt(block []byte, prefix uint) (uint64, []byte, error) {
+	if len(block) == 0 {
+		return 0, nil, errMalformedH2
+	}
+	max := uint64(1)<<prefix - 1
+	v := uint64(block[0]) & max
+	block = block[1:]
+	if v < max {
+		return v, block, nil
+	}
+	for shift := uint(0); len(block) > 0 && shift < 56; shift += 7 {
+		b := block[0]
+		block = block[1:]
+		v += uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return v, block, nil
+		}
+	}
+	return 0, nil, errMalformedH2
+}
+
+// hpackDigits are the Huffman codes of the digits 3 through 9, which are six
+// bits long; those of 0 through 2 are the five-bit codes 0b00000 to 0b00010.
+const hpackDigits = 0x19
+
+// hpackString decodes an HPACK string literal from the start of block,
+// returning it and the rest of block. Huffman-coded strings may only contain
+// digits, as status codes do.
+func hpackString(block []byte) (string, []byte, error) {
+	if len(block) == 0 {
+		return "", nil, errMalformedH2
+	}
+	huffman := block[0]&0x80 != 0
+	n, block, err := hpackInt(block, 7)
+	if err != nil || uint64(len(block)) < n {
+		return "", nil, errMalformedH2
+	}
+	data, block := block[:n], block[n:]
+	if !huffman {
+		return string(data), block, nil
+	}
+	if len(data) > 8 {
+		return "", nil, errMalformedH2
+	}
+
+	var bits uint64
+	for _, b := range data {
+		bits = bits<<8 | uint64(b)
+	}
+	var digits []byte
+	for rest := uint(len(data) * 8); ; {
+		// Up to seven one bits pad the last byte.
+		if rest < 8 && bits&(1<<rest-1) == 1<<rest-1 {
+			break
+		}
+		if rest < 5 {
+			return "", nil, errMalformedH2
+		}
+		if code := bits >> (rest - 5) & 0x1f; code < 3 {
+			digits = append(digits, '0'+byte(code))
+			rest -= 5
+			continue
+		}
+		if rest < 6 {
+			return "", nil, errMalformedH2
+		}
+		code := bits >> (rest - 6) & 0x3f
+		if code < hpackDigits || code > hpackDigits+6 {
+			return "", nil, errMalformedH2
+		}
+		digits = append(digits, '3'+byte(code-hpackDigits))
+		rest -= 6
+	}
+	return string(digits), block, nil
+}
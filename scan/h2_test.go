@@ -0,0 +1,25 @@
+package scan
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestHpackStatus(t *testing.T) {
+	for block, want := range map[string]int{
+		"88":         200,
+		"208d":       404,
+		"0803343231": 421,
+		"48826841":   421,
+		"18826841":   421,
+		"48836c0cff": 503,
+		"85":         0,
+		"488268":     0,
+	} {
+		b, _ := hex.DecodeString(block)
+		got, err := hpackStatus(b)
+		if got != want || (err != nil) != (want == 0) {
+			t.Errorf("%s: status = %d, %v, want %d", block, got, err, want)
+		}
+	}
+}
@@ -0,0 +1,526 @@
+package scan
+
+import (
+	stdcontext "context"
+	stdtls "crypto/tls"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTP contains scanners for the content the host serves over HTTPS.
+var HTTP = &Family{
+	Description: "Scans the host's HTTPS responses",
+	Scanners: map[string]*Scanner{
+		"MixedContent": {
+			Description: "Host's HTTPS page doesn't load resources over plaintext HTTP",
+			scan:        mixedContentScan,
+		},
+		"HealthCheck": {
+			Description: "Host's health path answers with a success status",
+			scan:        healthCheckScan,
+		},
+		"InternalNames": {
+			Description: "Host's certificate and response headers don't disclose internal names or addresses",
+			scan:        internalNamesScan,
+		},
+		"H2Streams": {
+			Description: "Host handles concurrent HTTP/2 streams and closes connections with GOAWAY",
+			scan:        h2StreamsScan,
+		},
+		"H2Coalescing": {
+			Description: "Host doesn't serve other names on its certificate resolving elsewhere over an HTTP/2 connection for the host",
+			scan:        h2CoalescingScan,
+		},
+		"ContentSecurityPolicy": {
+			Description: "Host's HTML pages set a Content-Security-Policy without unsafe sources",
+			scan:        contentSecurityPolicyScan,
+		},
+		"CookieFlags": {
+			Description: "Host's cookies set the Secure and HttpOnly attributes",
+			scan:        cookieFlagsScan,
+		},
+		"AltSvc": {
+			Description: "Host advertises HTTP/3 in its Alt-Svc response header",
+			scan:        altSvcScan,
+		},
+	},
+}
+
+// maxHTTPBodySize bounds the size of a response body read from the host.
+var maxHTTPBodySize int64 = 1 << 20
+
+// httpsURL returns the HTTPS URL for path on the host, using the port of addr.
+func httpsURL(addr, hostname, path string) string {
+	if _, port, err := net.SplitHostPort(addr); err == nil && port != "443" {
+		hostname = net.JoinHostPort(hostname, port)
+	}
+	return "https://" + hostname + path
+}
+
+// hostClient returns a client fetching from the host at addr, whatever its
+// name resolves to, with hostname used for SNI, certificate verification, and
+// the Host header. Redirects within the host are followed unless noRedirect
+// is set; those to other hosts are returned rather than followed. Requests
+// taking longer than timeout, if set, are given up on. If Client is configured
+// with a proxy, requests go through it, and the proxy resolves hostname itself.
+func hostClient(addr, hostname string, timeout time.Duration, noRedirect bool) *http.Client {
+	transport := &http.Transport{
+		DialContext: func(ctx stdcontext.Context, network, _ string) (net.Conn, error) {
+			return Dialer.DialContext(ctx, Network, addr)
+		},
+		TLSClientConfig:   &stdtls.Config{ServerName: hostname, RootCAs: RootCAs},
+		DisableKeepAlives: true,
+	}
+	if shared, ok := Client.Transport.(*http.Transport); ok && shared.Proxy != nil {
+		transport.Proxy = shared.Proxy
+		transport.DialContext = Dialer.DialContext
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if noRedirect || !strings.EqualFold(req.URL.Hostname(), hostname) || len(via) >= 10 {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		},
+	}
+}
+
+// getHTTPS fetches path from the host at addr, returning the response along
+// with up to maxHTTPBodySize bytes of its body, giving up after
+// healthCheckTimeout.
+func getHTTPS(addr, hostname, path string) (resp *http.Response, body []byte, err error) {
+	resp, err = hostClient(addr, hostname, healthCheckTimeout, false).Get(httpsURL(addr, hostname, path))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err = ioutil.ReadAll(io.LimitReader(resp.Body, maxHTTPBodySize))
+	return
+}
+
+// insecureResource matches HTML elements referencing a resource over plaintext HTTP.
+var insecureResource = regexp.MustCompile(`(?i)<(script|link|iframe|frame|object|embed|img|audio|video|source|track)\b[^>]*?\b(?:src|href|data)\s*=\s*["']?(http://[^"'\s>]+)`)
+
+// activeContent are the elements whose resources can alter the whole page,
+// and so are blocked by browsers when loaded over plaintext HTTP.
+var activeContent = map[string]bool{
+	"script": true,
+	"link":   true,
+	"iframe": true,
+	"frame":  true,
+	"object": true,
+	"embed":  true,
+}
+
+// mixedContent lists a page's plaintext resources by their kind.
+type mixedContent struct {
+	Active  []string `json:"active"`
+	Passive []string `json:"passive"`
+}
+
+// mixedContentScan looks for resources referenced over plaintext HTTP in the
+// host's HTTPS root page. Active mixed content, such as scripts, is graded
+// Bad and passive mixed content, such as images, Warning.
+func mixedContentScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	_, body, err := getHTTPS(addr, hostname, "/")
+	if err != nil {
+		return
+	}
+
+	result := mixedContent{Active: []string{}, Passive: []string{}}
+	for _, match := range insecureResource.FindAllStringSubmatch(string(body), -1) {
+		if activeContent[strings.ToLower(match[1])] {
+			result.Active = append(result.Active, match[2])
+		} else {
+			result.Passive = append(result.Passive, match[2])
+		}
+	}
+	output = result
+
+	switch {
+	case len(result.Active) > 0:
+		grade = Bad
+	case len(result.Passive) > 0:
+		grade = Warning
+	default:
+		grade = Good
+	}
+	return
+}
+
+// sessionCookie matches the names of cookies that likely hold session credentials.
+var sessionCookie = regexp.MustCompile(`(?i)sess|sid|auth|token|login|jwt`)
+
+// cookieFlags lists the security attributes a cookie lacks.
+type cookieFlags struct {
+	Name    string   `json:"name"`
+	Missing []string `json:"missing"`
+}
+
+// cookieFlagsScan reports the cookies set by the host's HTTPS root page that
+// lack the Secure or HttpOnly attributes. Session cookies lacking Secure are
+// graded Bad, and any other missing attribute Warning.
+func cookieFlagsScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	resp, _, err := getHTTPS(addr, hostname, "/")
+	if err != nil {
+		return
+	}
+
+	grade = Good
+	offending := []cookieFlags{}
+	for _, cookie := range resp.Cookies() {
+		flags := cookieFlags{Name: cookie.Name}
+		if !cookie.Secure {
+			flags.Missing = append(flags.Missing, "Secure")
+		}
+		if !cookie.HttpOnly {
+			flags.Missing = append(flags.Missing, "HttpOnly")
+		}
+		if len(flags.Missing) == 0 {
+			continue
+		}
+		offending = append(offending, flags)
+
+		if !cookie.Secure && sessionCookie.MatchString(cookie.Name) {
+			grade = Bad
+		} else if grade == Good {
+			grade = Warning
+		}
+	}
+
+	output = offending
+	return
+}
+
+// contentSecurityPolicy reports the host's Content-Security-Policy and its weaknesses.
+type contentSecurityPolicy struct {
+	Policy     string   `json:"policy"`
+	Weaknesses []string `json:"weaknesses,omitempty"`
+}
+
+// cspWeaknesses lists the directives of a Content-Security-Policy that allow
+// inline or eval'd script, or a default source of any origin. Since browsers
+// ignore 'unsafe-inline' in directives with nonces or hashes, those aren't
+// flagged for it.
+func cspWeaknesses(policy string) (weaknesses []string) {
+	for _, directive := range strings.Split(policy, ";") {
+		fields := strings.Fields(strings.ToLower(directive))
+		if len(fields) == 0 {
+			continue
+		}
+		name, sources := fields[0], fields[1:]
+
+		var inline, eval, any, nonced bool
+		for _, source := range sources {
+			switch {
+			case source == "'unsafe-inline'":
+				inline = true
+			case source == "'unsafe-eval'":
+				eval = true
+			case source == "*":
+				any = true
+			case strings.HasPrefix(source, "'nonce-"), strings.HasPrefix(source, "'sha"):
+				nonced = true
+			}
+		}
+		if inline && !nonced {
+			weaknesses = append(weaknesses, name+" allows 'unsafe-inline'")
+		}
+		if eval {
+			weaknesses = append(weaknesses, name+" allows 'unsafe-eval'")
+		}
+		if any && name == "default-src" {
+			weaknesses = append(weaknesses, "default-src allows any origin")
+		}
+	}
+	return
+}
+
+// contentSecurityPolicyScan checks the Content-Security-Policy of the host's
+// HTTPS root page. HTML pages without one are graded Bad, and those whose
+// policy allows inline or eval'd script, or any origin by default, are warned
+// of. Other content without a policy is skipped.
+func contentSecurityPolicyScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	resp, _, err := getHTTPS(addr, hostname, "/")
+	if err != nil {
+		return
+	}
+
+	policies := resp.Header[http.CanonicalHeaderKey("Content-Security-Policy")]
+	if len(policies) == 0 {
+		if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+			grade = Skipped
+		}
+		return
+	}
+
+	result := contentSecurityPolicy{Policy: strings.Join(policies, ", ")}
+	for _, policy := range policies {
+		result.Weaknesses = append(result.Weaknesses, cspWeaknesses(policy)...)
+	}
+	output = result
+
+	if len(result.Weaknesses) > 0 {
+		grade = Warning
+	} else {
+		grade = Good
+	}
+	return
+}
+
+// altSvcDefaultMaxAge is how long, in seconds, clients remember an Alt-Svc
+// alternative that sets no ma parameter (RFC 7838, section 3.1).
+const altSvcDefaultMaxAge = 86400
+
+// An altSvc is an alternative service advertised in an Alt-Svc header.
+type altSvc struct {
+	Protocol string `json:"protocol"`
+	// Authority is the alternative's host and port; the host is empty if it
+	// is the origin's.
+	Authority string `json:"authority"`
+	MaxAge    int    `json:"max_age"`
+	Persist   bool   `json:"persist,omitempty"`
+}
+
+// splitUnquoted splits s around each sep outside double quotes.
+func splitUnquoted(s string, sep rune) (fields []string) {
+	var quoted, escaped bool
+	start := 0
+	for i, c := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case c == sep && !quoted:
+			fields = append(fields, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(fields, s[start:])
+}
+
+// splitParam splits a name=value parameter, unquoting the value.
+func splitParam(param string) (name, value string) {
+	i := strings.IndexByte(param, '=')
+	if i < 0 {
+		return strings.TrimSpace(param), ""
+	}
+	name, value = strings.TrimSpace(param[:i]), strings.TrimSpace(param[i+1:])
+	if unquoted, err := strconv.Unquote(value); err == nil && value[0] == '"' {
+		value = unquoted
+	}
+	return
+}
+
+// parseAltSvc parses the values of Alt-Svc headers, returning the alternatives
+// they advertise. The special value "clear", invalidating alternatives clients
+// remember, advertises none. Malformed alternatives are left out.
+func parseAltSvc(values []string) (alternatives []altSvc) {
+	for _, value := range values {
+		for _, alternative := range splitUnquoted(value, ',') {
+			params := splitUnquoted(alternative, ';')
+			protocol, authority := splitParam(params[0])
+			if protocol == "" || authority == "" {
+				continue
+			}
+			if unescaped, err := url.PathUnescape(protocol); err == nil {
+				protocol = unescaped
+			}
+			entry := altSvc{Protocol: protocol, Authority: authority, MaxAge: altSvcDefaultMaxAge}
+			for _, param := range params[1:] {
+				switch name, value := splitParam(param); strings.ToLower(name) {
+				case "ma":
+					if ma, err := strconv.Atoi(value); err == nil {
+						entry.MaxAge = ma
+					}
+				case "persist":
+					entry.Persist = value == "1"
+				}
+			}
+			alternatives = append(alternatives, entry)
+		}
+	}
+	return
+}
+
+// altSvcScan requests the host's HTTPS root page and reports the alternative
+// services advertised by its Alt-Svc header, the lightweight counterpart of
+// the QUIC scanner. It is informational, graded Good if HTTP/3 is among them
+// and skipped otherwise.
+func altSvcScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	resp, _, err := getHTTPS(addr, hostname, "/")
+	if err != nil {
+		return
+	}
+
+	alternatives := parseAltSvc(resp.Header[http.CanonicalHeaderKey("Alt-Svc")])
+	grade = Skipped
+	for _, alternative := range alternatives {
+		if alternative.Protocol == "h3" {
+			grade = Good
+		}
+	}
+	if alternatives != nil {
+		output = alternatives
+	}
+	return
+}
+
+var (
+	// healthCheckTimeout bounds how long healthCheckScan waits for the whole
+	// response, body included.
+	healthCheckTimeout = 10 * time.Second
+	// healthSnippetSize is the number of body bytes healthCheckScan reports.
+	healthSnippetSize = 256
+)
+
+// healthCheck describes the host's response to a request for its health path.
+type healthCheck struct {
+	Status  int    `json:"status"`
+	TimeMS  int64  `json:"time_ms"`
+	Snippet string `json:"snippet"`
+}
+
+// healthCheckScan requests the health path chosen by opts from the host,
+// without following redirects, grading it Good on a 2xx status and Warning
+// on a 3xx. Any other status, or a response that doesn't complete within
+// healthCheckTimeout, is graded Bad.
+func healthCheckScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	path := opts.HealthPath
+	if path == "" {
+		path = "/"
+	}
+
+	start := time.Now()
+	resp, err := hostClient(addr, hostname, healthCheckTimeout, true).Get(httpsURL(addr, hostname, path))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	body, rerr := ioutil.ReadAll(io.LimitReader(resp.Body, maxHTTPBodySize))
+	result := healthCheck{Status: resp.StatusCode, TimeMS: int64(time.Since(start) / time.Millisecond)}
+	if len(body) > healthSnippetSize {
+		body = body[:healthSnippetSize]
+	}
+	result.Snippet = string(body)
+	output = result
+
+	switch {
+	case rerr != nil:
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		grade = Good
+	case resp.StatusCode >= 300 && resp.StatusCode < 400:
+		grade = Warning
+	}
+	return
+}
+
+var (
+	// internalName matches host names under suffixes reserved or commonly
+	// used for private networks.
+	internalName = regexp.MustCompile(`(?i)\b[a-z0-9][a-z0-9-]*(?:\.[a-z0-9-]+)*\.(?:local|localdomain|localhost|internal|intranet|corp|lan|home|private)\b`)
+	// ipv4Address matches dotted IPv4 addresses.
+	ipv4Address = regexp.MustCompile(`\b(?:[0-9]{1,3}\.){3}[0-9]{1,3}\b`)
+	// leakyHeaders are the response headers inspected by internalNamesScan.
+	leakyHeaders = []string{"Server", "Via", "X-Powered-By", "X-Backend-Server", "Location"}
+)
+
+// privateNetworks are the IPv4 private address ranges (RFC 1918) and IPv6
+// unique local addresses (RFC 4193).
+var privateNetworks = []*net.IPNet{
+	{IP: net.IPv4(10, 0, 0, 0), Mask: net.CIDRMask(8, 32)},
+	{IP: net.IPv4(172, 16, 0, 0), Mask: net.CIDRMask(12, 32)},
+	{IP: net.IPv4(192, 168, 0, 0), Mask: net.CIDRMask(16, 32)},
+	{IP: net.ParseIP("fc00::"), Mask: net.CIDRMask(7, 128)},
+}
+
+// internalIP reports whether ip is a private, loopback, or link-local address.
+func internalIP(ip net.IP) bool {
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return ip.IsLoopback() || ip.IsLinkLocalUnicast()
+}
+
+// internalValues returns the internal-looking names and addresses in s.
+func internalValues(s string) (values []string) {
+	values = append(values, internalName.FindAllString(s, -1)...)
+	for _, match := range ipv4Address.FindAllString(s, -1) {
+		if ip := net.ParseIP(match); ip != nil && internalIP(ip) {
+			values = append(values, match)
+		}
+	}
+	return
+}
+
+// internalDisclosure is an internal name or address found in the named source.
+type internalDisclosure struct {
+	Source string `json:"source"`
+	Value  string `json:"value"`
+}
+
+// internalNamesScan looks for internal host names and private addresses in
+// the host's leaf SANs and in the headers of its HTTPS root page, such as a
+// Via header naming a backend or a Location redirecting to a private address.
+// Any disclosure is warned of.
+func internalNamesScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	chain, err := getChain(addr, opts.tlsConfig(hostname))
+	if err != nil {
+		return
+	}
+
+	leaks := []internalDisclosure{}
+	for _, name := range chain[0].DNSNames {
+		if strings.IndexByte(strings.TrimPrefix(name, "*."), '.') < 0 || internalName.MatchString(name) {
+			leaks = append(leaks, internalDisclosure{"SAN", name})
+		}
+	}
+	for _, ip := range chain[0].IPAddresses {
+		if internalIP(ip) {
+			leaks = append(leaks, internalDisclosure{"SAN", ip.String()})
+		}
+	}
+
+	resp, err := hostClient(addr, hostname, healthCheckTimeout, true).Get(httpsURL(addr, hostname, "/"))
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+	for _, header := range leakyHeaders {
+		for _, value := range resp.Header[header] {
+			if header == "Location" {
+				// Only the authority of a redirect can disclose a host.
+				if u, perr := url.Parse(value); perr == nil {
+					value = u.Host
+				}
+			}
+			for _, leaked := range internalValues(value) {
+				leaks = append(leaks, internalDisclosure{header, leaked})
+			}
+		}
+	}
+
+	output = leaks
+	if len(leaks) > 0 {
+		grade = Warning
+	} else {
+		grade = Good
+	}
+	return
+}
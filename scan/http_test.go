@@ -0,0 +1,66 @@
+package scan
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestInternalValues(t *testing.T) {
+	for s, want := range map[string][]string{
+		"1.1 proxy01.corp (squid/3.5)": {"proxy01.corp"},
+		"https://10.1.2.3/login":       {"10.1.2.3"},
+		"nginx/1.18.0 (Ubuntu)":        nil,
+		"8.8.8.8, 192.168.0.10":        {"192.168.0.10"},
+		"app.svc.cluster.local":        {"app.svc.cluster.local"},
+		"www.example.com":              nil,
+	} {
+		if got := internalValues(s); !reflect.DeepEqual(got, want) {
+			t.Errorf("internalValues(%q) = %q, want %q", s, got, want)
+		}
+	}
+}
+
+func TestInternalIP(t *testing.T) {
+	for ip, want := range map[string]bool{
+		"10.1.2.3":    true,
+		"172.31.0.1":  true,
+		"172.32.0.1":  false,
+		"192.168.1.1": true,
+		"127.0.0.1":   true,
+		"169.254.0.1": true,
+		"8.8.8.8":     false,
+		"fd00::1":     true,
+		"2001:db8::1": false,
+	} {
+		if got := internalIP(net.ParseIP(ip)); got != want {
+			t.Errorf("internalIP(%s) = %v, want %v", ip, got, want)
+		}
+	}
+}
+
+func TestCSPWeaknesses(t *testing.T) {
+	for policy, want := range map[string][]string{
+		"default-src 'self'":                                    nil,
+		"default-src *; script-src 'self' 'unsafe-eval'":        {"default-src allows any origin", "script-src allows 'unsafe-eval'"},
+		"script-src 'unsafe-inline'; style-src 'unsafe-inline'": {"script-src allows 'unsafe-inline'", "style-src allows 'unsafe-inline'"},
+		"script-src 'nonce-abc' 'unsafe-inline' ; ;":            nil,
+	} {
+		if got := cspWeaknesses(policy); !reflect.DeepEqual(got, want) {
+			t.Errorf("cspWeaknesses(%q) = %q, want %q", policy, got, want)
+		}
+	}
+}
+
+func TestParseAltSvc(t *testing.T) {
+	for value, want := range map[string][]altSvc{
+		`h3=":443"; ma=86400, h3-29=":443"`:    {{"h3", ":443", 86400, false}, {"h3-29", ":443", altSvcDefaultMaxAge, false}},
+		`h2="alt.example.com:8443"; persist=1`: {{"h2", "alt.example.com:8443", altSvcDefaultMaxAge, true}},
+		`w%3Dx%3Ay="a,b:1";ma=60`:              {{"w=x:y", "a,b:1", 60, false}},
+		`clear`:                                nil,
+	} {
+		if got := parseAltSvc([]string{value}); !reflect.DeepEqual(got, want) {
+			t.Errorf("parseAltSvc(%q) = %+v, want %+v", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,350 @@
+package scan
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// jarmTimeout bounds how long each JARM probe waits for the host's response.
+var jarmTimeout = 5 * time.Second
+
+// A jarmProbe describes one of the ClientHellos sent to compute a JARM
+// fingerprint, as in Salesforce's reference implementation.
+type jarmProbe struct {
+	version uint16
+	// noTLS13 leaves the TLS 1.3 cipher suites out of the ClientHello.
+	noTLS13 bool
+	// cipherOrder is how the cipher suites are ordered, one of the orders
+	// of jarmMung.
+	cipherOrder string
+	grease      bool
+	rareALPN    bool
+	// supportedVersions is "1.2", "1.3", or "" to send no supported_versions
+	// extension unless version is TLS 1.3.
+	supportedVersions string
+	// extensionOrder is how the ALPN protocols and supported versions are
+	// ordered.
+	extensionOrder string
+}
+
+// jarmProbes are the 10 probes making up a JARM fingerprint, in order.
+var jarmProbes = []jarmProbe{
+	{0x0303, false, "FORWARD", false, false, "1.2", "REVERSE"},
+	{0x0303, false, "REVERSE", false, false, "1.2", "FORWARD"},
+	{0x0303, false, "TOP_HALF", false, false, "", "FORWARD"},
+	{0x0303, false, "BOTTOM_HALF", false, true, "", "FORWARD"},
+	{0x0303, false, "MIDDLE_OUT", true, true, "", "REVERSE"},
+	{0x0302, false, "FORWARD", false, false, "", "FORWARD"},
+	{0x0304, false, "FORWARD", false, false, "1.3", "REVERSE"},
+	{0x0304, false, "REVERSE", false, false, "1.3", "FORWARD"},
+	{0x0304, true, "FORWARD", false, false, "1.3", "FORWARD"},
+	{0x0304, false, "MIDDLE_OUT", true, false, "1.3", "REVERSE"},
+}
+
+// jarmCiphers are the cipher suites JARM offers, in their forward order.
+var jarmCiphers = []uint16{
+	0x0016, 0x0033, 0x0067, 0xc09e, 0xc0a2, 0x009e, 0x0039, 0x006b, 0xc09f, 0xc0a3, 0x009f, 0x0045, 0x00be, 0x0088,
+	0x00c4, 0x009a, 0xc008, 0xc009, 0xc023, 0xc0ac, 0xc0ae, 0xc02b, 0xc00a, 0xc024, 0xc0ad, 0xc0af, 0xc02c, 0xc072,
+	0xc073, 0xcca9, 0x1302, 0x1301, 0xcc14, 0xc007, 0xc012, 0xc013, 0xc027, 0xc02f, 0xc014, 0xc028, 0xc030, 0xc060,
+	0xc061, 0xc076, 0xc077, 0xcca8, 0x1305, 0x1304, 0x1303, 0xcc13, 0xc011, 0x000a, 0x002f, 0x003c, 0xc09c, 0xc0a0,
+	0x009c, 0x0035, 0x003d, 0xc09d, 0xc0a1, 0x009d, 0x0041, 0x00ba, 0x0084, 0x00c0, 0x0007, 0x0004, 0x0005,
+}
+
+// jarmCipherRanks are the cipher suites selected by hosts as encoded in the
+// fingerprint, by their one-based index.
+var jarmCipherRanks = []uint16{
+	0x0004, 0x0005, 0x0007, 0x000a, 0x0016, 0x002f, 0x0033, 0x0035, 0x0039, 0x003c, 0x003d, 0x0041, 0x0045, 0x0067,
+	0x006b, 0x0084, 0x0088, 0x009a, 0x009c, 0x009d, 0x009e, 0x009f, 0x00ba, 0x00be, 0x00c0, 0x00c4, 0xc007, 0xc008,
+	0xc009, 0xc00a, 0xc011, 0xc012, 0xc013, 0xc014, 0xc023, 0xc024, 0xc027, 0xc028, 0xc02b, 0xc02c, 0xc02f, 0xc030,
+	0xc060, 0xc061, 0xc072, 0xc073, 0xc076, 0xc077, 0xc09c, 0xc09d, 0xc09e, 0xc09f, 0xc0a0, 0xc0a1, 0xc0a2, 0xc0a3,
+	0xc0ac, 0xc0ad, 0xc0ae, 0xc0af, 0xcc13, 0xcc14, 0xcca8, 0xcca9, 0x1301, 0x1302, 0x1303, 0x1304, 0x1305,
+}
+
+// ALPN protocols offered by JARM probes, in their forward order.
+var (
+	jarmALPNs     = []string{"http/0.9", "http/1.0", "http/1.1", "spdy/1", "spdy/2", "spdy/3", "h2", "h2c", "hq"}
+	jarmRareALPNs = []string{"http/0.9", "http/1.0", "spdy/1", "spdy/2", "spdy/3", "h2c", "hq"}
+)
+
+// jarmMung reorders items, which may be cipher suites, ALPN protocols, or
+// versions, as JARM does: "FORWARD" leaves them as is, "REVERSE" reverses
+// them, "BOTTOM_HALF" and "TOP_HALF" keep one half of them, and "MIDDLE_OUT"
+// interleaves them outwards from the middle.
+func jarmMung(items []string, order string) []string {
+	n, middle := len(items), len(items)/2
+	var out []string
+	switch order {
+	case "REVERSE":
+		for i := n - 1; i >= 0; i-- {
+			out = append(out, items[i])
+		}
+	case "BOTTOM_HALF":
+		out = append(out, items[middle+n%2:]...)
+	case "TOP_HALF":
+		if n%2 == 1 {
+			out = append(out, items[middle])
+		}
+		out = append(out, jarmMung(jarmMung(items, "REVERSE"), "BOTTOM_HALF")...)
+	case "MIDDLE_OUT":
+		if n%2 == 1 {
+			out = append(out, items[middle])
+			for i := 1; i <= middle; i++ {
+				out = append(out, items[middle+i], items[middle-i])
+			}
+		} else {
+			for i := 1; i <= middle; i++ {
+				out = append(out, items[middle-1+i], items[middle-i])
+			}
+		}
+	default:
+		out = append(out, items...)
+	}
+	return out
+}
+
+// jarmUint16s converts values to two byte big endian strings for jarmMung.
+func jarmUint16s(values []uint16) []string {
+	items := make([]string, len(values))
+	for i, v := range values {
+		items[i] = string([]byte{byte(v >> 8), byte(v)})
+	}
+	return items
+}
+
+// randomGREASE returns one of the reserved GREASE values (RFC 8701).
+func randomGREASE() []byte {
+	b := make([]byte, 1)
+	rand.Read(b)
+	v := b[0]&0xf0 | 0x0a
+	return []byte{v, v}
+}
+
+// appendVector appends data to b preceded by its length in n bytes.
+func appendVector(b []byte, n int, data []byte) []byte {
+	for i := n - 1; i >= 0; i-- {
+		b = append(b, byte(len(data)>>(8*uint(i))))
+	}
+	return append(b, data...)
+}
+
+// appendExtension appends a TLS extension of the given type to b.
+func appendExtension(b []byte, extType uint16, data []byte) []byte {
+	return appendVector(append(b, byte(extType>>8), byte(extType)), 2, data)
+}
+
+// jarmHello returns the handshake record holding probe's ClientHello for hostname.
+func jarmHello(hostname string, probe jarmProbe) []byte {
+	random := make([]byte, 64+32)
+	rand.Read(random)
+
+	hello := []byte{0x03, 0x03}
+	if probe.version < 0x0304 {
+		hello[1] = byte(probe.version)
+	}
+	hello = append(hello, random[:32]...)
+	hello = appendVector(hello, 1, random[32:64])
+
+	var ciphers []uint16
+	for _, c := range jarmCiphers {
+		if !probe.noTLS13 || c>>8 != 0x13 {
+			ciphers = append(ciphers, c)
+		}
+	}
+	var suites []byte
+	if probe.grease {
+		suites = append(suites, randomGREASE()...)
+	}
+	suites = append(suites, strings.Join(jarmMung(jarmUint16s(ciphers), probe.cipherOrder), "")...)
+	hello = appendVector(hello, 2, suites)
+	hello = append(hello, 1, 0) // null compression
+
+	var exts []byte
+	if probe.grease {
+		exts = append(exts, randomGREASE()...)
+		exts = append(exts, 0, 0)
+	}
+	serverName := appendVector([]byte{0}, 2, []byte(hostname))
+	exts = appendExtension(exts, 0, appendVector(nil, 2, serverName))
+	exts = appendExtension(exts, 23, nil)                                      // extended_master_secret
+	exts = appendExtension(exts, 1, []byte{1})                                 // max_fragment_length
+	exts = appendExtension(exts, 0xff01, []byte{0})                            // renegotiation_info
+	exts = appendExtension(exts, 10, []byte{0, 8, 0, 29, 0, 23, 0, 24, 0, 25}) // supported_groups
+	exts = appendExtension(exts, 11, []byte{1, 0})                             // ec_point_formats
+	exts = appendExtension(exts, 35, nil)                                      // session_ticket
+
+	alpns := jarmALPNs
+	if probe.rareALPN {
+		alpns = jarmRareALPNs
+	}
+	var protos []byte
+	for _, proto := range jarmMung(alpns, probe.extensionOrder) {
+		protos = appendVector(protos, 1, []byte(proto))
+	}
+	exts = appendExtension(exts, 16, appendVector(nil, 2, protos))
+	exts = appendExtension(exts, 13, []byte{0, 0x12, 4, 3, 8, 4, 4, 1, 5, 3, 8, 5, 5, 1, 8, 6, 6, 1, 2, 1})
+
+	var shares []byte
+	if probe.grease {
+		shares = append(shares, randomGREASE()...)
+		shares = append(shares, 0, 1, 0)
+	}
+	shares = appendVector(append(shares, 0, 29), 2, random[64:])
+	exts = appendExtension(exts, 51, appendVector(nil, 2, shares))
+	exts = appendExtension(exts, 45, []byte{1, 1}) // psk_key_exchange_modes
+
+	if probe.version == 0x0304 || probe.supportedVersions == "1.2" {
+		versions := []string{"\x03\x01", "\x03\x02", "\x03\x03"}
+		if probe.supportedVersions != "1.2" {
+			versions = append(versions, "\x03\x04")
+		}
+		var list []byte
+		if probe.grease {
+			list = randomGREASE()
+		}
+		list = append(list, strings.Join(jarmMung(versions, probe.extensionOrder), "")...)
+		exts = appendExtension(exts, 43, appendVector(nil, 1, list))
+	}
+	hello = appendVector(hello, 2, exts)
+
+	handshake := appendVector([]byte{1}, 3, hello)
+	recordVersion := probe.version
+	if recordVersion == 0x0304 {
+		recordVersion = 0x0301
+	}
+	return appendVector([]byte{0x16, byte(recordVersion >> 8), byte(recordVersion)}, 2, handshake)
+}
+
+// jarmResult formats the start of the host's response to a probe as JARM
+// does: the selected cipher suite and version, the ALPN protocol, and the
+// types of the ServerHello's extensions, separated by "|". Responses other
+// than a ServerHello give "|||".
+func jarmResult(data []byte) string {
+	if len(data) < 44 || data[0] != 0x16 || data[5] != 2 {
+		return "|||"
+	}
+	helloLen := int(binary.BigEndian.Uint16(data[3:]))
+	counter := int(data[43])
+	if len(data) < counter+46 {
+		return "|||"
+	}
+	result := hex.EncodeToString(data[counter+44:counter+46]) + "|" + hex.EncodeToString(data[9:11]) + "|"
+	return result + jarmExtensions(data, counter, helloLen)
+}
+
+// jarmExtensions formats the ALPN protocol and extension types in the
+// ServerHello at the start of data, whose session ID is counter bytes long.
+func jarmExtensions(data []byte, counter, helloLen int) string {
+	if len(data) < counter+49 || data[counter+47] == 11 ||
+		(len(data) >= counter+53 && string(data[counter+50:counter+53]) == "\x0e\xac\x0b") ||
+		(len(data) >= 85 && string(data[82:85]) == "\x0f\xf0\x0b") ||
+		counter+42 >= helloLen {
+		return "|"
+	}
+
+	var types []string
+	alpn := ""
+	count := 49 + counter
+	maximum := int(binary.BigEndian.Uint16(data[counter+47:])) + count - 1
+	for count < maximum {
+		if len(data) < count+4 {
+			return "|"
+		}
+		extType := data[count : count+2]
+		length := int(binary.BigEndian.Uint16(data[count+2:]))
+		if len(data) < count+4+length {
+			return "|"
+		}
+		if extType[0] == 0 && extType[1] == 16 && alpn == "" && length > 3 {
+			alpn = string(data[count+7 : count+4+length])
+		}
+		types = append(types, hex.EncodeToString(extType))
+		count += 4 + length
+	}
+	return alpn + "|" + strings.Join(types, "-")
+}
+
+// jarmHash composes the results of the probes into a JARM fingerprint: a
+// byte for the cipher suite and a character for the version selected in each
+// probe, followed by a truncated SHA-256 hash of the ALPN protocols and
+// extensions.
+func jarmHash(results []string) string {
+	if strings.Repeat("|||", len(results)) == strings.Join(results, "") {
+		return strings.Repeat("0", 62)
+	}
+
+	var fuzzy, alpnsAndExts string
+	for _, result := range results {
+		components := strings.Split(result, "|")
+		switch {
+		case components[0] == "":
+			fuzzy += "00"
+		default:
+			rank := len(jarmCipherRanks) + 1
+			for i, c := range jarmCipherRanks {
+				if fmt.Sprintf("%04x", c) == components[0] {
+					rank = i + 1
+					break
+				}
+			}
+			fuzzy += fmt.Sprintf("%02x", rank)
+		}
+		if v := components[1]; len(v) == 4 && v[3] >= '0' && v[3] <= '5' {
+			fuzzy += string("abcdef"[v[3]-'0'])
+		} else {
+			fuzzy += "0"
+		}
+		alpnsAndExts += components[2] + components[3]
+	}
+	sum := sha256.Sum256([]byte(alpnsAndExts))
+	return fuzzy + hex.EncodeToString(sum[:])[:32]
+}
+
+// jarmScan sends the host the 10 JARM probes, reporting the fingerprint
+// composed from its responses, which identifies its TLS stack and
+// configuration. It is informational.
+func jarmScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	results := make([]string, len(jarmProbes))
+	for i, probe := range jarmProbes {
+		opts.progress(i, len(jarmProbes))
+		if results[i], err = jarmProbeHost(addr, hostname, probe); err != nil {
+			return
+		}
+	}
+	opts.progress(len(jarmProbes), len(jarmProbes))
+
+	grade, output = Good, jarmHash(results)
+	return
+}
+
+// jarmProbeHost sends probe to the host, returning the formatted result. The
+// host failing to respond counts as a failed handshake; only failures to
+// connect are returned as errors.
+func jarmProbeHost(addr, hostname string, probe jarmProbe) (string, error) {
+	conn, err := Dialer.Dial(Network, addr)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(jarmTimeout))
+	if _, err = conn.Write(jarmHello(hostname, probe)); err != nil {
+		return "|||", nil
+	}
+
+	// The reference implementation reads just the first 1484 bytes.
+	data := make([]byte, 1484)
+	n, _ := io.ReadAtLeast(conn, data, 5)
+	if n >= 5 {
+		if want := 5 + int(binary.BigEndian.Uint16(data[3:])); want < len(data) && n < want {
+			m, _ := io.ReadAtLeast(conn, data[n:want], want-n)
+			n += m
+		}
+	}
+	return jarmResult(data[:n]), nil
+}
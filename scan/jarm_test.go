@@ -0,0 +1,50 @@
+package scan
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJARMMung(t *testing.T) {
+	items := []string{"a", "b", "c", "d", "e"}
+	for order, want := range map[string][]string{
+		"FORWARD":     {"a", "b", "c", "d", "e"},
+		"REVERSE":     {"e", "d", "c", "b", "a"},
+		"BOTTOM_HALF": {"d", "e"},
+		"TOP_HALF":    {"c", "b", "a"},
+		"MIDDLE_OUT":  {"c", "d", "b", "e", "a"},
+	} {
+		if got := jarmMung(items, order); !reflect.DeepEqual(got, want) {
+			t.Errorf("jarmMung(%v, %s) = %v, want %v", items, order, got, want)
+		}
+	}
+}
+
+func TestJARMResult(t *testing.T) {
+	// A TLS 1.2 ServerHello without a session ID selecting
+	// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, with ALPN "h2" and
+	// extended_master_secret.
+	hello := []byte{0x16, 0x03, 0x03, 0, 59, 2, 0, 0, 55, 0x03, 0x03}
+	hello = append(hello, make([]byte, 32)...)
+	hello = append(hello, 0, 0xc0, 0x2f, 0, 0, 13, 0, 16, 0, 5, 0, 3, 2, 'h', '2', 0, 23, 0, 0)
+
+	if got, want := jarmResult(hello), "c02f|0303|h2|0010-0017"; got != want {
+		t.Errorf("jarmResult = %q, want %q", got, want)
+	}
+	if got := jarmResult([]byte{0x15, 0x03, 0x03, 0, 2, 2, 40}); got != "|||" {
+		t.Errorf("jarmResult of an alert = %q, want %q", got, "|||")
+	}
+}
+
+func TestJARMHash(t *testing.T) {
+	failed := strings.Split(strings.Repeat("|||,", 9)+"|||", ",")
+	if got := jarmHash(failed); got != strings.Repeat("0", 62) {
+		t.Errorf("jarmHash of failed probes = %q, want zeros", got)
+	}
+
+	results := append([]string{"c02f|0303|h2|0010-0017"}, failed[1:]...)
+	if got := jarmHash(results); len(got) != 62 || !strings.HasPrefix(got, "29d"+strings.Repeat("000", 9)) {
+		t.Errorf("jarmHash = %q, want a 62 character fingerprint starting with 29d", got)
+	}
+}
@@ -0,0 +1,163 @@
+package scan
+
+import (
+	"io"
+	"math"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/cfssl/scan/crypto/tls"
+)
+
+// lucky13Ciphers are the CBC cipher suites offered by lucky13Scan.
+var lucky13Ciphers = []uint16{
+	tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA, tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA, tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+	tls.TLS_RSA_WITH_AES_128_CBC_SHA, tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+}
+
+var (
+	// lucky13Samples is the number of timings lucky13Scan takes of each kind
+	// of record.
+	lucky13Samples = 50
+	// lucky13RecordSize is the plaintext size of the records sent by
+	// lucky13Scan. With the shortest padding, the host's MAC covers several
+	// more compression blocks than with the longest.
+	lucky13RecordSize = 512
+	// lucky13Timeout bounds how long each lucky13Scan probe waits on the host.
+	lucky13Timeout = 5 * time.Second
+	// lucky13MinDelta and lucky13MinT are the difference in median response
+	// times, and the Welch's t-statistic of the difference in means, above
+	// which lucky13Scan judges the host to leak the padding length. A
+	// t-statistic above lucky13HighT gives high confidence.
+	lucky13MinDelta = 2 * time.Microsecond
+	lucky13MinT     = 3.0
+	lucky13HighT    = 5.0
+)
+
+// lucky13Time completes a handshake with the host, sends it a record with
+// padding of the given length and an invalid MAC, and returns how long it
+// takes to respond.
+func lucky13Time(addr string, config *tls.Config, padding uint8) (time.Duration, error) {
+	tcpConn, err := Dialer.Dial(Network, addr)
+	if err != nil {
+		return 0, err
+	}
+	defer tcpConn.Close()
+	tcpConn.SetDeadline(time.Now().Add(lucky13Timeout))
+
+	conn := tls.Client(tcpConn, config)
+	if err = conn.Handshake(); err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	if err = conn.WritePaddedRecord(lucky13RecordSize, padding); err != nil {
+		return 0, err
+	}
+	// The host's alert is encrypted, but any response, or the connection
+	// closing, marks when it rejected the record.
+	_, rerr := io.ReadFull(tcpConn, make([]byte, 1))
+	elapsed := time.Since(start)
+	if e, ok := rerr.(net.Error); ok && e.Timeout() {
+		return 0, rerr
+	}
+	return elapsed, nil
+}
+
+// median returns the median of times, sorting them.
+func median(times []time.Duration) time.Duration {
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	return times[len(times)/2]
+}
+
+// welchT returns Welch's t-statistic for the difference in means of a and b.
+func welchT(a, b []time.Duration) float64 {
+	mean := func(xs []time.Duration) (m, v float64) {
+		for _, x := range xs {
+			m += float64(x)
+		}
+		m /= float64(len(xs))
+		for _, x := range xs {
+			v += (float64(x) - m) * (float64(x) - m)
+		}
+		return m, v / float64(len(xs)-1)
+	}
+	ma, va := mean(a)
+	mb, vb := mean(b)
+	se := math.Sqrt(va/float64(len(a)) + vb/float64(len(b)))
+	if se == 0 {
+		return 0
+	}
+	return (ma - mb) / se
+}
+
+// lucky13 reports the timings taken by lucky13Scan and its verdict.
+type lucky13 struct {
+	CipherSuite string `json:"cipher_suite"`
+	Samples     int    `json:"samples"`
+	// Delta is the difference in median response times to records with the
+	// shortest and longest padding.
+	Delta      string  `json:"delta"`
+	T          float64 `json:"t"`
+	Result     string  `json:"result"`
+	Confidence string  `json:"confidence,omitempty"`
+}
+
+// lucky13Scan tests for a Lucky Thirteen timing oracle by sending the host
+// records under a CBC cipher suite with invalid MACs and either the shortest
+// or the longest padding, alternately, each on a new connection, and
+// comparing how long it takes to reject them. Hosts whose MAC verification
+// takes measurably longer with short padding, as it covers more data, leak
+// the padding length and are graded Bad. Hosts without CBC cipher suites
+// under TLS 1.1 or later are skipped.
+func lucky13Scan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	config := opts.tlsConfig(hostname)
+	config.CipherSuites = lucky13Ciphers
+	config.MinVersion = tls.VersionTLS11
+
+	conn, err := tls.DialWithDialer(Dialer, Network, addr, config)
+	if err != nil {
+		if strings.HasPrefix(classifyNetError(err), "alert: ") {
+			grade, err = Skipped, nil
+		}
+		return
+	}
+	conn.Close()
+	suite := conn.ConnectionState().CipherSuite
+
+	var short, long []time.Duration
+	for i := 0; i < lucky13Samples; i++ {
+		opts.progress(i, lucky13Samples)
+		var t time.Duration
+		if t, err = lucky13Time(addr, config, 0); err != nil {
+			return
+		}
+		short = append(short, t)
+		if t, err = lucky13Time(addr, config, 255); err != nil {
+			return
+		}
+		long = append(long, t)
+	}
+	opts.progress(lucky13Samples, lucky13Samples)
+
+	result := lucky13{
+		CipherSuite: tls.CipherSuites[suite].Name,
+		Samples:     lucky13Samples,
+		T:           welchT(short, long),
+	}
+	delta := median(short) - median(long)
+	result.Delta = delta.String()
+	output = &result
+
+	if delta < lucky13MinDelta || result.T < lucky13MinT {
+		grade, result.Result = Good, "not vulnerable"
+		return
+	}
+	result.Result, result.Confidence = "vulnerable", "low"
+	if result.T > lucky13HighT {
+		result.Confidence = "high"
+	}
+	return
+}
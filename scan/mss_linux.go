@@ -0,0 +1,13 @@
+package scan
+
+import "syscall"
+
+// setMSS sets the maximum segment size of the TCP socket c.
+func setMSS(c syscall.RawConn, mss int) (err error) {
+	if cerr := c.Control(func(fd uintptr) {
+		err = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_MAXSEG, mss)
+	}); cerr != nil {
+		return cerr
+	}
+	return
+}
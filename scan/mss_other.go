@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package scan
+
+import "syscall"
+
+// setMSS sets the maximum segment size of the TCP socket c.
+func setMSS(c syscall.RawConn, mss int) error {
+	return errMSSUnsupported
+}
@@ -1,12 +1,31 @@
 package scan
 
 import (
+	"bufio"
 	"bytes"
+	stdcontext "context"
+	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
+	"github.com/certifi/gocertifi"
+	ctx509 "github.com/google/certificate-transparency-go/x509"
+
 	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/log"
 	"github.com/cloudflare/cfssl/revoke"
 	"github.com/cloudflare/cfssl/scan/crypto/tls"
 )
@@ -16,16 +35,125 @@ var PKI = &Family{
 	Description: "Scans for the Public Key Infrastructure",
 	Scanners: map[string]*Scanner{
 		"ChainExpiration": {
-			"Host's chain hasn't expired and won't expire in the next 30 days",
-			chainExpiration,
+			Description: "Host's chain hasn't expired and won't expire in the next 30 days",
+			scan:        chainExpiration,
 		},
 		"ChainValidation": {
-			"All certificates in host's chain are valid",
-			chainValidation,
+			Description: "All certificates in host's chain are valid",
+			scan:        chainValidation,
 		},
 		"MultipleCerts": {
-			"Host serves same certificate chain across all IPs",
-			multipleCerts,
+			Description: "Host serves same certificate chain across all IPs",
+			scan:        multipleCerts,
+		},
+		"DualStackCerts": {
+			Description: "Host serves the same leaf certificate over IPv4 and IPv6",
+			scan:        dualStackCertsScan,
+		},
+		"LeafBasicConstraints": {
+			Description: "Host's leaf certificate is not a CA certificate",
+			scan:        leafBasicConstraints,
+		},
+		"TrustPaths": {
+			Description: "Host's chain reaches a trusted root through at least one sound path",
+			scan:        trustPathsScan,
+		},
+		"SPKIPins": {
+			Description: "Host's chain contains a certificate matching one of the expected SPKI pins",
+			scan:        spkiPinsScan,
+		},
+		"OfflineRevocation": {
+			Description: "Host's leaf certificate isn't in the supplied revocation set",
+			scan:        offlineRevocationScan,
+		},
+		"ChainOrder": {
+			Description: "Host sends its chain leaf-first, in order, without duplicates or the root",
+			scan:        chainOrderScan,
+		},
+		"ExpiryRiskWindow": {
+			Description: "Host's chain doesn't expire soon on or just after a weekend or holiday",
+			scan:        expiryRiskWindowScan,
+		},
+		"ChainLinkExpiry": {
+			Description: "No certificate above the leaf in host's trust path expires in the next 90 days",
+			scan:        chainLinkExpiryScan,
+		},
+		"DefaultCert": {
+			Description: "Host doesn't serve a default or snakeoil certificate left in place by its software",
+			scan:        defaultCertScan,
+		},
+		"RootTrust": {
+			Description: "Host's chain ends in a publicly trusted root rather than a private CA",
+			scan:        rootTrustScan,
+		},
+		"ClientProfiles": {
+			Description: "Host's chain validates under the chain building strategies of major clients",
+			scan:        clientProfilesScan,
+		},
+		"SANTypes": {
+			Description: "Host's leaf certificate names it in a dNSName SAN, without deprecated SAN types",
+			scan:        sanTypesScan,
+		},
+		"WWWApex": {
+			Description: "Host's leaf certificate covers both the apex domain and its www subdomain",
+			scan:        wwwApexScan,
+		},
+		"CertificatePolicies": {
+			Description: "Host's leaf certificate asserts the required certificate policy",
+			scan:        certificatePoliciesScan,
+		},
+		"ValidityNesting": {
+			Description: "Each certificate in host's chain is valid only within its issuer's validity period",
+			scan:        validityNestingScan,
+		},
+		"SharedCert": {
+			Description: "Host's leaf certificate isn't shared with many unrelated domains",
+			scan:        sharedCertScan,
+		},
+		"Interception": {
+			Description: "Connection to host isn't intercepted by a TLS inspecting proxy",
+			scan:        interceptionScan,
+		},
+		"CTIssuance": {
+			Description: "No certificates recently logged in CT for host other than the one it serves",
+			scan:        ctIssuanceScan,
+		},
+		"RecentIssuance": {
+			Description: "Host's leaf certificate wasn't issued very recently",
+			scan:        recentIssuanceScan,
+		},
+		"CAAIssuer": {
+			Description: "Host's CAA records authorize the CA that issued its leaf certificate",
+			scan:        caaIssuerScan,
+		},
+		"Backdating": {
+			Description: "Host's leaf certificate isn't backdated well before it was logged in CT",
+			scan:        backdatingScan,
+		},
+		"ChromeCTPolicy": {
+			Description: "Host's SCTs satisfy Chrome's Certificate Transparency policy",
+			scan:        chromeCTPolicyScan,
+		},
+		"SCTSignatures": {
+			Description: "Host's SCTs carry valid signatures from known CT logs",
+			scan:        sctSignaturesScan,
+		},
+		"ChainPEM": {
+			Description: "Captures host's chain as served, as a PEM bundle",
+			scan:        chainPEMScan,
+			Summarize:   summarizeChainPEM,
+		},
+		"TrustedLogSCTs": {
+			Description: "Host's leaf certificate embeds SCTs from CT logs still trusted",
+			scan:        trustedLogSCTsScan,
+		},
+		"RedundantChainCerts": {
+			Description: "Host's chain only includes certificates needed to reach a trusted root",
+			scan:        redundantChainCertsScan,
+		},
+		"ClockSkew": {
+			Description: "Local clock agrees with the host's, so certificate validity is judged correctly",
+			scan:        clockSkewScan,
 		},
 	},
 }
@@ -43,21 +171,35 @@ func getChain(addr string, config *tls.Config) (chain []*x509.Certificate, err e
 		return
 	}
 
-	chain = conn.ConnectionState().PeerCertificates
-	if len(chain) == 0 {
-		err = fmt.Errorf("%s returned empty certificate chain", addr)
+	state := conn.ConnectionState()
+	if _, err = leafCert(state); err != nil {
+		err = fmt.Errorf("%s: %v", addr, err)
+		return
 	}
+	chain = state.PeerCertificates
 	return
 }
 
+// errNoLeaf is returned by leafCert for handshakes without a certificate.
+var errNoLeaf = errors.New("host presented no certificate")
+
+// leafCert returns the host's leaf certificate from the state of a completed
+// handshake, or errNoLeaf if the host presented none.
+func leafCert(state tls.ConnectionState) (*x509.Certificate, error) {
+	if len(state.PeerCertificates) == 0 {
+		return nil, errNoLeaf
+	}
+	return state.PeerCertificates[0], nil
+}
+
 type expiration time.Time
 
 func (e expiration) String() string {
 	return time.Time(e).Format("Jan 2 15:04:05 2006 MST")
 }
 
-func chainExpiration(addr, hostname string) (grade Grade, output Output, err error) {
-	chain, err := getChain(addr, defaultTLSConfig(hostname))
+func chainExpiration(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	chain, err := getChain(addr, opts.tlsConfig(hostname))
 	if err != nil {
 		return
 	}
@@ -79,8 +221,66 @@ func chainExpiration(addr, hostname string) (grade Grade, output Output, err err
 	return
 }
 
-func chainValidation(addr, hostname string) (grade Grade, output Output, err error) {
-	chain, err := getChain(addr, defaultTLSConfig(hostname))
+// expiryRiskWindow is how soon a chain expiring on a risky day must expire
+// for expiryRiskWindowScan to warn.
+var expiryRiskWindow = 14 * 24 * time.Hour
+
+// expiryRisk describes when the host's chain expires.
+type expiryRisk struct {
+	Expiry   time.Time `json:"expiry"`
+	Weekday  string    `json:"weekday"`
+	DaysLeft int       `json:"days_left"`
+	// Risky is whether the expiry falls on or the day after a weekend or
+	// holiday, when renewals are likely to be missed.
+	Risky bool `json:"risky"`
+}
+
+// riskyDay reports whether t falls on a weekend or one of holidays, in local time.
+func riskyDay(t time.Time, holidays []time.Time) bool {
+	if t.Weekday() == time.Saturday || t.Weekday() == time.Sunday {
+		return true
+	}
+	year, month, day := t.Date()
+	for _, holiday := range holidays {
+		if y, m, d := holiday.In(time.Local).Date(); y == year && m == month && d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// expiryRiskWindowScan reports when the first certificate in the host's chain
+// expires, in local time, and whether that falls on or the day after a
+// weekend or one of opts.Holidays. Chains expiring on such a day within
+// expiryRiskWindow are warned of, and expired chains are graded Bad.
+func expiryRiskWindowScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	chain, err := getChain(addr, opts.tlsConfig(hostname))
+	if err != nil {
+		return
+	}
+
+	expiry := helpers.ExpiryTime(chain).In(time.Local)
+	left := time.Until(expiry)
+	result := expiryRisk{
+		Expiry:   expiry,
+		Weekday:  expiry.Weekday().String(),
+		DaysLeft: int(left / (24 * time.Hour)),
+		Risky:    riskyDay(expiry, opts.Holidays) || riskyDay(expiry.AddDate(0, 0, -1), opts.Holidays),
+	}
+	output = result
+
+	switch {
+	case left < 0:
+	case result.Risky && left < expiryRiskWindow:
+		grade = Warning
+	default:
+		grade = Good
+	}
+	return
+}
+
+func chainValidation(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	chain, err := getChain(addr, opts.tlsConfig(hostname))
 	if err != nil {
 		return
 	}
@@ -135,15 +335,15 @@ func chainValidation(addr, hostname string) (grade Grade, output Output, err err
 	return
 }
 
-func multipleCerts(addr, hostname string) (grade Grade, output Output, err error) {
-	config := defaultTLSConfig(hostname)
+func multipleCerts(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	config := opts.tlsConfig(hostname)
 
 	firstChain, err := getChain(addr, config)
 	if err != nil {
 		return
 	}
 
-	grade, _, err = multiscan(addr, func(addrport string) (g Grade, o Output, e error) {
+	grade, _, err = multiscan(addr, opts, func(addrport string) (g Grade, o Output, e error) {
 		g = Good
 		chain, e1 := getChain(addrport, config)
 		if e1 != nil {
@@ -159,3 +359,1638 @@ func multipleCerts(addr, hostname string) (grade Grade, output Output, err error
 	})
 	return
 }
+
+// dualStackCerts reports the leaf fingerprints each address family serves.
+type dualStackCerts struct {
+	IPv4      map[string]string `json:"ipv4"`
+	IPv6      map[string]string `json:"ipv6"`
+	Identical bool              `json:"identical"`
+}
+
+// dualStackCertsScan compares the SHA-256 fingerprint of the leaf served on
+// the host's first IPv4 and IPv6 addresses. Hosts lacking either address
+// family are skipped.
+func dualStackCertsScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return
+	}
+	ips, err := net.LookupIP(hostname)
+	if err != nil {
+		return
+	}
+
+	var ipv4, ipv6 net.IP
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			if ipv4 == nil {
+				ipv4 = ip
+			}
+		} else if ipv6 == nil {
+			ipv6 = ip
+		}
+	}
+	if ipv4 == nil || ipv6 == nil {
+		grade = Skipped
+		return
+	}
+
+	fingerprint := func(ip net.IP) (string, error) {
+		chain, err := getChain(net.JoinHostPort(ip.String(), port), opts.tlsConfig(hostname))
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%x", sha256.Sum256(chain[0].Raw)), nil
+	}
+
+	fp4, err := fingerprint(ipv4)
+	if err != nil {
+		return
+	}
+	fp6, err := fingerprint(ipv6)
+	if err != nil {
+		return
+	}
+
+	output = dualStackCerts{
+		IPv4:      map[string]string{ipv4.String(): fp4},
+		IPv6:      map[string]string{ipv6.String(): fp6},
+		Identical: fp4 == fp6,
+	}
+	if fp4 == fp6 {
+		grade = Good
+	} else {
+		grade = Warning
+	}
+	return
+}
+
+// basicConstraints reports the Basic Constraints asserted by a certificate.
+type basicConstraints struct {
+	IsCA       bool `json:"is_ca"`
+	MaxPathLen *int `json:"max_path_len,omitempty"`
+}
+
+// leafBasicConstraints flags a leaf certificate that has the CA bit set.
+func leafBasicConstraints(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	chain, err := getChain(addr, opts.tlsConfig(hostname))
+	if err != nil {
+		return
+	}
+
+	leaf := chain[0]
+	bc := basicConstraints{IsCA: leaf.BasicConstraintsValid && leaf.IsCA}
+	if leaf.MaxPathLen > 0 || leaf.MaxPathLenZero {
+		maxPathLen := leaf.MaxPathLen
+		bc.MaxPathLen = &maxPathLen
+	}
+	output = bc
+
+	if bc.IsCA {
+		return
+	}
+
+	grade = Good
+	return
+}
+
+var (
+	// aiaFetchLimit bounds the number of AIA caIssuers URLs fetched per scan.
+	aiaFetchLimit = 8
+	// maxAIAResponseSize bounds the size of a certificate fetched through AIA.
+	maxAIAResponseSize int64 = 1 << 20
+	// rootExpiryWindow is how close to expiry a root must be to be considered soon-to-expire.
+	rootExpiryWindow = 180 * 24 * time.Hour
+)
+
+// fetchCertificates retrieves the DER or PEM encoded certificates served at the given URL.
+func fetchCertificates(url string) ([]*x509.Certificate, error) {
+	resp, err := Client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("fetching %s returned HTTP status %d", url, resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxAIAResponseSize))
+	if err != nil {
+		return nil, err
+	}
+
+	certs, _, err := helpers.ParseCertificatesDER(body, "")
+	if err != nil {
+		return helpers.ParseCertificatesPEM(body)
+	}
+	return certs, nil
+}
+
+// fetchAIAIssuers follows the AIA caIssuers URLs of the given certificates,
+// and in turn those of the issuers it finds, returning every issuer fetched.
+func fetchAIAIssuers(certs []*x509.Certificate) (issuers []*x509.Certificate) {
+	fetched := make(map[string]bool)
+	queue := append([]*x509.Certificate(nil), certs...)
+	for len(queue) > 0 && len(fetched) < aiaFetchLimit {
+		cert := queue[0]
+		queue = queue[1:]
+		for _, url := range cert.IssuingCertificateURL {
+			if fetched[url] || len(fetched) >= aiaFetchLimit {
+				continue
+			}
+			fetched[url] = true
+
+			certs, err := fetchCertificates(url)
+			if err != nil {
+				log.Debugf("couldn't fetch AIA issuer %s: %v", url, err)
+				continue
+			}
+			issuers = append(issuers, certs...)
+			queue = append(queue, certs...)
+		}
+	}
+	return
+}
+
+// buildChains returns every chain from the leaf of the given chain to a
+// trusted root, using the rest of the chain and any AIA-fetched issuers as intermediates.
+func buildChains(chain []*x509.Certificate) ([][]*x509.Certificate, error) {
+	return buildChainsWithRoots(chain, RootCAs)
+}
+
+// buildChainsWithRoots is like buildChains, but verifies against the given
+// roots, or the system roots if nil.
+func buildChainsWithRoots(chain []*x509.Certificate, roots *x509.CertPool) ([][]*x509.Certificate, error) {
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	for _, cert := range fetchAIAIssuers(chain) {
+		intermediates.AddCert(cert)
+	}
+
+	return chain[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+}
+
+// legacyRoot reports whether a root is soon to expire or uses weak cryptography.
+func legacyRoot(root *x509.Certificate) bool {
+	if time.Now().Add(rootExpiryWindow).After(root.NotAfter) {
+		return true
+	}
+
+	switch root.SignatureAlgorithm {
+	case x509.MD2WithRSA, x509.MD5WithRSA, x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1:
+		return true
+	}
+
+	if _, ok := root.PublicKey.(*rsa.PublicKey); ok && helpers.KeyLength(root.PublicKey) < 2048 {
+		return true
+	}
+	return false
+}
+
+// trustPath describes one chain from the host's leaf to a trusted root.
+type trustPath struct {
+	Root   string `json:"root"`
+	Length int    `json:"length"`
+	Legacy bool   `json:"legacy,omitempty"`
+}
+
+// trustPaths lists the distinct trust paths found for the host's chain.
+type trustPaths struct {
+	Count int         `json:"count"`
+	Paths []trustPath `json:"paths"`
+}
+
+// trustPathsScan enumerates the distinct paths from the host's leaf to trusted
+// roots, as cross-signed intermediates may lead to more than one.
+func trustPathsScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	chain, err := getChain(addr, opts.tlsConfig(hostname))
+	if err != nil {
+		return
+	}
+
+	chains, err := buildChains(chain)
+	if err != nil {
+		return
+	}
+
+	paths := trustPaths{Count: len(chains)}
+	for _, c := range chains {
+		root := c[len(c)-1]
+		paths.Paths = append(paths.Paths, trustPath{
+			Root:   root.Subject.CommonName,
+			Length: len(c),
+			Legacy: legacyRoot(root),
+		})
+	}
+	output = paths
+
+	if len(paths.Paths) == 1 && paths.Paths[0].Legacy {
+		grade = Warning
+		return
+	}
+
+	grade = Good
+	return
+}
+
+// spkiPin returns the base64-encoded SHA-256 hash of the certificate's SubjectPublicKeyInfo.
+func spkiPin(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// pinMatch describes a certificate in the host's chain that matched an SPKI pin.
+type pinMatch struct {
+	Position int    `json:"position"`
+	Subject  string `json:"subject"`
+	Pin      string `json:"pin"`
+}
+
+// spkiPinsScan tests that at least one certificate in the host's chain, leaf or
+// intermediate, matches one of the expected SPKI pins.
+func spkiPinsScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	if len(opts.SPKIPins) == 0 {
+		grade = Skipped
+		return
+	}
+
+	chain, err := getChain(addr, opts.tlsConfig(hostname))
+	if err != nil {
+		return
+	}
+
+	pins := make(map[string]bool, len(opts.SPKIPins))
+	for _, pin := range opts.SPKIPins {
+		pins[pin] = true
+	}
+
+	var matches []pinMatch
+	for i, cert := range chain {
+		if pin := spkiPin(cert); pins[pin] {
+			matches = append(matches, pinMatch{i, cert.Subject.CommonName, pin})
+		}
+	}
+
+	if len(matches) == 0 {
+		err = errors.New("no certificate in chain matches an expected SPKI pin")
+		return
+	}
+
+	grade, output = Good, matches
+	return
+}
+
+// revocationStatus reports whether a certificate was found in a revocation set.
+type revocationStatus struct {
+	Serial  string `json:"serial"`
+	Revoked bool   `json:"revoked"`
+}
+
+// offlineRevocationScan checks the host's leaf against the revocation set
+// supplied in opts, without any OCSP or CRL requests.
+func offlineRevocationScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	if opts.RevokedSerials == nil {
+		grade = Skipped
+		return
+	}
+
+	chain, err := getChain(addr, opts.tlsConfig(hostname))
+	if err != nil {
+		return
+	}
+
+	status := revocationStatus{
+		Serial:  chain[0].SerialNumber.Text(16),
+		Revoked: opts.RevokedSerials.Revoked(chain[0]),
+	}
+	output = status
+
+	if status.Revoked {
+		return
+	}
+
+	grade = Good
+	return
+}
+
+// isSelfSigned reports whether the certificate is self-signed, as roots are.
+// The signature is checked directly, since CheckSignatureFrom rejects leaves
+// that aren't CAs.
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawSubject, cert.RawIssuer) && cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
+
+// chainPosition describes a certificate as positioned in the host's chain.
+type chainPosition struct {
+	Position int      `json:"position"`
+	Subject  string   `json:"subject"`
+	Issues   []string `json:"issues,omitempty"`
+}
+
+// chainOrderScan tests that each certificate in the host's chain certifies the
+// one before it, and that the chain contains neither duplicates nor the root.
+func chainOrderScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	chain, err := getChain(addr, opts.tlsConfig(hostname))
+	if err != nil {
+		return
+	}
+
+	grade = Good
+	positions := make([]chainPosition, len(chain))
+	for i, cert := range chain {
+		positions[i] = chainPosition{Position: i, Subject: cert.Subject.CommonName}
+
+		for j := 0; j < i; j++ {
+			if cert.Equal(chain[j]) {
+				positions[i].Issues = append(positions[i].Issues, fmt.Sprintf("duplicate of position %d", j))
+				break
+			}
+		}
+
+		if isSelfSigned(cert) {
+			if i > 0 {
+				positions[i].Issues = append(positions[i].Issues, "root certificate is unnecessary")
+			}
+		} else if i+1 < len(chain) && cert.CheckSignatureFrom(chain[i+1]) != nil {
+			positions[i].Issues = append(positions[i].Issues, "not issued by the next certificate")
+		}
+
+		if len(positions[i].Issues) > 0 {
+			grade = Warning
+		}
+	}
+
+	output = positions
+	return
+}
+
+// MaxRedundantCerts is the number of unneeded certificates in the host's
+// chain above which redundantChainCertsScan warns.
+var MaxRedundantCerts = 0
+
+// chainMember describes whether a certificate sent by the host is needed to
+// reach a trusted root, and its size in the Certificate message.
+type chainMember struct {
+	Position  int    `json:"position"`
+	Subject   string `json:"subject"`
+	Necessary bool   `json:"necessary"`
+	Size      int    `json:"size"`
+}
+
+// redundantChainCerts lists the certificates sent by the host, along with the
+// size of its Certificate message and how much trimming them would save.
+type redundantChainCerts struct {
+	Certificates   []chainMember `json:"certificates"`
+	CertificateMsg int           `json:"certificate_message"`
+	Savings        int           `json:"savings"`
+}
+
+// redundantChainCertsScan finds which certificates in the host's chain a
+// client needs to reach a trusted root, choosing, among the trust paths built
+// from the chain alone, the one needing the fewest bytes. Any others, such as
+// cross-signed intermediates modern clients don't need or the root itself,
+// only bloat the handshake; the scan reports the bytes trimming them would
+// save from the Certificate message. It is informational, warning if there are
+// more than MaxRedundantCerts of them. Chains that don't verify on their own
+// are skipped.
+func redundantChainCertsScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	chain, err := getChain(addr, opts.tlsConfig(hostname))
+	if err != nil {
+		return
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	chains, verr := chain[0].Verify(x509.VerifyOptions{Roots: RootCAs, Intermediates: intermediates})
+	if verr != nil {
+		grade = Skipped
+		return
+	}
+
+	// A certificate entry has a 3 byte length.
+	size := func(cert *x509.Certificate) int { return 3 + len(cert.Raw) }
+	var necessary map[int]bool
+	best := -1
+	for _, path := range chains {
+		used, cost := map[int]bool{0: true}, 0
+		// The path's root is a trust anchor clients already have, and a path
+		// of the leaf alone, trusted itself, needs nothing more.
+		var links []*x509.Certificate
+		if len(path) >= 2 {
+			links = path[1 : len(path)-1]
+		}
+		for _, cert := range links {
+			for i, sent := range chain {
+				if i > 0 && cert.Equal(sent) {
+					used[i] = true
+					cost += size(sent)
+					break
+				}
+			}
+		}
+		if best < 0 || cost < best {
+			necessary, best = used, cost
+		}
+	}
+
+	// A Certificate message has a 4 byte header and a 3 byte list length.
+	result := redundantChainCerts{CertificateMsg: 4 + 3}
+	redundant := 0
+	for i, cert := range chain {
+		member := chainMember{Position: i, Subject: cert.Subject.CommonName, Necessary: necessary[i], Size: size(cert)}
+		result.Certificates = append(result.Certificates, member)
+		result.CertificateMsg += member.Size
+		if !member.Necessary {
+			result.Savings += member.Size
+			redundant++
+		}
+	}
+	output = result
+
+	if redundant > MaxRedundantCerts {
+		grade = Warning
+	} else {
+		grade = Good
+	}
+	return
+}
+
+// chainLinkExpiryWindow is how soon a certificate above the leaf must expire
+// for chainLinkExpiryScan to warn.
+var chainLinkExpiryWindow = 90 * 24 * time.Hour
+
+// chainLink describes a certificate in the host's trust path.
+type chainLink struct {
+	Subject  string    `json:"subject"`
+	NotAfter time.Time `json:"not_after"`
+}
+
+// chainLinks lists the certificates of the host's trust path, from the leaf
+// to the root, along with the position of the earliest to expire.
+type chainLinks struct {
+	Links   []chainLink `json:"links"`
+	Binding int         `json:"binding"`
+}
+
+// chainLinkExpiryScan builds the host's trust paths, reporting the expiry of
+// each certificate in the one that stays valid longest, which clients with
+// its root use. The path is only as valid as its earliest expiring link, and
+// hosts whose intermediates or root expire within chainLinkExpiryWindow are
+// warned of, however fresh the leaf.
+func chainLinkExpiryScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	chain, err := getChain(addr, opts.tlsConfig(hostname))
+	if err != nil {
+		return
+	}
+	chains, err := buildChains(chain)
+	if err != nil {
+		return
+	}
+
+	var best []*x509.Certificate
+	for _, c := range chains {
+		if best == nil || helpers.ExpiryTime(c).After(helpers.ExpiryTime(best)) {
+			best = c
+		}
+	}
+
+	result := chainLinks{Links: make([]chainLink, len(best))}
+	for i, cert := range best {
+		result.Links[i] = chainLink{cert.Subject.CommonName, cert.NotAfter}
+		if cert.NotAfter.Before(best[result.Binding].NotAfter) {
+			result.Binding = i
+		}
+	}
+	output = result
+
+	grade = Good
+	for _, link := range result.Links[1:] {
+		if time.Now().Add(chainLinkExpiryWindow).After(link.NotAfter) {
+			grade = Warning
+		}
+	}
+	return
+}
+
+// rootTrust reports the root the host's chain terminates in and whether it's
+// publicly trusted.
+type rootTrust struct {
+	Root string `json:"root"`
+	// Trust is "public" for roots in Mozilla's root store, and "private" otherwise.
+	Trust string `json:"trust"`
+}
+
+// rootTrustScan classifies the root of the host's chain as public, in
+// Mozilla's root store, or private. Private roots are the root of a chain
+// built with the configured roots, or failing that the last certificate the
+// host sent. Hosts with any public address using a private root, which
+// clients will reject, are warned of.
+func rootTrustScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	chain, err := getChain(addr, opts.tlsConfig(hostname))
+	if err != nil {
+		return
+	}
+	publicRoots, err := gocertifi.CACerts()
+	if err != nil {
+		return
+	}
+
+	if chains, perr := buildChainsWithRoots(chain, publicRoots); perr == nil {
+		path := chains[0]
+		grade, output = Good, rootTrust{path[len(path)-1].Subject.CommonName, "public"}
+		return
+	}
+
+	root := chain[len(chain)-1]
+	if chains, verr := buildChains(chain); verr == nil {
+		root = chains[0][len(chains[0])-1]
+	}
+	output = rootTrust{root.Subject.CommonName, "private"}
+
+	// addr is usually a hostname, so the host's addresses come from DNS.
+	ips, err := opts.hostIPs(hostname)
+	if err != nil {
+		return
+	}
+
+	grade = Good
+	for _, ip := range ips {
+		if !internalIP(ip) {
+			grade = Warning
+		}
+	}
+	return
+}
+
+// A DefaultCert identifies a certificate generated or shipped by default by
+// server software or appliances, by whether a leaf matches it.
+type DefaultCert struct {
+	Name  string
+	Match func(leaf *x509.Certificate) bool
+}
+
+// hasOrganization reports whether any organization of name is org.
+func hasOrganization(name pkix.Name, org string) bool {
+	for _, o := range name.Organization {
+		if o == org {
+			return true
+		}
+	}
+	return false
+}
+
+// makeSSLCert reports whether leaf was generated by Debian and Ubuntu's
+// make-ssl-cert: a self-signed certificate, valid for 3650 days, naming only
+// the machine it ran on in its common name and at most a matching SAN, with
+// basic constraints but no key usages.
+func makeSSLCert(leaf *x509.Certificate) bool {
+	cn := leaf.Subject.CommonName
+	if !isSelfSigned(leaf) || cn == "" || len(leaf.Subject.Names) != 1 {
+		return false
+	}
+	if leaf.NotAfter.Sub(leaf.NotBefore) != 3650*24*time.Hour {
+		return false
+	}
+	if !leaf.BasicConstraintsValid || leaf.IsCA || leaf.KeyUsage != 0 || len(leaf.ExtKeyUsage) > 0 {
+		return false
+	}
+	if len(leaf.IPAddresses) > 0 || len(leaf.EmailAddresses) > 0 {
+		return false
+	}
+	return len(leaf.DNSNames) == 0 || (len(leaf.DNSNames) == 1 && leaf.DNSNames[0] == cn)
+}
+
+// DefaultCerts are the default certificates the DefaultCert scanner looks for,
+// in order, to which more may be added.
+var DefaultCerts = []DefaultCert{
+	{"localhost", func(leaf *x509.Certificate) bool {
+		cn := strings.ToLower(leaf.Subject.CommonName)
+		return isSelfSigned(leaf) && (cn == "localhost" || cn == "localhost.localdomain")
+	}},
+	{"Debian/Ubuntu snakeoil", makeSSLCert},
+	{"Red Hat mod_ssl", func(leaf *x509.Certificate) bool {
+		return hasOrganization(leaf.Issuer, "SomeOrganization") || hasOrganization(leaf.Issuer, "Default Company Ltd")
+	}},
+	{"OpenSSL defaults", func(leaf *x509.Certificate) bool {
+		return hasOrganization(leaf.Issuer, "Internet Widgits Pty Ltd")
+	}},
+	{"Kubernetes ingress-nginx", func(leaf *x509.Certificate) bool {
+		return leaf.Subject.CommonName == "Kubernetes Ingress Controller Fake Certificate"
+	}},
+	{"Go generate_cert", func(leaf *x509.Certificate) bool {
+		return hasOrganization(leaf.Issuer, "Acme Co")
+	}},
+	{"Traefik", func(leaf *x509.Certificate) bool {
+		return leaf.Subject.CommonName == "TRAEFIK DEFAULT CERT"
+	}},
+	{"Plesk", func(leaf *x509.Certificate) bool {
+		return hasOrganization(leaf.Issuer, "Plesk") || hasOrganization(leaf.Issuer, "Parallels")
+	}},
+	{"FortiGate", func(leaf *x509.Certificate) bool {
+		return hasOrganization(leaf.Issuer, "Fortinet") && isSelfSigned(leaf)
+	}},
+}
+
+// defaultCertScan matches the host's leaf certificate against DefaultCerts,
+// reporting the name of the default certificate it is, if any. Hosts serving
+// one are graded Bad, or only warned of if all their addresses are private.
+func defaultCertScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	chain, err := getChain(addr, opts.tlsConfig(hostname))
+	if err != nil {
+		return
+	}
+
+	for _, cert := range DefaultCerts {
+		if !cert.Match(chain[0]) {
+			continue
+		}
+		output = cert.Name
+		// addr is usually a hostname, so the host's addresses come from DNS.
+		ips, lerr := opts.hostIPs(hostname)
+		if lerr != nil || len(ips) == 0 {
+			return
+		}
+		grade = Warning
+		for _, ip := range ips {
+			if !internalIP(ip) {
+				grade = Bad
+			}
+		}
+		return
+	}
+	grade = Good
+	return
+}
+
+// clientProfiles are the chain building strategies of major clients, by name,
+// each verifying the leaf of the served chain against the given roots.
+var clientProfiles = []struct {
+	name   string
+	verify func(chain []*x509.Certificate, roots *x509.CertPool) error
+}{
+	// Clients such as older OpenSSL take the served chain literally, using
+	// intermediates only as far as each certifies the one before it.
+	{"strict-order", func(chain []*x509.Certificate, roots *x509.CertPool) error {
+		n := 1
+		for n < len(chain) && chain[n-1].CheckSignatureFrom(chain[n]) == nil {
+			n++
+		}
+		return verifyWithIntermediates(chain[0], chain[1:n], roots)
+	}},
+	// Mobile clients, Firefox, and most libraries build paths from the served
+	// certificates in any order, but don't fetch missing intermediates.
+	{"no-aia", func(chain []*x509.Certificate, roots *x509.CertPool) error {
+		return verifyWithIntermediates(chain[0], chain[1:], roots)
+	}},
+	// Desktop Chrome, Safari, and Windows fetch missing intermediates through AIA.
+	{"aia-fetching", func(chain []*x509.Certificate, roots *x509.CertPool) error {
+		_, err := buildChainsWithRoots(chain, roots)
+		return err
+	}},
+}
+
+// verifyWithIntermediates verifies leaf against roots, or the system roots if
+// nil, using only the given intermediates.
+func verifyWithIntermediates(leaf *x509.Certificate, intermediates []*x509.Certificate, roots *x509.CertPool) error {
+	pool := x509.NewCertPool()
+	for _, cert := range intermediates {
+		pool.AddCert(cert)
+	}
+	_, err := leaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: pool})
+	return err
+}
+
+// clientProfilesScan verifies the host's chain as served under each of
+// clientProfiles, reporting which would accept it. Chains accepted by some
+// clients but not others, such as those missing an intermediate, or by none
+// are graded Warning.
+func clientProfilesScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	chain, err := getChain(addr, opts.tlsConfig(hostname))
+	if err != nil {
+		return
+	}
+
+	verdicts := make(map[string]string, len(clientProfiles))
+	failed := 0
+	for _, profile := range clientProfiles {
+		if verr := profile.verify(chain, RootCAs); verr != nil {
+			verdicts[profile.name] = verr.Error()
+			failed++
+		} else {
+			verdicts[profile.name] = "ok"
+		}
+	}
+	output = verdicts
+
+	if failed > 0 {
+		grade = Warning
+		return
+	}
+	grade = Good
+	return
+}
+
+// sanTypes lists the SANs of the host's leaf certificate by type.
+type sanTypes struct {
+	DNSName bool                `json:"dns_name"`
+	Covered bool                `json:"covered"`
+	Entries map[string][]string `json:"entries,omitempty"`
+}
+
+// sanTypesScan lists the SANs of the host's leaf certificate by type. Since
+// current clients ignore the subject common name, leaves whose SANs don't
+// cover the host, or that have none at all, are graded Bad. Leaves with email
+// or URI SANs, which have no place in a TLS server certificate, are warned of.
+func sanTypesScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	chain, err := getChain(addr, opts.tlsConfig(hostname))
+	if err != nil {
+		return
+	}
+	leaf := chain[0]
+
+	result := sanTypes{
+		DNSName: len(leaf.DNSNames) > 0,
+		Covered: leaf.VerifyHostname(hostname) == nil,
+		Entries: make(map[string][]string),
+	}
+	if result.DNSName {
+		result.Entries["dns"] = leaf.DNSNames
+	}
+	for _, ip := range leaf.IPAddresses {
+		result.Entries["ip"] = append(result.Entries["ip"], ip.String())
+	}
+	if len(leaf.EmailAddresses) > 0 {
+		result.Entries["email"] = leaf.EmailAddresses
+	}
+	for _, uri := range leaf.URIs {
+		result.Entries["uri"] = append(result.Entries["uri"], uri.String())
+	}
+	output = result
+
+	switch {
+	case !result.Covered:
+	case len(leaf.EmailAddresses) > 0 || len(leaf.URIs) > 0:
+		grade = Warning
+	default:
+		grade = Good
+	}
+	return
+}
+
+// wwwApexScan checks whether the host's leaf certificate covers both the
+// apex domain, the host's name without any "www." prefix, and its www
+// subdomain, along with each of opts.Subdomains under the apex, reporting
+// whether each name is covered. Leaves not covering both the apex and www are
+// warned of. Hosts named by IP address are skipped.
+func wwwApexScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	if net.ParseIP(hostname) != nil {
+		grade = Skipped
+		return
+	}
+	chain, err := getChain(addr, opts.tlsConfig(hostname))
+	if err != nil {
+		return
+	}
+	leaf := chain[0]
+
+	apex := strings.TrimPrefix(strings.TrimSuffix(strings.ToLower(hostname), "."), "www.")
+	names := []string{apex, "www." + apex}
+	for _, label := range opts.Subdomains {
+		names = append(names, label+"."+apex)
+	}
+	covered := make(map[string]bool)
+	for _, name := range names {
+		covered[name] = leaf.VerifyHostname(name) == nil
+	}
+	output = covered
+
+	if covered[names[0]] && covered[names[1]] {
+		grade = Good
+	} else {
+		grade = Warning
+	}
+	return
+}
+
+// clockSkewThreshold is the difference between the local clock and the
+// host's above which clockSkewScan warns.
+var clockSkewThreshold = 5 * time.Minute
+
+// serverDateTimeout bounds how long serverDate waits on the host.
+var serverDateTimeout = 10 * time.Second
+
+// serverDate returns the time reported in the Date header of the host's
+// HTTPS response, along with the local time midway through the request.
+func serverDate(addr, hostname string, opts *Options) (date, local time.Time, err error) {
+	conn, err := tls.DialWithDialer(Dialer, Network, addr, opts.tlsConfig(hostname))
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(serverDateTimeout))
+
+	start := time.Now()
+	if _, err = fmt.Fprintf(conn, "HEAD / HTTP/1.1\r\nHost: %s\r\nConnection: close\r\n\r\n", hostname); err != nil {
+		return
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+	local = start.Add(time.Since(start) / 2)
+
+	if date, err = http.ParseTime(resp.Header.Get("Date")); err != nil {
+		err = errors.New("host's response has no valid Date header")
+	}
+	return
+}
+
+// validityError returns an error describing the first certificate in chain
+// that isn't valid at t, or nil if all are.
+func validityError(chain []*x509.Certificate, t time.Time) error {
+	for _, cert := range chain {
+		if t.Before(cert.NotBefore) {
+			return fmt.Errorf("%s is not valid until %s", cert.Subject.CommonName, expiration(cert.NotBefore))
+		}
+		if t.After(cert.NotAfter) {
+			return fmt.Errorf("%s expired on %s", cert.Subject.CommonName, expiration(cert.NotAfter))
+		}
+	}
+	return nil
+}
+
+// clockSkew describes the difference between the local clock and the host's.
+type clockSkew struct {
+	SkewSeconds     int64  `json:"skew_seconds"`
+	ValidityFailure string `json:"validity_failure,omitempty"`
+	SkewRelated     bool   `json:"skew_related"`
+}
+
+// clockSkewScan estimates the skew between the local clock and the host's
+// from the Date header of an HTTPS response. If the host's chain isn't valid
+// according to the local clock, it also reports whether the chain would be
+// valid according to the host's, in which case the failure is due to skew.
+func clockSkewScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	chain, err := getChain(addr, opts.tlsConfig(hostname))
+	if err != nil {
+		return
+	}
+
+	date, local, err := serverDate(addr, hostname, opts)
+	if err != nil {
+		return
+	}
+
+	skew := date.Sub(local)
+	result := clockSkew{SkewSeconds: int64(skew / time.Second)}
+	if verr := validityError(chain, local); verr != nil {
+		result.ValidityFailure = verr.Error()
+		result.SkewRelated = validityError(chain, date) == nil
+	}
+	output = result
+
+	if skew > clockSkewThreshold || -skew > clockSkewThreshold {
+		grade = Warning
+	} else {
+		grade = Good
+	}
+	return
+}
+
+// certificatePoliciesScan reports the certificate policy OIDs asserted by the
+// host's leaf, grading Bad if the RequiredPolicyOID option isn't among them.
+func certificatePoliciesScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	chain, err := getChain(addr, opts.tlsConfig(hostname))
+	if err != nil {
+		return
+	}
+
+	policies := []string{}
+	required := opts.RequiredPolicyOID == ""
+	for _, oid := range chain[0].PolicyIdentifiers {
+		policies = append(policies, oid.String())
+		if oid.String() == opts.RequiredPolicyOID {
+			required = true
+		}
+	}
+	output = policies
+
+	if !required {
+		err = fmt.Errorf("leaf doesn't assert certificate policy %s", opts.RequiredPolicyOID)
+		return
+	}
+	grade = Good
+	return
+}
+
+// validityLink describes the validity period of a certificate in the host's chain.
+type validityLink struct {
+	Subject   string    `json:"subject"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+	Issues    []string  `json:"issues,omitempty"`
+}
+
+// validityNestingScan tests that the validity period of each certificate in the
+// host's chain lies within that of the next certificate, its issuer.
+func validityNestingScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	chain, err := getChain(addr, opts.tlsConfig(hostname))
+	if err != nil {
+		return
+	}
+
+	grade = Good
+	links := make([]validityLink, len(chain))
+	for i, cert := range chain {
+		links[i] = validityLink{Subject: cert.Subject.CommonName, NotBefore: cert.NotBefore, NotAfter: cert.NotAfter}
+		if i+1 == len(chain) {
+			break
+		}
+
+		issuer := chain[i+1]
+		if cert.NotBefore.Before(issuer.NotBefore) {
+			links[i].Issues = append(links[i].Issues, fmt.Sprintf("valid before issuer %s", issuer.Subject.CommonName))
+		}
+		if cert.NotAfter.After(issuer.NotAfter) {
+			links[i].Issues = append(links[i].Issues, fmt.Sprintf("valid after issuer %s", issuer.Subject.CommonName))
+		}
+		if len(links[i].Issues) > 0 {
+			grade = Warning
+		}
+	}
+
+	output = links
+	return
+}
+
+// MaxSharedCertDomains is the number of distinct registrable domains a leaf
+// may cover before sharedCertScan warns that it is a shared certificate.
+var MaxSharedCertDomains = 10
+
+// sharedCertSample bounds how many other domains sharedCertScan reports.
+var sharedCertSample = 10
+
+// genericSLDs are second-level labels under which country code TLDs commonly
+// register domains, such as co.uk.
+var genericSLDs = map[string]bool{"ac": true, "co": true, "com": true, "edu": true, "gov": true, "net": true, "or": true, "org": true}
+
+// registrableDomain approximates the registrable domain of a DNS name, without
+// consulting the Public Suffix List: the last two labels, or three under a
+// generic second-level label of a country code TLD.
+func registrableDomain(name string) string {
+	labels := strings.Split(strings.TrimPrefix(strings.ToLower(strings.TrimSuffix(name, ".")), "*."), ".")
+	n := 2
+	if len(labels) > 2 && len(labels[len(labels)-1]) == 2 && genericSLDs[labels[len(labels)-2]] {
+		n = 3
+	}
+	if len(labels) < n {
+		n = len(labels)
+	}
+	return strings.Join(labels[len(labels)-n:], ".")
+}
+
+// sharedCert describes how widely the host's leaf is shared.
+type sharedCert struct {
+	SANCount     int      `json:"san_count"`
+	Domains      int      `json:"domains"`
+	OtherDomains []string `json:"other_domains,omitempty"`
+}
+
+// sharedCertScan counts the DNS names and distinct registrable domains covered
+// by the host's leaf, reporting a sample of the domains other than the host's
+// own. It warns if the leaf covers more than MaxSharedCertDomains domains.
+func sharedCertScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	chain, err := getChain(addr, opts.tlsConfig(hostname))
+	if err != nil {
+		return
+	}
+	leaf := chain[0]
+
+	own := registrableDomain(hostname)
+	domains := make(map[string]bool)
+	result := sharedCert{SANCount: len(leaf.DNSNames)}
+	for _, name := range leaf.DNSNames {
+		domain := registrableDomain(name)
+		if domains[domain] {
+			continue
+		}
+		domains[domain] = true
+		if domain != own && len(result.OtherDomains) < sharedCertSample {
+			result.OtherDomains = append(result.OtherDomains, domain)
+		}
+	}
+	result.Domains = len(domains)
+	output = result
+
+	if result.Domains > MaxSharedCertDomains {
+		grade = Warning
+	} else {
+		grade = Good
+	}
+	return
+}
+
+var (
+	// interceptionRecentIssuance and interceptionShortValidity are the leaf
+	// age and validity period under which interceptionScan considers a leaf
+	// freshly minted, as inspecting proxies do on demand.
+	interceptionRecentIssuance = 7 * 24 * time.Hour
+	interceptionShortValidity  = 90 * 24 * time.Hour
+)
+
+// interception describes the evidence that the connection is intercepted.
+type interception struct {
+	Issuer  string   `json:"issuer"`
+	Likely  bool     `json:"likely"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// interceptionScan looks for signs that the connection to the host passes
+// through a TLS inspecting proxy: a chain trusted by the local system roots
+// but not by the public Mozilla roots, supported by a freshly minted leaf.
+// Interception invalidates the results of other scans, so it is warned of.
+func interceptionScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	chain, err := getChain(addr, opts.tlsConfig(hostname))
+	if err != nil {
+		return
+	}
+	leaf := chain[0]
+
+	publicRoots, err := gocertifi.CACerts()
+	if err != nil {
+		return
+	}
+
+	result := interception{Issuer: leaf.Issuer.CommonName}
+	_, localErr := buildChainsWithRoots(chain, nil)
+	_, publicErr := buildChainsWithRoots(chain, publicRoots)
+	if localErr == nil && publicErr != nil {
+		result.Likely = true
+		result.Reasons = append(result.Reasons, "chain is trusted by the local roots but not the public roots")
+		if time.Since(leaf.NotBefore) < interceptionRecentIssuance {
+			result.Reasons = append(result.Reasons, "leaf was issued recently")
+		}
+		if leaf.NotAfter.Sub(leaf.NotBefore) < interceptionShortValidity {
+			result.Reasons = append(result.Reasons, "leaf has a short validity period")
+		}
+	}
+	output = result
+
+	if result.Likely {
+		grade = Warning
+	} else {
+		grade = Good
+	}
+	return
+}
+
+var (
+	// CTSearchURL is the URL of a CT log aggregator's JSON search API, with a
+	// %s verb for the escaped hostname. It defaults to crt.sh; an empty URL
+	// skips the CTIssuance scan.
+	CTSearchURL = "https://crt.sh/?q=%s&output=json"
+	// CTSearchTimeout bounds the query to the CT log aggregator, regardless
+	// of any timeout configured on the shared Client.
+	CTSearchTimeout = 30 * time.Second
+
+	// ctRecentWindow is how recently a logged certificate must have been
+	// issued for ctIssuanceScan to report it as unexpected.
+	ctRecentWindow = 30 * 24 * time.Hour
+	// maxCTSearchResponseSize bounds the size of the aggregator's response.
+	maxCTSearchResponseSize int64 = 32 << 20
+)
+
+// ctEntry is a certificate found in CT logs, as reported by crt.sh.
+type ctEntry struct {
+	ID           int64  `json:"id"`
+	IssuerName   string `json:"issuer_name"`
+	SerialNumber string `json:"serial_number"`
+	NotBefore    string `json:"not_before"`
+}
+
+// ctCert describes a certificate logged for the host.
+type ctCert struct {
+	ID        int64     `json:"id"`
+	Serial    string    `json:"serial"`
+	Issuer    string    `json:"issuer"`
+	NotBefore time.Time `json:"not_before"`
+	Served    bool      `json:"served"`
+}
+
+// searchCT returns the certificates logged for hostname according to CTSearchURL.
+func searchCT(hostname string) ([]ctEntry, error) {
+	ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), CTSearchTimeout)
+	defer cancel()
+
+	resp, err := getWithContext(ctx, fmt.Sprintf(CTSearchURL, url.QueryEscape(hostname)))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("CT search returned %s", resp.Status)
+	}
+
+	var entries []ctEntry
+	err = json.NewDecoder(io.LimitReader(resp.Body, maxCTSearchResponseSize)).Decode(&entries)
+	return entries, err
+}
+
+// ctIssuanceScan compares the host's leaf against the certificates logged in
+// CT for its name, warning if any other was issued within ctRecentWindow, as
+// that may be unauthorized issuance. Precertificates and their certificates
+// share a serial number and are reported once.
+func ctIssuanceScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	if CTSearchURL == "" {
+		grade = Skipped
+		return
+	}
+
+	chain, err := getChain(addr, opts.tlsConfig(hostname))
+	if err != nil {
+		return
+	}
+	leaf := chain[0]
+
+	entries, err := searchCT(hostname)
+	if err != nil {
+		return
+	}
+
+	grade = Good
+	seen := make(map[string]bool)
+	certs := []ctCert{}
+	for _, entry := range entries {
+		serial, ok := new(big.Int).SetString(entry.SerialNumber, 16)
+		if !ok || seen[serial.Text(16)] {
+			continue
+		}
+		seen[serial.Text(16)] = true
+
+		notBefore, _ := time.Parse("2006-01-02T15:04:05", entry.NotBefore)
+		cert := ctCert{
+			ID:        entry.ID,
+			Serial:    serial.Text(16),
+			Issuer:    entry.IssuerName,
+			NotBefore: notBefore,
+			Served:    serial.Cmp(leaf.SerialNumber) == 0,
+		}
+		certs = append(certs, cert)
+		if !cert.Served && time.Since(notBefore) < ctRecentWindow {
+			grade = Warning
+		}
+	}
+
+	output = certs
+	return
+}
+
+// RecentIssuanceWindow is how recently the host's leaf must have been issued
+// for recentIssuanceScan to warn.
+var RecentIssuanceWindow = 7 * 24 * time.Hour
+
+// issuance describes when the host's leaf was issued.
+type issuance struct {
+	NotBefore         time.Time `json:"not_before"`
+	DaysSinceIssuance int       `json:"days_since_issuance"`
+}
+
+// recentIssuanceScan warns if the host's leaf was issued within
+// RecentIssuanceWindow, as a sudden new certificate on an established domain
+// may indicate a compromise or a change of hosting.
+func recentIssuanceScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	chain, err := getChain(addr, opts.tlsConfig(hostname))
+	if err != nil {
+		return
+	}
+	leaf := chain[0]
+
+	age := time.Since(leaf.NotBefore)
+	output = issuance{leaf.NotBefore, int(age / (24 * time.Hour))}
+	if age < RecentIssuanceWindow {
+		grade = Warning
+	} else {
+		grade = Good
+	}
+	return
+}
+
+// caaIdentifiers maps the CAA issuer domain names of well-known CAs to
+// substrings of the issuer names of the certificates they issue.
+var caaIdentifiers = map[string][]string{
+	"letsencrypt.org": {"Let's Encrypt"},
+	"pki.goog":        {"Google Trust Services"},
+	"digicert.com":    {"DigiCert", "GeoTrust", "Thawte", "RapidSSL"},
+	"sectigo.com":     {"Sectigo", "COMODO", "USERTrust"},
+	"comodoca.com":    {"Sectigo", "COMODO", "USERTrust"},
+	"globalsign.com":  {"GlobalSign"},
+	"amazon.com":      {"Amazon"},
+	"amazontrust.com": {"Amazon"},
+	"godaddy.com":     {"GoDaddy", "Starfield"},
+	"entrust.net":     {"Entrust"},
+	"buypass.com":     {"Buypass"},
+	"ssl.com":         {"SSL.com"},
+	"zerossl.com":     {"ZeroSSL"},
+	"identrust.com":   {"IdenTrust"},
+	"microsoft.com":   {"Microsoft"},
+}
+
+// caaAuthorizes reports whether the CAA issuer domain name identifies the CA
+// with the given issuer names.
+func caaAuthorizes(identifier string, issuer []string) bool {
+	for _, substr := range caaIdentifiers[identifier] {
+		for _, name := range issuer {
+			if strings.Contains(name, substr) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// caaIssuer compares the CAs a domain's CAA records authorize with the issuer
+// of the host's leaf.
+type caaIssuer struct {
+	Domain     string   `json:"domain"`
+	Authorized []string `json:"authorized"`
+	Issuer     string   `json:"issuer"`
+	Permitted  bool     `json:"permitted"`
+}
+
+// caaIssuerScan checks that the CAA records applying to the host authorize
+// the CA that issued its leaf, using the issuewild property instead of issue
+// when the leaf only covers the host through a wildcard and the domain has
+// one. A leaf from an unauthorized CA suggests misissuance and is graded Bad.
+// Hosts without CAA records, which authorize any CA, are skipped, and those
+// whose issuer isn't one of caaIdentifiers are warned of.
+func caaIssuerScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	chain, err := getChain(addr, opts.tlsConfig(hostname))
+	if err != nil {
+		return
+	}
+	leaf := chain[0]
+
+	records, domain, err := relevantCAA(hostname)
+	if err != nil {
+		return
+	}
+
+	tag := "issue"
+	if !hasSAN(leaf, hostname) {
+		for _, record := range records {
+			if record.Tag == "issuewild" {
+				tag = "issuewild"
+			}
+		}
+	}
+
+	result := caaIssuer{Domain: domain, Authorized: []string{}, Issuer: leaf.Issuer.CommonName}
+	issuer := append([]string{leaf.Issuer.CommonName}, leaf.Issuer.Organization...)
+	found, recognized := false, false
+	for _, record := range records {
+		if record.Tag != tag {
+			continue
+		}
+		found = true
+		identifier := strings.ToLower(strings.TrimSpace(strings.SplitN(record.Value, ";", 2)[0]))
+		if identifier == "" {
+			continue
+		}
+		result.Authorized = append(result.Authorized, identifier)
+		if caaAuthorizes(identifier, issuer) {
+			result.Permitted = true
+		}
+	}
+	for identifier := range caaIdentifiers {
+		if caaAuthorizes(identifier, issuer) {
+			recognized = true
+		}
+	}
+
+	if !found {
+		grade = Skipped
+		return
+	}
+	output = result
+
+	switch {
+	case result.Permitted:
+		grade = Good
+	case !recognized:
+		grade = Warning
+	}
+	return
+}
+
+// hasSAN reports whether cert names host exactly, rather than by a wildcard.
+func hasSAN(cert *x509.Certificate, host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, name := range cert.DNSNames {
+		if strings.ToLower(name) == host {
+			return true
+		}
+	}
+	return false
+}
+
+// MaxBackdating is how long before its earliest SCT a leaf's notBefore may be
+// before backdatingScan warns.
+var MaxBackdating = 48 * time.Hour
+
+// backdating compares a leaf's notBefore with the earliest SCT for it.
+type backdating struct {
+	NotBefore   time.Time `json:"not_before"`
+	EarliestSCT time.Time `json:"earliest_sct"`
+	GapHours    float64   `json:"gap_hours"`
+}
+
+// backdatingScan compares the host's leaf's notBefore with the earliest of its
+// SCTs, which marks when it was actually issued, warning if it was backdated by
+// more than MaxBackdating. Hosts without SCTs are skipped.
+func backdatingScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	chain, scts, err := getSCTs(addr, hostname, opts)
+	if err != nil {
+		return
+	}
+	if len(scts) == 0 {
+		grade = Skipped
+		return
+	}
+
+	earliest := scts[0].time()
+	for i := range scts[1:] {
+		if t := scts[i+1].time(); t.Before(earliest) {
+			earliest = t
+		}
+	}
+	gap := earliest.Sub(chain[0].NotBefore)
+	output = backdating{chain[0].NotBefore, earliest, gap.Hours()}
+
+	if gap > MaxBackdating {
+		grade = Warning
+	} else {
+		grade = Good
+	}
+	return
+}
+
+// chromeCTLifetime is the leaf lifetime up to which Chrome requires two
+// embedded SCTs, rather than three.
+var chromeCTLifetime = 180 * 24 * time.Hour
+
+// policySCT describes an SCT as counted by Chrome's CT policy.
+type policySCT struct {
+	Log       string    `json:"log"`
+	Operator  string    `json:"operator,omitempty"`
+	Source    string    `json:"source"`
+	Timestamp time.Time `json:"timestamp"`
+	Qualified bool      `json:"qualified"`
+}
+
+// ctPolicy reports whether the host's SCTs satisfy Chrome's CT policy.
+type ctPolicy struct {
+	Compliant bool `json:"compliant"`
+	// RequiredEmbedded is the number of embedded SCTs required for the leaf.
+	RequiredEmbedded int         `json:"required_embedded"`
+	SCTs             []policySCT `json:"scts"`
+}
+
+// chromeCTPolicyScan checks the host's SCTs against Chrome's CT policy, using
+// the log list at CTLogListURL. Embedded SCTs count if their log was qualified
+// when they were issued, and two are required for leaves valid for up to
+// chromeCTLifetime, three for longer. Alternatively, two SCTs delivered in the
+// handshake or a stapled OCSP response suffice if their logs are qualified
+// now. Either way, the SCTs must come from at least two log operators, and SCTs
+// timestamped in the future don't count. Leaves failing the policy, which
+// Chrome rejects, are graded Bad.
+func chromeCTPolicyScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	chain, scts, err := getSCTs(addr, hostname, opts)
+	if err != nil {
+		return
+	}
+	logs, err := loadCTLogList()
+	if err != nil {
+		return
+	}
+
+	leaf := chain[0]
+	result := ctPolicy{RequiredEmbedded: 2, SCTs: []policySCT{}}
+	if leaf.NotAfter.Sub(leaf.NotBefore) > chromeCTLifetime {
+		result.RequiredEmbedded = 3
+	}
+
+	now := time.Now()
+	embedded, delivered := 0, 0
+	embeddedOperators, deliveredOperators := make(map[string]bool), make(map[string]bool)
+	for i := range scts {
+		sct := &scts[i]
+		entry := policySCT{Log: fmt.Sprintf("%x", sct.LogID.KeyID), Source: sct.Source, Timestamp: sct.time()}
+		if ctl, ok := logs[sct.LogID]; ok {
+			entry.Log, entry.Operator = ctl.Description, ctl.Operator
+			if sct.Source == sctEmbedded {
+				entry.Qualified = ctl.qualifiedAt(entry.Timestamp)
+			} else {
+				entry.Qualified = ctl.qualifiedAt(now)
+			}
+		}
+		if entry.Timestamp.After(now) {
+			entry.Qualified = false
+		}
+		result.SCTs = append(result.SCTs, entry)
+
+		switch {
+		case !entry.Qualified:
+		case sct.Source == sctEmbedded:
+			embedded++
+			embeddedOperators[entry.Operator] = true
+		default:
+			delivered++
+			deliveredOperators[entry.Operator] = true
+		}
+	}
+	result.Compliant = (embedded >= result.RequiredEmbedded && len(embeddedOperators) >= 2) ||
+		(delivered >= 2 && len(deliveredOperators) >= 2)
+	output = result
+
+	if result.Compliant {
+		grade = Good
+	}
+	return
+}
+
+// sctSignature reports the verification of an SCT's signature.
+type sctSignature struct {
+	Log    string `json:"log"`
+	Source string `json:"source"`
+	// Result is "valid", "invalid", "unknown log", or "unverifiable" for
+	// embedded SCTs whose leaf's issuer couldn't be found.
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+// sctSignaturesScan verifies the signature of each of the host's SCTs with
+// the key of its log from the log list at CTLogListURL. Hosts with any invalid
+// signature, forged or corrupt, are graded Bad, and those with SCTs from logs
+// not in the list are warned of. Embedded SCTs are signed over the
+// precertificate, which is rebuilt with the leaf's issuer, fetched through AIA
+// if the host doesn't send it; if it can't be found, they are unverifiable and
+// warned of instead. Hosts without SCTs are skipped.
+func sctSignaturesScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	chain, scts, err := getSCTs(addr, hostname, opts)
+	if err != nil {
+		return
+	}
+	if len(scts) == 0 {
+		grade = Skipped
+		return
+	}
+	logs, err := loadCTLogList()
+	if err != nil {
+		return
+	}
+
+	ctLeaf, err := ctx509.ParseCertificate(chain[0].Raw)
+	if ctx509.IsFatal(err) {
+		return
+	}
+	ctChain := []*ctx509.Certificate{ctLeaf}
+	var issuerErr error
+	for _, sct := range scts {
+		if sct.Source != sctEmbedded {
+			continue
+		}
+		var issuer *x509.Certificate
+		if issuer, issuerErr = getIssuer(chain); issuerErr == nil {
+			var ctIssuer *ctx509.Certificate
+			if ctIssuer, err = ctx509.ParseCertificate(issuer.Raw); ctx509.IsFatal(err) {
+				return
+			}
+			ctChain = append(ctChain, ctIssuer)
+		}
+		break
+	}
+	err = nil
+
+	grade = Good
+	results := make([]sctSignature, len(scts))
+	for i := range scts {
+		sct := &scts[i]
+		results[i] = sctSignature{Log: fmt.Sprintf("%x", sct.LogID.KeyID), Source: sct.Source}
+		ctl, ok := logs[sct.LogID]
+		if !ok {
+			results[i].Result = "unknown log"
+			if grade == Good {
+				grade = Warning
+			}
+			continue
+		}
+		results[i].Log = ctl.Description
+		if sct.Source == sctEmbedded && issuerErr != nil {
+			results[i].Result, results[i].Error = "unverifiable", issuerErr.Error()
+			if grade == Good {
+				grade = Warning
+			}
+			continue
+		}
+		if verr := verifySCT(sct, ctChain, ctl.Key); verr != nil {
+			results[i].Result, results[i].Error = "invalid", verr.Error()
+			grade = Bad
+			continue
+		}
+		results[i].Result = "valid"
+	}
+	output = results
+	return
+}
+
+// minTrustedSCTs is the number of embedded SCTs from trusted logs under which
+// trustedLogSCTsScan warns, the fewest Chrome accepts for any certificate.
+var minTrustedSCTs = 2
+
+// trustedLogSCT describes the log that issued an embedded SCT.
+type trustedLogSCT struct {
+	Log      string `json:"log"`
+	Operator string `json:"operator,omitempty"`
+	// State is the log's state in the log list, or "unknown log".
+	State   string `json:"state"`
+	Trusted bool   `json:"trusted"`
+}
+
+// trustedLogSCTsScan checks that the logs of the SCTs embedded in the host's
+// leaf certificate are currently trusted according to the log list at
+// CTLogListURL, that is, usable, qualified, or read-only rather than retired,
+// rejected, or unknown. Leaves with no SCT from a trusted log are graded Bad,
+// and those with fewer than minTrustedSCTs are warned of. Leaves without
+// embedded SCTs are skipped.
+func trustedLogSCTsScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	_, scts, err := getSCTs(addr, hostname, opts)
+	if err != nil {
+		return
+	}
+	logs, err := loadCTLogList()
+	if err != nil {
+		return
+	}
+
+	results := []trustedLogSCT{}
+	trusted := 0
+	now := time.Now()
+	for i := range scts {
+		sct := &scts[i]
+		if sct.Source != sctEmbedded {
+			continue
+		}
+		result := trustedLogSCT{Log: fmt.Sprintf("%x", sct.LogID.KeyID), State: "unknown log"}
+		if ctl, ok := logs[sct.LogID]; ok {
+			result.Log, result.Operator, result.State = ctl.Description, ctl.Operator, ctl.state()
+			result.Trusted = ctl.qualifiedAt(now)
+		}
+		if result.Trusted {
+			trusted++
+		}
+		results = append(results, result)
+	}
+	if len(results) == 0 {
+		grade = Skipped
+		return
+	}
+	output = results
+
+	switch {
+	case trusted == 0:
+	case trusted < minTrustedSCTs:
+		grade = Warning
+	default:
+		grade = Good
+	}
+	return
+}
+
+// chainPEMScan captures the chain the host serves as a PEM bundle, in the
+// order it was received, for archival. It is informational.
+func chainPEMScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	chain, err := getChain(addr, opts.tlsConfig(hostname))
+	if err != nil {
+		return
+	}
+	grade, output = Good, string(helpers.EncodeCertificatesPEM(chain))
+	return
+}
+
+// summarizeChainPEM summarizes a PEM bundle by the number of certificates in it.
+func summarizeChainPEM(output Output) string {
+	bundle, ok := output.(string)
+	if !ok {
+		return fmt.Sprint(output)
+	}
+	return fmt.Sprintf("%d certificates", strings.Count(bundle, "-----BEGIN CERTIFICATE-----"))
+}
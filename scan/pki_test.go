@@ -0,0 +1,81 @@
+package scan
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/scan/crypto/tls"
+)
+
+func TestLeafCert(t *testing.T) {
+	if _, err := leafCert(tls.ConnectionState{}); err != errNoLeaf {
+		t.Errorf("leafCert of empty ConnectionState returned %v, want %v", err, errNoLeaf)
+	}
+
+	leaf := new(x509.Certificate)
+	state := tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf, new(x509.Certificate)}}
+	if cert, err := leafCert(state); err != nil || cert != leaf {
+		t.Errorf("leafCert returned %v, %v, want the first peer certificate", cert, err)
+	}
+}
+
+func TestRegistrableDomain(t *testing.T) {
+	for name, want := range map[string]string{
+		"www.example.com":   "example.com",
+		"*.example.com":     "example.com",
+		"Example.COM.":      "example.com",
+		"a.b.example.co.uk": "example.co.uk",
+		"example.co":        "example.co",
+		"localhost":         "localhost",
+	} {
+		if got := registrableDomain(name); got != want {
+			t.Errorf("registrableDomain(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestRiskyDay(t *testing.T) {
+	holidays := []time.Time{time.Date(2025, time.December, 25, 0, 0, 0, 0, time.Local)}
+	for day, want := range map[int]bool{
+		20: true,  // Saturday
+		22: false, // Monday
+		25: true,  // holiday
+		26: false,
+	} {
+		if got := riskyDay(time.Date(2025, time.December, day, 12, 0, 0, 0, time.Local), holidays); got != want {
+			t.Errorf("riskyDay(December %d) = %v, want %v", day, got, want)
+		}
+	}
+}
+
+func TestMakeSSLCert(t *testing.T) {
+	key := testKey(t)
+	now := time.Now().Truncate(time.Second)
+	for name, test := range map[string]struct {
+		template *x509.Certificate
+		want     bool
+	}{
+		"make-ssl-cert": {&x509.Certificate{
+			Subject:               pkix.Name{CommonName: "myhost"},
+			DNSNames:              []string{"myhost"},
+			NotBefore:             now,
+			NotAfter:              now.Add(3650 * 24 * time.Hour),
+			BasicConstraintsValid: true,
+		}, true},
+		"other self-signed": {&x509.Certificate{
+			Subject:               pkix.Name{CommonName: "myhost"},
+			DNSNames:              []string{"myhost"},
+			NotBefore:             now,
+			NotAfter:              now.Add(365 * 24 * time.Hour),
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageDigitalSignature,
+		}, false},
+	} {
+		leaf := testCertFromTemplate(t, test.template, key, nil, nil)
+		if got := makeSSLCert(leaf); got != test.want {
+			t.Errorf("%s: makeSSLCert = %v, want %v", name, got, test.want)
+		}
+	}
+}
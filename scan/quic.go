@@ -0,0 +1,500 @@
+package scan
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/cfssl/scan/crypto/tls"
+)
+
+var (
+	// quicTimeout bounds how long quicScan waits for a response to each
+	// Initial packet it sends.
+	quicTimeout = 2 * time.Second
+	// quicAttempts is how many times quicScan sends its Initial packet before
+	// concluding the host doesn't respond, since UDP datagrams may be lost.
+	quicAttempts = 3
+	// quicPort is the UDP port quicScan sends to.
+	quicPort = "443"
+)
+
+// quicVersion1 is QUIC version 1 (RFC 9000).
+const quicVersion1 = 0x00000001
+
+// quicVersions names the QUIC versions a host may offer in a Version
+// Negotiation packet.
+var quicVersions = map[uint32]string{
+	0x00000001: "QUIC v1",
+	0x6b3343cf: "QUIC v2",
+	0xff00001d: "draft-29",
+}
+
+// quicVersionName returns the name of a QUIC version.
+func quicVersionName(version uint32) string {
+	if name, ok := quicVersions[version]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%08x", version)
+}
+
+// quicInitialSalt derives the keys protecting QUIC v1 Initial packets from
+// the client's first destination connection ID (RFC 9001, section 5.2).
+var quicInitialSalt = []byte{
+	0x38, 0x76, 0x2c, 0xf7, 0xf5, 0x59, 0x34, 0xb3, 0x4d, 0x17,
+	0x9a, 0xe6, 0xa4, 0xc8, 0x0c, 0xad, 0xcc, 0xbb, 0x7f, 0x0a,
+}
+
+// quicMinDatagram is the size clients must pad datagrams carrying Initial
+// packets to.
+const quicMinDatagram = 1200
+
+// extensionQUICTransportParameters and extensionALPN are TLS extension types
+// sent in QUIC ClientHellos.
+const (
+	extensionQUICTransportParameters = 57
+	extensionALPN                    = 16
+)
+
+var errMalformedQUIC = errors.New("malformed QUIC packet")
+
+// hkdfExpandLabel is TLS 1.3's HKDF-Expand-Label with SHA-256, for outputs
+// no longer than a single hash.
+func hkdfExpandLabel(secret []byte, label string, length int) []byte {
+	info := []byte{byte(length >> 8), byte(length)}
+	info = appendVector(info, 1, []byte("tls13 "+label))
+	info = append(info, 0) // empty context
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(append(info, 1))
+	return mac.Sum(nil)[:length]
+}
+
+// quicKeys protects Initial packets in one direction.
+type quicKeys struct {
+	aead cipher.AEAD
+	iv   []byte
+	hp   cipher.Block
+}
+
+// newQUICKeys derives the client's or server's Initial packet protection
+// keys from the client's first destination connection ID.
+func newQUICKeys(dcid []byte, server bool) (*quicKeys, error) {
+	extract := hmac.New(sha256.New, quicInitialSalt)
+	extract.Write(dcid)
+	label := "client in"
+	if server {
+		label = "server in"
+	}
+	secret := hkdfExpandLabel(extract.Sum(nil), label, sha256.Size)
+
+	block, err := aes.NewCipher(hkdfExpandLabel(secret, "quic key", 16))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	hp, err := aes.NewCipher(hkdfExpandLabel(secret, "quic hp", 16))
+	if err != nil {
+		return nil, err
+	}
+	return &quicKeys{aead, hkdfExpandLabel(secret, "quic iv", 12), hp}, nil
+}
+
+// nonce returns the AEAD nonce for packet number pn.
+func (k *quicKeys) nonce(pn uint32) []byte {
+	nonce := append([]byte{}, k.iv...)
+	for i := 0; i < 4; i++ {
+		nonce[len(nonce)-1-i] ^= byte(pn >> (8 * uint(i)))
+	}
+	return nonce
+}
+
+// mask returns the header protection mask for a packet whose packet number
+// begins at pnOffset.
+func (k *quicKeys) mask(packet []byte, pnOffset int) ([]byte, error) {
+	if len(packet) < pnOffset+4+aes.BlockSize {
+		return nil, errMalformedQUIC
+	}
+	mask := make([]byte, aes.BlockSize)
+	k.hp.Encrypt(mask, packet[pnOffset+4:pnOffset+4+aes.BlockSize])
+	return mask, nil
+}
+
+// appendQUICVarint appends v as a QUIC variable-length integer.
+func appendQUICVarint(b []byte, v uint64) []byte {
+	switch {
+	case v < 1<<6:
+		return append(b, byte(v))
+	case v < 1<<14:
+		return append(b, byte(v>>8)|0x40, byte(v))
+	case v < 1<<30:
+		return append(b, byte(v>>24)|0x80, byte(v>>16), byte(v>>8), byte(v))
+	}
+	return append(b, byte(v>>56)|0xc0, byte(v>>48), byte(v>>40), byte(v>>32), byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// readQUICVarint reads a QUIC variable-length integer from the start of b,
+// returning it and the rest of b.
+func readQUICVarint(b []byte) (uint64, []byte, error) {
+	if len(b) == 0 {
+		return 0, nil, errMalformedQUIC
+	}
+	n := 1 << (b[0] >> 6)
+	if len(b) < n {
+		return 0, nil, errMalformedQUIC
+	}
+	v := uint64(b[0] & 0x3f)
+	for _, c := range b[1:n] {
+		v = v<<8 | uint64(c)
+	}
+	return v, b[n:], nil
+}
+
+// quicClientHello returns a TLS 1.3 ClientHello handshake message offering h3,
+// with QUIC transport parameters naming scid as the client's connection ID.
+func quicClientHello(hostname string, scid []byte) ([]byte, error) {
+	hello := make([]byte, 2+32)
+	hello[0], hello[1] = 0x03, 0x03
+	if _, err := rand.Read(hello[2:]); err != nil {
+		return nil, err
+	}
+	hello = append(hello, 0) // QUIC forbids a legacy session ID
+
+	var suites []byte
+	for id := range tls.TLS13CipherSuites {
+		suites = append(suites, byte(id>>8), byte(id))
+	}
+	hello = appendVector(hello, 2, suites)
+	hello = append(hello, 1, 0) // null compression
+
+	var exts []byte
+	if hostname != "" {
+		serverName := appendVector([]byte{0}, 2, []byte(hostname))
+		exts = appendExtension(exts, 0, appendVector(nil, 2, serverName))
+	}
+	exts = appendExtension(exts, extensionALPN, appendVector(nil, 2, appendVector(nil, 1, []byte("h3"))))
+	extensions, err := tls13Extensions(tls13Groups)
+	if err != nil {
+		return nil, err
+	}
+	for _, ext := range extensions {
+		exts = appendExtension(exts, ext.Type, ext.Data)
+	}
+	// initial_source_connection_id is the only transport parameter clients
+	// must send; the rest default to values allowing no stream data, which
+	// the handshake doesn't need.
+	params := appendVector(appendQUICVarint(nil, 0x0f), 1, scid)
+	exts = appendExtension(exts, extensionQUICTransportParameters, params)
+	hello = appendVector(hello, 2, exts)
+
+	return appendVector([]byte{1}, 3, hello), nil
+}
+
+// quicInitial returns a datagram holding a protected Initial packet with
+// crypto in a CRYPTO frame, padded to quicMinDatagram.
+func quicInitial(keys *quicKeys, dcid, scid, token, crypto []byte) ([]byte, error) {
+	payload := appendQUICVarint(append([]byte{0x06}, 0), uint64(len(crypto)))
+	payload = append(payload, crypto...)
+
+	header := []byte{0xc3, 0, 0, 0, 0} // long header, Initial, 4-byte packet number
+	binary.BigEndian.PutUint32(header[1:], quicVersion1)
+	header = appendVector(header, 1, dcid)
+	header = appendVector(header, 1, scid)
+	header = appendQUICVarint(header, uint64(len(token)))
+	header = append(header, token...)
+	// The length, encoded in 2 bytes, covers the packet number, payload, and
+	// AEAD tag.
+	overhead := len(header) + 2 + 4 + keys.aead.Overhead()
+	if padding := quicMinDatagram - overhead - len(payload); padding > 0 {
+		payload = append(payload, make([]byte, padding)...)
+	}
+	length := 4 + len(payload) + keys.aead.Overhead()
+	if length >= 1<<14 {
+		return nil, errors.New("QUIC ClientHello is too large")
+	}
+	header = append(header, byte(length>>8)|0x40, byte(length))
+	pnOffset := len(header)
+	header = append(header, 0, 0, 0, 0) // packet number 0
+
+	packet := keys.aead.Seal(header, keys.nonce(0), payload, header)
+	mask, err := keys.mask(packet, pnOffset)
+	if err != nil {
+		return nil, err
+	}
+	packet[0] ^= mask[0] & 0x0f
+	for i := 0; i < 4; i++ {
+		packet[pnOffset+i] ^= mask[1+i]
+	}
+	return packet, nil
+}
+
+// quicResponse is how the host responded to an Initial packet.
+type quicResponse struct {
+	version uint32
+	// versions are those offered by a Version Negotiation packet.
+	versions []uint32
+	// retry holds the server's connection ID and token from a Retry packet.
+	retrySCID, retryToken []byte
+	// crypto is the handshake data in the CRYPTO frames of an Initial packet.
+	crypto []byte
+	// closeCode is the error code of a CONNECTION_CLOSE frame, if any.
+	closeCode *uint64
+}
+
+// parseQUICResponse parses the first packet of a datagram sent by the host
+// in response to an Initial packet, unprotecting Initial packets with keys.
+func parseQUICResponse(datagram []byte, keys *quicKeys) (*quicResponse, error) {
+	if len(datagram) < 7 || datagram[0]&0x80 == 0 {
+		return nil, errMalformedQUIC
+	}
+	resp := &quicResponse{version: binary.BigEndian.Uint32(datagram[1:])}
+	b := datagram[5:]
+	var cids [2][]byte
+	for i := range cids {
+		if len(b) < 1 || len(b) < 1+int(b[0]) {
+			return nil, errMalformedQUIC
+		}
+		cids[i], b = b[1:1+int(b[0])], b[1+int(b[0]):]
+	}
+
+	if resp.version == 0 {
+		for ; len(b) >= 4; b = b[4:] {
+			resp.versions = append(resp.versions, binary.BigEndian.Uint32(b))
+		}
+		return resp, nil
+	}
+	switch datagram[0] >> 4 & 0x3 {
+	case 3: // Retry, ending with a 16-byte integrity tag
+		if len(b) < 16 {
+			return nil, errMalformedQUIC
+		}
+		resp.retrySCID, resp.retryToken = cids[1], b[:len(b)-16]
+		return resp, nil
+	case 0: // Initial
+	default:
+		return nil, fmt.Errorf("unexpected QUIC packet of type %d", datagram[0]>>4&0x3)
+	}
+	if resp.version != quicVersion1 {
+		return nil, fmt.Errorf("unexpected QUIC version %s", quicVersionName(resp.version))
+	}
+
+	tokenLen, b, err := readQUICVarint(b)
+	if err != nil || uint64(len(b)) < tokenLen {
+		return nil, errMalformedQUIC
+	}
+	length, b, err := readQUICVarint(b[tokenLen:])
+	if err != nil || uint64(len(b)) < length {
+		return nil, errMalformedQUIC
+	}
+	pnOffset := len(datagram) - len(b)
+	packet := append([]byte{}, datagram[:pnOffset+int(length)]...)
+
+	mask, err := keys.mask(packet, pnOffset)
+	if err != nil {
+		return nil, err
+	}
+	packet[0] ^= mask[0] & 0x0f
+	pnLen := int(packet[0]&0x3) + 1
+	var pn uint32
+	for i := 0; i < pnLen; i++ {
+		packet[pnOffset+i] ^= mask[1+i]
+		pn = pn<<8 | uint32(packet[pnOffset+i])
+	}
+	payload, err := keys.aead.Open(nil, keys.nonce(pn), packet[pnOffset+pnLen:], packet[:pnOffset+pnLen])
+	if err != nil {
+		return nil, err
+	}
+
+	for len(payload) > 0 {
+		frame := payload[0]
+		payload = payload[1:]
+		switch frame {
+		case 0x00, 0x01: // PADDING, PING
+		case 0x02, 0x03: // ACK
+			// The largest acknowledged, delay, range count, and first range,
+			// then a gap and length per further range, and the ECN counts of
+			// ACK frames of type 0x03.
+			fields := make([]uint64, 4)
+			for i := range fields {
+				if fields[i], payload, err = readQUICVarint(payload); err != nil {
+					return nil, err
+				}
+			}
+			rest := 2 * fields[2]
+			if frame == 0x03 {
+				rest += 3
+			}
+			for i := uint64(0); i < rest; i++ {
+				if _, payload, err = readQUICVarint(payload); err != nil {
+					return nil, err
+				}
+			}
+		case 0x06: // CRYPTO
+			var offset, n uint64
+			if offset, payload, err = readQUICVarint(payload); err != nil {
+				return nil, err
+			}
+			if n, payload, err = readQUICVarint(payload); err != nil || uint64(len(payload)) < n {
+				return nil, errMalformedQUIC
+			}
+			if offset == uint64(len(resp.crypto)) {
+				resp.crypto = append(resp.crypto, payload[:n]...)
+			}
+			payload = payload[n:]
+		case 0x1c: // CONNECTION_CLOSE
+			var code uint64
+			if code, payload, err = readQUICVarint(payload); err != nil {
+				return nil, err
+			}
+			resp.closeCode = &code
+			return resp, nil
+		default:
+			// Other frames aren't allowed in Initial packets.
+			return nil, errMalformedQUIC
+		}
+	}
+	return resp, nil
+}
+
+// quicHandshake describes the host's response to a QUIC Initial packet.
+type quicHandshake struct {
+	// Response is "handshake", "connection close", or "version negotiation".
+	Response string `json:"response"`
+	Version  string `json:"version,omitempty"`
+	// Versions are those the host offered in Version Negotiation.
+	Versions []string `json:"versions,omitempty"`
+	Retry    bool     `json:"retry,omitempty"`
+	// Advanced is whether the host answered the ClientHello with a ServerHello.
+	Advanced    bool   `json:"advanced"`
+	CipherSuite string `json:"cipher_suite,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// quicExchange sends the host an Initial packet and returns its response,
+// resending the packet if none arrives in time.
+func quicExchange(conn net.Conn, datagram []byte, keys *quicKeys) (*quicResponse, error) {
+	buf := make([]byte, 65536)
+	for attempt := 0; ; attempt++ {
+		if _, err := conn.Write(datagram); err != nil {
+			return nil, err
+		}
+		conn.SetReadDeadline(time.Now().Add(quicTimeout))
+		n, err := conn.Read(buf)
+		if e, ok := err.(net.Error); ok && e.Timeout() && attempt+1 < quicAttempts {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return parseQUICResponse(buf[:n], keys)
+	}
+}
+
+// quicScan sends a QUIC v1 Initial packet offering h3 to UDP port quicPort of the
+// host, following a Retry if sent one, and reports whether the host answers
+// with a ServerHello, advancing the handshake, and the version it speaks.
+// Since a ServerHello follows ALPN negotiation, hosts advancing the handshake
+// offer HTTP/3 and are graded Good; hosts responding otherwise are warned of.
+// Hosts not responding, which most don't offer QUIC, are skipped.
+func quicScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return
+	}
+	conn, err := Dialer.Dial(strings.Replace(Network, "tcp", "udp", 1), net.JoinHostPort(host, quicPort))
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	dcid, scid := make([]byte, 8), make([]byte, 8)
+	if _, err = rand.Read(dcid); err != nil {
+		return
+	}
+	if _, err = rand.Read(scid); err != nil {
+		return
+	}
+	hello, err := quicClientHello(hostname, scid)
+	if err != nil {
+		return
+	}
+
+	result := quicHandshake{}
+	var resp *quicResponse
+	var token []byte
+	for {
+		var clientKeys, serverKeys *quicKeys
+		if clientKeys, err = newQUICKeys(dcid, false); err != nil {
+			return
+		}
+		if serverKeys, err = newQUICKeys(dcid, true); err != nil {
+			return
+		}
+		var datagram []byte
+		if datagram, err = quicInitial(clientKeys, dcid, scid, token, hello); err != nil {
+			return
+		}
+		resp, err = quicExchange(conn, datagram, serverKeys)
+		if err != nil {
+			// Closed UDP ports may be reported by ICMP.
+			if class := classifyNetError(err); class == "timeout" || class == "connection refused" {
+				grade, err = Skipped, nil
+			}
+			return
+		}
+		if resp.retrySCID == nil || result.Retry {
+			break
+		}
+		// The retried Initial is sent to, and protected with keys derived
+		// from, the connection ID the host chose.
+		result.Retry = true
+		dcid, token = resp.retrySCID, resp.retryToken
+	}
+	output = &result
+
+	switch {
+	case resp.version == 0:
+		result.Response = "version negotiation"
+		for _, v := range resp.versions {
+			result.Versions = append(result.Versions, quicVersionName(v))
+		}
+	case resp.closeCode != nil:
+		result.Response, result.Version = "connection close", quicVersionName(resp.version)
+		// Codes 0x100–0x1ff carry a TLS alert.
+		if code := *resp.closeCode; code >= 0x100 && code < 0x200 {
+			result.Error = tls.AlertText(uint8(code))
+		} else {
+			result.Error = fmt.Sprintf("error 0x%x", code)
+		}
+	default:
+		result.Response, result.Version = "handshake", quicVersionName(resp.version)
+		// The ServerHello's cipher suite follows its version, random, and
+		// session ID echo.
+		if c := resp.crypto; len(c) >= 4+2+32+1 && c[0] == 2 {
+			result.Advanced = true
+			if sid := 4 + 2 + 32 + 1 + int(c[4+2+32]); len(c) >= sid+2 {
+				id := binary.BigEndian.Uint16(c[sid:])
+				if suite, ok := tls.TLS13CipherSuites[id]; ok {
+					result.CipherSuite = suite.Name
+				}
+			}
+		}
+	}
+
+	if result.Advanced {
+		grade = Good
+	} else {
+		grade = Warning
+	}
+	return
+}
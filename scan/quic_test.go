@@ -0,0 +1,31 @@
+package scan
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// TestNewQUICKeys checks Initial key derivation against RFC 9001, appendix A.1.
+func TestNewQUICKeys(t *testing.T) {
+	dcid, _ := hex.DecodeString("8394c8f03e515708")
+	for server, want := range map[bool]string{false: "fa044b2f42a3fd3b46fb255c", true: "0ac1493ca1905853b0bba03e"} {
+		keys, err := newQUICKeys(dcid, server)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if iv, _ := hex.DecodeString(want); !bytes.Equal(keys.iv, iv) {
+			t.Errorf("server %v: iv = %x, want %s", server, keys.iv, want)
+		}
+	}
+}
+
+func TestQUICVarint(t *testing.T) {
+	for _, v := range []uint64{0, 63, 64, 16383, 16384, 1<<30 - 1, 1 << 30, 1<<62 - 1} {
+		b := appendQUICVarint(nil, v)
+		got, rest, err := readQUICVarint(b)
+		if err != nil || got != v || len(rest) != 0 {
+			t.Errorf("%d: read %d, %x, %v", v, got, rest, err)
+		}
+	}
+}
@@ -0,0 +1,764 @@
+package scan
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/cloudflare/cfssl/scan/crypto/tls"
+)
+
+// Revocation contains scanners for the host's certificate revocation infrastructure.
+var Revocation = &Family{
+	Description: "Scans the revocation infrastructure of the host's certificate",
+	Scanners: map[string]*Scanner{
+		"OCSPLatency": {
+			Description: "Host's OCSP responder answers promptly",
+			scan:        ocspLatencyScan,
+		},
+		"RevocationReadiness": {
+			Description: "Clients can check host's revocation status through stapling or a reachable responder",
+			scan:        revocationReadinessScan,
+		},
+		"MultiStapling": {
+			Description: "Host staples OCSP responses for its whole chain through status_request_v2",
+			scan:        multiStaplingScan,
+		},
+		"OCSPResponderAuthorization": {
+			Description: "Host's OCSP responses are signed by its issuer or a responder it delegated to",
+			scan:        ocspResponderAuthorizationScan,
+		},
+		"OCSPResponderCerts": {
+			Description: "Host's delegated OCSP responses include the responder's certificate, chaining to the issuer",
+			scan:        ocspResponderCertsScan,
+		},
+		"OCSPNonce": {
+			Description: "Host's OCSP responder echoes the nonce of a request",
+			scan:        ocspNonceScan,
+		},
+		"RevocationURLs": {
+			Description: "Host's OCSP, CRL, and issuer URLs are reachable",
+			scan:        revocationURLsScan,
+		},
+	},
+}
+
+var (
+	// ocspGoodLatency and ocspWarningLatency are the OCSP responder round trip
+	// times under which responders are graded Good and Warning respectively.
+	ocspGoodLatency    = 500 * time.Millisecond
+	ocspWarningLatency = 2 * time.Second
+	// maxOCSPResponseSize bounds the size of an OCSP response read from a responder.
+	maxOCSPResponseSize int64 = 1 << 20
+)
+
+// getIssuer returns the issuer of the chain's leaf, either from the chain
+// itself or fetched through the leaf's AIA caIssuers URLs.
+func getIssuer(chain []*x509.Certificate) (*x509.Certificate, error) {
+	leaf := chain[0]
+	candidates := chain[1:]
+	if len(candidates) == 0 || leaf.CheckSignatureFrom(candidates[0]) != nil {
+		candidates = append(candidates, fetchAIAIssuers(chain[:1])...)
+	}
+
+	for _, cert := range candidates {
+		if leaf.CheckSignatureFrom(cert) == nil {
+			return cert, nil
+		}
+	}
+	return nil, fmt.Errorf("couldn't find the issuer of %s", leaf.Subject.CommonName)
+}
+
+// postOCSP sends a DER-encoded OCSP request to the responder at url through
+// the shared Client, returning the HTTP status, response body, and round trip latency.
+func postOCSP(url string, req []byte) (status int, body []byte, latency time.Duration, err error) {
+	start := time.Now()
+	resp, err := Client.Post(url, "application/ocsp-request", bytes.NewReader(req))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err = ioutil.ReadAll(io.LimitReader(resp.Body, maxOCSPResponseSize))
+	latency = time.Since(start)
+	status = resp.StatusCode
+	return
+}
+
+// ocspLatency describes the round trip to an OCSP responder.
+type ocspLatency struct {
+	URL        string `json:"url"`
+	LatencyMS  int64  `json:"latency_ms"`
+	HTTPStatus int    `json:"http_status"`
+}
+
+// ocspLatencyScan measures the latency of a live OCSP request to the responder
+// in the host's leaf, independent of the revocation status returned.
+func ocspLatencyScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	chain, err := getChain(addr, opts.tlsConfig(hostname))
+	if err != nil {
+		return
+	}
+
+	if len(chain[0].OCSPServer) == 0 {
+		grade = Skipped
+		return
+	}
+
+	issuer, err := getIssuer(chain)
+	if err != nil {
+		return
+	}
+
+	req, err := ocsp.CreateRequest(chain[0], issuer, nil)
+	if err != nil {
+		return
+	}
+
+	url := chain[0].OCSPServer[0]
+	status, _, latency, err := postOCSP(url, req)
+	if err != nil {
+		return
+	}
+
+	output = ocspLatency{url, int64(latency / time.Millisecond), status}
+
+	switch {
+	case status != 200:
+		err = errors.New("OCSP responder returned an HTTP error")
+	case latency < ocspGoodLatency:
+		grade = Good
+	case latency < ocspWarningLatency:
+		grade = Warning
+	}
+	return
+}
+
+// Content types accepted from each kind of URL a certificate may reference.
+var (
+	ocspContentTypes      = []string{"application/ocsp-response"}
+	caIssuersContentTypes = []string{"application/pkix-cert", "application/pkcs7-mime", "application/x-pkcs7-certificates", "application/x-x509-ca-cert", "application/octet-stream"}
+	crlContentTypes       = []string{"application/pkix-crl", "application/x-pkcs7-crl", "application/octet-stream"}
+)
+
+// urlReachable reports the HTTP status of resp and whether it is a success
+// with one of the given content types.
+func urlReachable(resp *http.Response, contentTypes []string) (int, bool) {
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return resp.StatusCode, false
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	for _, contentType := range contentTypes {
+		if mediaType == contentType {
+			return resp.StatusCode, true
+		}
+	}
+	return resp.StatusCode, false
+}
+
+// revocationURLsScan requests each OCSP, caIssuers, and CRL distribution point
+// URL in the host's leaf, mapping them to the HTTP status returned, or 0 if
+// they couldn't be reached. OCSP responders are sent a request for the leaf.
+// Any URL failing or answering with an unexpected content type is warned of.
+func revocationURLsScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	chain, err := getChain(addr, opts.tlsConfig(hostname))
+	if err != nil {
+		return
+	}
+	leaf := chain[0]
+
+	statuses := make(map[string]int)
+	grade = Good
+	check := func(url string, resp *http.Response, rerr error, contentTypes []string) {
+		ok := false
+		if rerr == nil {
+			statuses[url], ok = urlReachable(resp, contentTypes)
+		} else {
+			statuses[url] = 0
+		}
+		if !ok {
+			grade = Warning
+		}
+	}
+
+	if len(leaf.OCSPServer) > 0 {
+		issuer, ierr := getIssuer(chain)
+		var req []byte
+		if ierr == nil {
+			req, ierr = ocsp.CreateRequest(leaf, issuer, nil)
+		}
+		for _, url := range leaf.OCSPServer {
+			if ierr != nil {
+				check(url, nil, ierr, nil)
+				continue
+			}
+			resp, rerr := Client.Post(url, "application/ocsp-request", bytes.NewReader(req))
+			check(url, resp, rerr, ocspContentTypes)
+		}
+	}
+	for _, url := range leaf.IssuingCertificateURL {
+		resp, rerr := Client.Get(url)
+		check(url, resp, rerr, caIssuersContentTypes)
+	}
+	for _, url := range leaf.CRLDistributionPoints {
+		resp, rerr := Client.Get(url)
+		check(url, resp, rerr, crlContentTypes)
+	}
+
+	if len(statuses) == 0 {
+		grade = Skipped
+		return
+	}
+	output = statuses
+	return
+}
+
+// tlsFeatureOID identifies the TLS Feature extension (RFC 7633) by which a
+// certificate declares itself Must-Staple.
+var tlsFeatureOID = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}
+
+// mustStaple reports whether cert requires the status_request TLS feature.
+func mustStaple(cert *x509.Certificate) bool {
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(tlsFeatureOID) {
+			continue
+		}
+		var features []int
+		if _, err := asn1.Unmarshal(ext.Value, &features); err != nil {
+			return false
+		}
+		for _, feature := range features {
+			// status_request
+			if feature == 5 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// revocationReadiness summarizes how clients can learn the host's revocation status.
+type revocationReadiness struct {
+	Stapled            bool `json:"stapled"`
+	StapleFresh        bool `json:"staple_fresh"`
+	MustStaple         bool `json:"must_staple"`
+	ResponderReachable bool `json:"responder_reachable"`
+}
+
+// revocationReadinessScan combines OCSP stapling, Must-Staple, and responder
+// reachability into one verdict: Good if the host staples a fresh response,
+// Warning if clients must instead reach a responder themselves, and Bad if
+// they can't learn the leaf's status at all, or the leaf is Must-Staple
+// without a fresh staple.
+func revocationReadinessScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	conn, err := tls.DialWithDialer(Dialer, Network, addr, opts.tlsConfig(hostname))
+	if err != nil {
+		return
+	}
+	conn.Close()
+
+	state := conn.ConnectionState()
+	leaf, err := leafCert(state)
+	if err != nil {
+		return
+	}
+
+	result := revocationReadiness{Stapled: len(state.OCSPResponse) > 0, MustStaple: mustStaple(leaf)}
+	issuer, ierr := getIssuer(state.PeerCertificates)
+
+	if result.Stapled && ierr == nil {
+		if resp, perr := ocsp.ParseResponse(state.OCSPResponse, issuer); perr == nil {
+			now := time.Now()
+			result.StapleFresh = resp.Status == ocsp.Good && !now.Before(resp.ThisUpdate) &&
+				(resp.NextUpdate.IsZero() || now.Before(resp.NextUpdate))
+		}
+	}
+
+	if len(leaf.OCSPServer) > 0 && ierr == nil {
+		if req, rerr := ocsp.CreateRequest(leaf, issuer, nil); rerr == nil {
+			status, _, _, perr := postOCSP(leaf.OCSPServer[0], req)
+			result.ResponderReachable = perr == nil && status == 200
+		}
+	}
+	output = result
+
+	switch {
+	case result.StapleFresh:
+		grade = Good
+	case result.MustStaple:
+		grade = Bad
+	case result.ResponderReachable:
+		grade = Warning
+	}
+	return
+}
+
+// statusRequestV2 is a status_request_v2 extension (RFC 6961) requesting
+// ocsp_multi stapling without responder IDs or request extensions.
+var statusRequestV2 = tls.Extension{Type: 17, Data: []byte{0, 7, 2, 0, 4, 0, 0, 0, 0}}
+
+// ocspStatuses names the certificate statuses in OCSP responses.
+var ocspStatuses = map[int]string{
+	ocsp.Good:    "good",
+	ocsp.Revoked: "revoked",
+	ocsp.Unknown: "unknown",
+}
+
+// stapledResponse describes the OCSP response stapled for one certificate.
+type stapledResponse struct {
+	Subject string `json:"subject"`
+	Status  string `json:"status"`
+}
+
+// multiStaplingScan requests ocsp_multi stapling through status_request_v2,
+// listing the certificates in the host's chain it staples a response for.
+// Hosts stapling responses for the leaf and all its intermediates are graded
+// Good, and others, including those stapling only the leaf's response through
+// status_request, Warning.
+func multiStaplingScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	tcpConn, err := Dialer.Dial(Network, addr)
+	if err != nil {
+		return
+	}
+	defer tcpConn.Close()
+	tcpConn.SetDeadline(time.Now().Add(helloTimeout))
+
+	_, rawCerts, responses, err := tls.Client(tcpConn, opts.tlsConfig(hostname)).HelloForCertificates([]tls.Extension{statusRequestV2})
+	if err != nil {
+		return
+	}
+	chain := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		if chain[i], err = x509.ParseCertificate(raw); err != nil {
+			return
+		}
+	}
+
+	stapled := []stapledResponse{}
+	complete := len(responses) > 0
+	for i, cert := range chain {
+		if isSelfSigned(cert) {
+			break
+		}
+		if i >= len(responses) || responses[i] == nil {
+			complete = false
+			continue
+		}
+		var issuer *x509.Certificate
+		if i+1 < len(chain) {
+			issuer = chain[i+1]
+		}
+		status := "unparseable"
+		if resp, perr := ocsp.ParseResponse(responses[i], issuer); perr == nil {
+			status = ocspStatuses[resp.Status]
+		}
+		stapled = append(stapled, stapledResponse{cert.Subject.CommonName, status})
+	}
+	output = stapled
+
+	if complete {
+		grade = Good
+	} else {
+		grade = Warning
+	}
+	return
+}
+
+// ocspResponder describes who signed an OCSP response for the host's leaf.
+type ocspResponder struct {
+	// Source is "stapled" or the URL of the responder queried.
+	Source  string `json:"source"`
+	Subject string `json:"subject"`
+	// Authorization is "issuer", "delegated", or "unauthorized".
+	Authorization string `json:"authorization"`
+	Reason        string `json:"reason,omitempty"`
+}
+
+// ocspSigner returns the certificate that signed resp, given the leaf's
+// issuer, and whether it is the issuer itself, a responder the issuer
+// delegated to (RFC 6960, section 4.2.2.2), or neither.
+func ocspSigner(resp *ocsp.Response, issuer *x509.Certificate) (signer *x509.Certificate, authorization, reason string) {
+	if resp.Certificate == nil || bytes.Equal(resp.Certificate.RawSubjectPublicKeyInfo, issuer.RawSubjectPublicKeyInfo) {
+		if err := resp.CheckSignatureFrom(issuer); err != nil {
+			return issuer, "unauthorized", "not signed by the issuer: " + err.Error()
+		}
+		return issuer, "issuer", ""
+	}
+
+	// ParseResponse has already checked that the embedded certificate
+	// signed the response.
+	signer = resp.Certificate
+	if err := signer.CheckSignatureFrom(issuer); err != nil {
+		return signer, "unauthorized", "responder certificate not issued by the issuer"
+	}
+	for _, usage := range signer.ExtKeyUsage {
+		if usage == x509.ExtKeyUsageOCSPSigning {
+			return signer, "delegated", ""
+		}
+	}
+	return signer, "unauthorized", "responder certificate lacks the OCSPSigning extended key usage"
+}
+
+// ocspResponderAuthorizationScan checks who signed the OCSP response for the
+// host's leaf, stapled or else fetched from its responder. Responses must be
+// signed by the leaf's issuer, or by a responder certificate the issuer issued
+// with the OCSPSigning extended key usage, and others, which may be spoofed,
+// are graded Bad. Hosts without a stapled response or responder are skipped.
+func ocspResponderAuthorizationScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	issuer, der, source, err := getOCSPResponse(addr, hostname, opts)
+	if err != nil || der == nil {
+		if err == nil {
+			grade = Skipped
+		}
+		return
+	}
+
+	// Without an issuer, ParseResponse only checks that a response's embedded
+	// certificate signed it, so a failure there is one to report, not an error.
+	resp, err := ocsp.ParseResponse(der, nil)
+	if perr, ok := err.(ocsp.ParseError); ok && strings.HasPrefix(string(perr), "bad signature on embedded certificate") {
+		output = ocspResponder{source, "", "unauthorized", "not signed by the embedded responder certificate"}
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	signer, authorization, reason := ocspSigner(resp, issuer)
+	output = ocspResponder{source, signer.Subject.CommonName, authorization, reason}
+
+	if authorization != "unauthorized" {
+		grade = Good
+	}
+	return
+}
+
+// getOCSPResponse returns the issuer of the host's leaf and the DER-encoded
+// OCSP response for the leaf, stapled or else fetched from its responder,
+// along with where it came from: "stapled" or the responder's URL. The
+// response is nil if the host staples none and the leaf names no responder.
+func getOCSPResponse(addr, hostname string, opts *Options) (issuer *x509.Certificate, der []byte, source string, err error) {
+	conn, err := tls.DialWithDialer(Dialer, Network, addr, opts.tlsConfig(hostname))
+	if err != nil {
+		return
+	}
+	conn.Close()
+	state := conn.ConnectionState()
+	if _, err = leafCert(state); err != nil {
+		return
+	}
+	chain := state.PeerCertificates
+	if issuer, err = getIssuer(chain); err != nil {
+		return
+	}
+
+	if len(state.OCSPResponse) > 0 {
+		return issuer, state.OCSPResponse, "stapled", nil
+	}
+	if len(chain[0].OCSPServer) == 0 {
+		return
+	}
+	req, err := ocsp.CreateRequest(chain[0], issuer, nil)
+	if err != nil {
+		return
+	}
+	source = chain[0].OCSPServer[0]
+	status, der, _, err := postOCSP(source, req)
+	if err != nil {
+		return
+	}
+	if status != 200 {
+		err = fmt.Errorf("OCSP responder returned HTTP status %d", status)
+	}
+	return
+}
+
+// ocspNonceOID identifies the OCSP nonce extension (RFC 8954).
+var ocspNonceOID = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 2}
+
+// ocspNonceRequest returns a DER-encoded OCSP request for cert, issued by
+// issuer, carrying a nonce extension with the given value, which
+// ocsp.CreateRequest can't add.
+func ocspNonceRequest(cert, issuer *x509.Certificate, nonce []byte) ([]byte, error) {
+	der, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var req struct {
+		TBSRequest struct {
+			RequestList asn1.RawValue
+			Extensions  []pkix.Extension `asn1:"explicit,tag:2,optional"`
+		}
+	}
+	if _, err = asn1.Unmarshal(der, &req); err != nil {
+		return nil, err
+	}
+	req.TBSRequest.Extensions = []pkix.Extension{{Id: ocspNonceOID, Value: nonce}}
+	return asn1.Marshal(req)
+}
+
+// ocspResponseNonce returns the value of the nonce extension of resp, or nil
+// if it has none. ocsp.ParseResponse only keeps the extensions of the single
+// response, so the response data is parsed again for its own.
+func ocspResponseNonce(resp *ocsp.Response) ([]byte, error) {
+	var data struct {
+		Version     int `asn1:"optional,default:0,explicit,tag:0"`
+		ResponderID asn1.RawValue
+		ProducedAt  time.Time `asn1:"generalized"`
+		Responses   []asn1.RawValue
+		Extensions  []pkix.Extension `asn1:"explicit,tag:1,optional"`
+	}
+	if _, err := asn1.Unmarshal(resp.TBSResponseData, &data); err != nil {
+		return nil, err
+	}
+	for _, ext := range data.Extensions {
+		if ext.Id.Equal(ocspNonceOID) {
+			return ext.Value, nil
+		}
+	}
+	return nil, nil
+}
+
+// ocspNonceScan sends the OCSP responder of the host's leaf a request with a
+// random nonce, reporting whether the response echoes it. Responders ignoring
+// the nonce, such as those serving pre-signed responses, leave clients open to
+// replayed responses, and are warned of. Responses with a different nonce are
+// graded Bad. Hosts without a responder, or whose responder rejects requests
+// with a nonce, are skipped.
+func ocspNonceScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	chain, err := getChain(addr, opts.tlsConfig(hostname))
+	if err != nil {
+		return
+	}
+	if len(chain[0].OCSPServer) == 0 {
+		grade = Skipped
+		return
+	}
+	issuer, err := getIssuer(chain)
+	if err != nil {
+		return
+	}
+
+	nonce := make([]byte, 32)
+	if _, err = rand.Read(nonce); err != nil {
+		return
+	}
+	// The extension's value is itself an OCTET STRING holding the nonce.
+	nonce, err = asn1.Marshal(nonce)
+	if err != nil {
+		return
+	}
+	req, err := ocspNonceRequest(chain[0], issuer, nonce)
+	if err != nil {
+		return
+	}
+
+	status, der, _, err := postOCSP(chain[0].OCSPServer[0], req)
+	if err != nil {
+		return
+	}
+	if status != 200 {
+		grade = Skipped
+		return
+	}
+	resp, err := ocsp.ParseResponse(der, issuer)
+	if _, rejected := err.(ocsp.ResponseError); rejected {
+		grade, err = Skipped, nil
+		return
+	} else if err != nil {
+		return
+	}
+
+	echoed, err := ocspResponseNonce(resp)
+	if err != nil {
+		return
+	}
+	switch {
+	case echoed == nil:
+		grade, output = Warning, "nonce ignored"
+	case bytes.Equal(echoed, nonce):
+		grade, output = Good, "nonce echoed"
+	default:
+		output = "different nonce returned"
+	}
+	return
+}
+
+// The parts of an OCSP response (RFC 6960, section 4.2.1) needed to find the
+// responder and the certificates included with the response, which
+// golang.org/x/crypto/ocsp doesn't expose when there is more than one.
+type (
+	ocspResponseASN1 struct {
+		Status   asn1.Enumerated
+		Response struct {
+			ResponseType asn1.ObjectIdentifier
+			Response     []byte
+		} `asn1:"explicit,tag:0,optional"`
+	}
+	basicOCSPResponseASN1 struct {
+		TBSResponseData    ocspResponseDataASN1
+		SignatureAlgorithm pkix.AlgorithmIdentifier
+		Signature          asn1.BitString
+		Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+	}
+	ocspResponseDataASN1 struct {
+		Version     int `asn1:"optional,default:0,explicit,tag:0"`
+		ResponderID asn1.RawValue
+	}
+)
+
+// ocspResponderID returns the responder ID of a DER-encoded OCSP response, by
+// name or by the SHA-1 hash of its key, along with the certificates included
+// with it.
+func ocspResponderID(der []byte) (name, keyHash []byte, certs []*x509.Certificate, err error) {
+	var resp ocspResponseASN1
+	if _, err = asn1.Unmarshal(der, &resp); err != nil {
+		return
+	}
+	if resp.Status != 0 {
+		err = ocsp.ResponseError{Status: ocsp.ResponseStatus(resp.Status)}
+		return
+	}
+	var basic basicOCSPResponseASN1
+	if _, err = asn1.Unmarshal(resp.Response.Response, &basic); err != nil {
+		return
+	}
+	for _, raw := range basic.Certificates {
+		var cert *x509.Certificate
+		if cert, err = x509.ParseCertificate(raw.FullBytes); err != nil {
+			return
+		}
+		certs = append(certs, cert)
+	}
+
+	id := basic.TBSResponseData.ResponderID
+	switch id.Tag {
+	case 1:
+		name = id.Bytes
+	case 2:
+		if _, err = asn1.Unmarshal(id.Bytes, &keyHash); err != nil {
+			return
+		}
+	default:
+		err = ocsp.ParseError("invalid responder id tag")
+	}
+	return
+}
+
+// identifiesResponder reports whether cert is the responder identified by name
+// or keyHash.
+func identifiesResponder(cert *x509.Certificate, name, keyHash []byte) bool {
+	if len(keyHash) > 0 {
+		var spki struct {
+			Algorithm pkix.AlgorithmIdentifier
+			PublicKey asn1.BitString
+		}
+		if _, err := asn1.Unmarshal(cert.RawSubjectPublicKeyInfo, &spki); err != nil {
+			return false
+		}
+		hash := sha1.Sum(spki.PublicKey.RightAlign())
+		return bytes.Equal(hash[:], keyHash)
+	}
+	return bytes.Equal(cert.RawSubject, name)
+}
+
+// ocspResponderCerts describes the certificates included with the OCSP
+// response for the host's leaf.
+type ocspResponderCerts struct {
+	Source string `json:"source"`
+	// Signer is "issuer" if the leaf's issuer is the responder, and
+	// "delegated" otherwise.
+	Signer string `json:"signer"`
+	// Certs are the subjects of the included certificates, in order.
+	Certs             []string `json:"certs"`
+	IncludesResponder bool     `json:"includes_responder"`
+	// ChainsToIssuer is whether the responder certificate was issued by the
+	// leaf's issuer, directly or through included certificates.
+	ChainsToIssuer bool `json:"chains_to_issuer"`
+}
+
+// ocspResponderCertsScan lists the certificates included with the OCSP
+// response for the host's leaf, stapled or else fetched from its responder,
+// and checks that a response from a delegated responder includes the
+// responder's certificate, issued by the leaf's issuer or by the included
+// certificates in turn. Delegated responses omitting the certificate, which
+// clients then can't verify, or whose responder doesn't chain to the issuer,
+// are warned of. Hosts without a stapled response or responder are skipped.
+func ocspResponderCertsScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	issuer, der, source, err := getOCSPResponse(addr, hostname, opts)
+	if err != nil || der == nil {
+		if err == nil {
+			grade = Skipped
+		}
+		return
+	}
+	name, keyHash, certs, err := ocspResponderID(der)
+	if err != nil {
+		return
+	}
+
+	result := ocspResponderCerts{Source: source, Signer: "delegated", Certs: []string{}}
+	output = &result
+	for _, cert := range certs {
+		result.Certs = append(result.Certs, cert.Subject.CommonName)
+	}
+	if identifiesResponder(issuer, name, keyHash) {
+		result.Signer = "issuer"
+		grade = Good
+		return
+	}
+
+	var responder *x509.Certificate
+	for _, cert := range certs {
+		if identifiesResponder(cert, name, keyHash) {
+			responder = cert
+			break
+		}
+	}
+	if responder == nil {
+		grade = Warning
+		return
+	}
+	result.IncludesResponder = true
+
+	// Follow the included certificates up from the responder to the issuer.
+	for cert, n := responder, 0; n <= len(certs); n++ {
+		if cert.CheckSignatureFrom(issuer) == nil {
+			result.ChainsToIssuer = true
+			break
+		}
+		var parent *x509.Certificate
+		for _, c := range certs {
+			if c != cert && cert.CheckSignatureFrom(c) == nil {
+				parent = c
+				break
+			}
+		}
+		if parent == nil {
+			break
+		}
+		cert = parent
+	}
+
+	if result.ChainsToIssuer {
+		grade = Good
+	} else {
+		grade = Warning
+	}
+	return
+}
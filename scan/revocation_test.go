@@ -0,0 +1,124 @@
+package scan
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// testKey generates a P-256 key for a test certificate.
+func testKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// testCert issues a certificate named cn for key, signed by parent and
+// parentKey, or self-signed if parent is nil.
+func testCert(t *testing.T, cn string, key *ecdsa.PrivateKey, parent *x509.Certificate, parentKey crypto.Signer, usages []x509.ExtKeyUsage) *x509.Certificate {
+	return testCertFromTemplate(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		ExtKeyUsage:           usages,
+		IsCA:                  parent == nil,
+		BasicConstraintsValid: true,
+	}, key, parent, parentKey)
+}
+
+// testCertFromTemplate issues a certificate from template for key, signed by
+// parent and parentKey, or self-signed if parent is nil. A serial number is
+// filled in if the template has none.
+func testCertFromTemplate(t *testing.T, template *x509.Certificate, key *ecdsa.PrivateKey, parent *x509.Certificate, parentKey crypto.Signer) *x509.Certificate {
+	if template.SerialNumber == nil {
+		template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestOCSPSigner(t *testing.T) {
+	var keys [3]*ecdsa.PrivateKey
+	for i := range keys {
+		keys[i] = testKey(t)
+	}
+	issuer := testCert(t, "Issuer", keys[0], nil, nil, nil)
+	delegated := testCert(t, "Delegated", keys[1], issuer, keys[0], []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning})
+	undelegated := testCert(t, "Undelegated", keys[2], issuer, keys[0], []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth})
+
+	for _, test := range []struct {
+		responder *x509.Certificate
+		key       crypto.Signer
+		want      string
+	}{
+		{issuer, keys[0], "issuer"},
+		{delegated, keys[1], "delegated"},
+		{undelegated, keys[2], "unauthorized"},
+	} {
+		der, err := ocsp.CreateResponse(issuer, test.responder, ocsp.Response{
+			Status:       ocsp.Good,
+			SerialNumber: big.NewInt(1),
+			ThisUpdate:   time.Now(),
+			Certificate:  test.responder,
+		}, test.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := ocsp.ParseResponse(der, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if signer, got, _ := ocspSigner(resp, issuer); got != test.want || signer.Subject.CommonName != test.responder.Subject.CommonName {
+			t.Errorf("response signed by %s: got %s by %s, want %s", test.responder.Subject.CommonName, got, signer.Subject.CommonName, test.want)
+		}
+	}
+}
+
+func TestOCSPResponderID(t *testing.T) {
+	var keys [2]*ecdsa.PrivateKey
+	for i := range keys {
+		keys[i] = testKey(t)
+	}
+	issuer := testCert(t, "Issuer", keys[0], nil, nil, nil)
+	delegated := testCert(t, "Delegated", keys[1], issuer, keys[0], []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning})
+
+	der, err := ocsp.CreateResponse(issuer, delegated, ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: big.NewInt(1),
+		ThisUpdate:   time.Now(),
+		Certificate:  delegated,
+	}, keys[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, keyHash, certs, err := ocspResponderID(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 1 || !certs[0].Equal(delegated) {
+		t.Errorf("got %d included certificates, want the delegated responder's", len(certs))
+	}
+	if !identifiesResponder(delegated, name, keyHash) || identifiesResponder(issuer, name, keyHash) {
+		t.Errorf("responder ID doesn't identify only the delegated responder")
+	}
+}
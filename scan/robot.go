@@ -0,0 +1,289 @@
+package scan
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/cloudflare/cfssl/scan/crypto/tls"
+)
+
+// robotTimeout bounds how long each ROBOT probe waits for the host's response.
+var robotTimeout = 5 * time.Second
+
+// robotCiphers are the RSA key exchange cipher suites offered by ROBOT probes.
+var robotCiphers = []uint16{0x002f, 0x0035, 0x009c, 0x009d, 0x003c, 0x003d, 0x000a}
+
+// maxServerFlight bounds the size of the handshake messages read by readServerFlight.
+const maxServerFlight = 1 << 20
+
+var errRSARejected = errors.New("host rejected RSA key exchange")
+
+// robotHello returns a TLS 1.2 ClientHello record offering only robotCiphers.
+func robotHello(hostname string) []byte {
+	hello := make([]byte, 2+32, 2+32+64)
+	hello[0], hello[1] = 0x03, 0x03
+	rand.Read(hello[2:])
+	hello = append(hello, 0) // no session ID
+
+	var suites []byte
+	for _, c := range robotCiphers {
+		suites = append(suites, byte(c>>8), byte(c))
+	}
+	hello = appendVector(hello, 2, suites)
+	hello = append(hello, 1, 0) // null compression
+
+	var exts []byte
+	if hostname != "" {
+		serverName := appendVector([]byte{0}, 2, []byte(hostname))
+		exts = appendExtension(exts, 0, appendVector(nil, 2, serverName))
+	}
+	exts = appendExtension(exts, 0xff01, []byte{0}) // renegotiation_info
+	hello = appendVector(hello, 2, exts)
+
+	return appendVector([]byte{0x16, 0x03, 0x01}, 2, appendVector([]byte{1}, 3, hello))
+}
+
+// readServerFlight reads the host's handshake messages up to its
+// ServerHelloDone, returning the version it selected and its certificates.
+func readServerFlight(conn net.Conn) (version uint16, certs [][]byte, err error) {
+	var buf []byte
+	header := make([]byte, 5)
+	for total := 0; total < maxServerFlight; {
+		if _, err = io.ReadFull(conn, header); err != nil {
+			return
+		}
+		record := make([]byte, binary.BigEndian.Uint16(header[3:]))
+		if _, err = io.ReadFull(conn, record); err != nil {
+			return
+		}
+		total += len(record)
+		switch header[0] {
+		case 0x15:
+			return 0, nil, errRSARejected
+		case 0x16:
+		default:
+			return 0, nil, fmt.Errorf("unexpected record of type %d", header[0])
+		}
+
+		for buf = append(buf, record...); len(buf) >= 4; {
+			length := int(buf[1])<<16 | int(buf[2])<<8 | int(buf[3])
+			if len(buf) < 4+length {
+				break
+			}
+			msg := buf[4 : 4+length]
+			switch buf[0] {
+			case 2: // ServerHello
+				if len(msg) < 2 {
+					return 0, nil, errMalformedHandshake
+				}
+				version = binary.BigEndian.Uint16(msg)
+			case 11: // Certificate
+				if len(msg) < 3 {
+					return 0, nil, errMalformedHandshake
+				}
+				for list := msg[3:]; len(list) >= 3; {
+					certLen := int(list[0])<<16 | int(list[1])<<8 | int(list[2])
+					if len(list) < 3+certLen {
+						return 0, nil, errMalformedHandshake
+					}
+					certs = append(certs, list[3:3+certLen])
+					list = list[3+certLen:]
+				}
+			case 14: // ServerHelloDone
+				return
+			}
+			buf = buf[4+length:]
+		}
+	}
+	return 0, nil, errors.New("host's handshake is too large")
+}
+
+var errMalformedHandshake = errors.New("malformed handshake message")
+
+// robotPayloads are the premaster secrets sent by ROBOT probes, as in the
+// reference robot-detect tool, by name. Each is given the number of bytes of
+// padding needed to fill the modulus.
+var robotPayloads = []struct {
+	name  string
+	build func(pad []byte) []byte
+}{
+	{"correct", func(pad []byte) []byte { return robotPMS([]byte{0, 2}, pad, []byte{0, 3, 3}, nil) }},
+	{"wrong first bytes", func(pad []byte) []byte { return robotPMS([]byte{0x41, 0x17}, pad, []byte{0, 3, 3}, nil) }},
+	{"wrong zero position", func(pad []byte) []byte { return robotPMS([]byte{0, 2}, pad, []byte{0x11}, []byte{0, 0x11}) }},
+	{"no zero separator", func(pad []byte) []byte { return robotPMS([]byte{0, 2}, pad, []byte{0x11, 0x11, 0x11}, nil) }},
+	{"wrong version", func(pad []byte) []byte { return robotPMS([]byte{0, 2}, pad, []byte{0, 2, 2}, nil) }},
+}
+
+// robotSecret is the body of the premaster secret sent by ROBOT probes.
+var robotSecret = []byte{
+	0xaa, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66,
+	0x77, 0x88, 0x99, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99, 0x11, 0x22, 0x33, 0x44,
+	0x55, 0x66, 0x77, 0x88, 0x99, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99,
+}
+
+// robotPMS assembles a padded premaster secret: the block type, padding,
+// separator and version, the secret, and a suffix.
+func robotPMS(blockType, pad, separator, suffix []byte) []byte {
+	pms := append(append([]byte{}, blockType...), pad...)
+	pms = append(append(pms, separator...), robotSecret...)
+	return append(pms, suffix...)
+}
+
+// robotPadding returns padding filling a modulus of size bytes around a
+// premaster secret, in the pattern used by robot-detect.
+func robotPadding(size int) []byte {
+	pad := make([]byte, size-2-3-len(robotSecret))
+	for i := range pad {
+		pad[i] = []byte{0xab, 0xcd}[i%2]
+	}
+	return pad
+}
+
+// robotResponse sends the host a ClientKeyExchange encrypting pms under key,
+// followed by ChangeCipherSpec and a bogus Finished, describing how it responds.
+func robotResponse(addr, hostname string, key *rsa.PublicKey, pms []byte) (string, error) {
+	conn, err := Dialer.Dial(Network, addr)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(robotTimeout))
+
+	if _, err = conn.Write(robotHello(hostname)); err != nil {
+		return "", err
+	}
+	version, _, err := readServerFlight(conn)
+	if err != nil {
+		return "", err
+	}
+
+	// Textbook RSA, since the padding is deliberately malformed.
+	m := new(big.Int).SetBytes(pms)
+	c := m.Exp(m, big.NewInt(int64(key.E)), key.N).Bytes()
+	ciphertext := make([]byte, (key.N.BitLen()+7)/8)
+	copy(ciphertext[len(ciphertext)-len(c):], c)
+
+	v := []byte{byte(version >> 8), byte(version)}
+	cke := appendVector([]byte{0x10}, 3, appendVector(nil, 2, ciphertext))
+	flight := appendVector([]byte{0x16, v[0], v[1]}, 2, cke)
+	flight = append(flight, 0x14, v[0], v[1], 0, 1, 1)
+	flight = appendVector(append(flight, 0x16, v[0], v[1]), 2, make([]byte, 64))
+	if _, err = conn.Write(flight); err != nil {
+		return "connection reset", nil
+	}
+
+	response := make([]byte, 7)
+	_, rerr := io.ReadFull(conn, response)
+	switch e, ok := rerr.(net.Error); {
+	case ok && e.Timeout():
+		return "timeout", nil
+	case rerr == io.EOF:
+		return "connection closed", nil
+	case rerr == io.ErrUnexpectedEOF:
+		return fmt.Sprintf("closed after record of type %d", response[0]), nil
+	case rerr != nil:
+		return "connection reset", nil
+	case response[0] == 0x15:
+		return fmt.Sprintf("%s alert", tls.AlertText(response[6])), nil
+	}
+	return fmt.Sprintf("record of type %d", response[0]), nil
+}
+
+// robot reports the outcome of ROBOT probes and the responses they elicited.
+type robot struct {
+	Result string `json:"result"`
+	// Oracle is "strong" if the host distinguishes between malformed
+	// paddings, allowing a practical attack, and "weak" otherwise.
+	Oracle    string            `json:"oracle,omitempty"`
+	Responses map[string]string `json:"responses"`
+}
+
+// robotScan probes for the ROBOT vulnerability (Return Of Bleichenbacher's
+// Oracle Threat) by sending the host premaster secrets with correct and
+// malformed PKCS #1 v1.5 padding under its RSA key and comparing its responses.
+// Hosts responding differently to them are vulnerable and graded Bad. The
+// probes are repeated, and hosts responding inconsistently are warned of as
+// inconclusive. Hosts without RSA key exchange are skipped.
+func robotScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	conn, err := Dialer.Dial(Network, addr)
+	if err != nil {
+		return
+	}
+	conn.SetDeadline(time.Now().Add(robotTimeout))
+	_, err = conn.Write(robotHello(hostname))
+	var certs [][]byte
+	if err == nil {
+		_, certs, err = readServerFlight(conn)
+	}
+	conn.Close()
+	if err == errRSARejected {
+		grade, err = Skipped, nil
+		return
+	} else if err != nil {
+		return
+	}
+	if len(certs) == 0 {
+		err = errNoLeaf
+		return
+	}
+
+	leaf, err := x509.ParseCertificate(certs[0])
+	if err != nil {
+		return
+	}
+	key, ok := leaf.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		grade = Skipped
+		return
+	}
+
+	pad := robotPadding((key.N.BitLen() + 7) / 8)
+	result := robot{Responses: make(map[string]string)}
+	responses := make([]string, len(robotPayloads))
+	consistent := true
+	for run := 0; run < 2; run++ {
+		for i, payload := range robotPayloads {
+			opts.progress(run*len(robotPayloads)+i, 2*len(robotPayloads))
+			var response string
+			if response, err = robotResponse(addr, hostname, key, payload.build(pad)); err != nil {
+				return
+			}
+			if run > 0 && response != responses[i] {
+				consistent = false
+			}
+			responses[i] = response
+			result.Responses[payload.name] = response
+		}
+	}
+	opts.progress(2*len(robotPayloads), 2*len(robotPayloads))
+	output = &result
+
+	identical := true
+	for _, response := range responses[1:] {
+		if response != responses[0] {
+			identical = false
+		}
+	}
+	switch {
+	case !consistent:
+		result.Result, grade = "inconclusive", Warning
+	case identical:
+		result.Result, grade = "not vulnerable", Good
+	default:
+		result.Result = "vulnerable"
+		if responses[1] == responses[2] && responses[2] == responses[3] {
+			result.Oracle = "weak"
+		} else {
+			result.Oracle = "strong"
+		}
+	}
+	return
+}
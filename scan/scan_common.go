@@ -2,8 +2,10 @@ package scan
 
 import (
 	"crypto/x509"
+	"fmt"
 	"net"
 	"net/http"
+	"net/url"
 	"regexp"
 	"sync"
 	"time"
@@ -18,12 +20,31 @@ var (
 	Network = "tcp"
 	// Dialer is the default dialer to use, with a 1s timeout.
 	Dialer = &net.Dialer{Timeout: time.Second}
-	// Client is the default HTTP Client.
-	Client = &http.Client{Transport: &http.Transport{Dial: Dialer.Dial}}
+	// Client is the default HTTP Client. Unlike http.DefaultClient, it ignores
+	// HTTP_PROXY and related environment variables; use SetHTTPProxy to route
+	// its requests through a proxy.
+	Client = &http.Client{Transport: newTransport(nil)}
 	// RootCAs defines the default root certificate authorities to be used for scan.
 	RootCAs *x509.CertPool
 )
 
+// newTransport returns the transport used by Client, sending requests through
+// the proxy at proxyURL or, if it is nil, directly.
+func newTransport(proxyURL *url.URL) *http.Transport {
+	transport := &http.Transport{Dial: Dialer.Dial}
+	if proxyURL != nil {
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	return transport
+}
+
+// SetHTTPProxy configures Client to send all requests through the HTTP proxy
+// at u, or directly if u is nil, replacing its transport. The environment is
+// never consulted.
+func SetHTTPProxy(u *url.URL) {
+	Client.Transport = newTransport(u)
+}
+
 // Grade gives a subjective rating of the host's success in a scan.
 type Grade int
 
@@ -58,12 +79,14 @@ func (g Grade) String() string {
 type Output interface{}
 
 // multiscan scans all DNS addresses returned for the host, returning the lowest grade
-// and the concatenation of all the output.
-func multiscan(host string, scan func(string) (Grade, Output, error)) (grade Grade, output Output, err error) {
+// and the concatenation of all the output. If opts overrides the host's address,
+// only that address is scanned.
+func multiscan(host string, opts *Options, scan func(string) (Grade, Output, error)) (grade Grade, output Output, err error) {
 	domain, port, _ := net.SplitHostPort(host)
 	var addrs []string
-	addrs, err = net.LookupHost(domain)
-	if err != nil {
+	if ip := opts.overrideIP(); ip != "" {
+		addrs = []string{ip}
+	} else if addrs, err = net.LookupHost(domain); err != nil {
 		return
 	}
 
@@ -90,17 +113,146 @@ func multiscan(host string, scan func(string) (Grade, Output, error)) (grade Gra
 	return
 }
 
+// Options contains per-scan parameters that individual scanners may consult.
+type Options struct {
+	// Progress, if set, is called by the enumeration scanners after each
+	// probe with the number of probes done so far and the total expected.
+	Progress func(done, total int)
+	// OverrideAddr, if set, is an IP address, optionally with a port, that is
+	// dialed in place of resolving the host through DNS, like curl's --resolve.
+	// The host's name is still used for SNI and certificate verification.
+	OverrideAddr string
+	// SPKIPins is a set of base64-encoded SHA-256 hashes of SubjectPublicKeyInfos,
+	// as in HPKP pin-sha256 directives, at least one of which the host's
+	// chain is expected to match.
+	SPKIPins []string
+	// RevokedSerials, if set, is a pre-downloaded revocation snapshot the
+	// host's leaf is checked against without any network requests.
+	RevokedSerials RevocationSet
+	// RequiredPolicyOID, if set, is a dotted certificate policy OID, such as
+	// an EV policy, that the host's leaf must assert.
+	RequiredPolicyOID string
+	// AllowCertless indicates the host is expected to authenticate without an
+	// X.509 certificate, as with PSK or raw public keys.
+	AllowCertless bool
+	// ClientHello, if set, shapes the ClientHello sent by scanners performing
+	// ordinary handshakes, so that the scan presents a particular client's
+	// fingerprint. Enumeration scanners still control their own ClientHellos.
+	ClientHello *ClientHelloSpec
+	// HealthPath is the path requested by the HealthCheck scanner, "/" if empty.
+	HealthPath string
+	// Baseline, if set, is a previous record of the host's handshake, as
+	// returned by RecordBaseline, that the BaselineDiff scanner compares
+	// the host's current handshake with.
+	Baseline *Baseline
+	// Ports are the ports the PortConsistency scanner compares with the
+	// scanned one, DefaultTLSPorts if empty.
+	Ports []int
+	// Holidays are the dates, besides weekends, the ExpiryRiskWindow scanner
+	// treats as risky days for a certificate to expire on. Only the local
+	// date of each is considered.
+	Holidays []time.Time
+	// Subdomains are labels, such as "api" or "mail", that the WWWApex
+	// scanner also checks the host's leaf covers under the apex.
+	Subdomains []string
+	// ComplianceProfile names the entry of ComplianceProfiles the
+	// ComplianceProfile scanner evaluates the host against. The scanner is
+	// skipped if it is empty.
+	ComplianceProfile string
+}
+
+// ClientHelloSpec describes the parts of a ClientHello that can be customized
+// to mimic a particular client. Empty fields keep cf-tls's defaults. The order
+// of the extensions themselves is fixed by cf-tls.
+type ClientHelloSpec struct {
+	// CipherSuites are the cipher suites offered, in order of preference.
+	// Suites cf-tls doesn't implement are left out of the handshake.
+	CipherSuites []uint16
+	// Curves are the elliptic curves offered, in order of preference.
+	Curves []tls.CurveID
+	// MinVersion and MaxVersion bound the TLS versions offered.
+	MinVersion, MaxVersion uint16
+	// NextProtos are the ALPN protocols offered, in order of preference.
+	NextProtos []string
+}
+
+// RevocationSet reports whether a certificate is revoked. It may be backed by
+// a list of serial numbers or a more compact structure such as a CRLite filter.
+type RevocationSet interface {
+	Revoked(cert *x509.Certificate) bool
+}
+
+// SerialSet is a RevocationSet of revoked serial numbers, keyed by their
+// lowercase hexadecimal encoding without leading zeros.
+type SerialSet map[string]bool
+
+// Revoked reports whether the certificate's serial number is in the set.
+func (s SerialSet) Revoked(cert *x509.Certificate) bool {
+	return s[cert.SerialNumber.Text(16)]
+}
+
+// overrideIP returns the IP address of OverrideAddr, or "" if it isn't set to one.
+func (opts *Options) overrideIP() string {
+	ip := opts.OverrideAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	if net.ParseIP(ip) == nil {
+		return ""
+	}
+	return ip
+}
+
+// hostIPs returns the IP address of OverrideAddr if it's set to one, and
+// otherwise the addresses hostname resolves to.
+func (opts *Options) hostIPs(hostname string) ([]net.IP, error) {
+	if ip := net.ParseIP(opts.overrideIP()); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	return net.LookupIP(hostname)
+}
+
+// progress reports enumeration progress to the Progress callback, if any.
+func (opts *Options) progress(done, total int) {
+	if opts.Progress != nil {
+		opts.Progress(done, total)
+	}
+}
+
 // Scanner describes a type of scan to perform on a host.
 type Scanner struct {
 	// Description describes the nature of the scan to be performed.
 	Description string `json:"description"`
 	// scan is the function that scans the given host and provides a Grade and Output.
-	scan func(string, string) (Grade, Output, error)
+	scan func(string, string, *Options) (Grade, Output, error)
+	// Summarize, if set, renders the scanner's Output as a one-line human-readable summary.
+	Summarize func(Output) string `json:"-"`
+}
+
+// Summary renders the given Output of the scanner as a one-line human-readable
+// summary, falling back to its default formatting if the scanner has no Summarize.
+func (s *Scanner) Summary(output Output) string {
+	if output == nil {
+		return ""
+	}
+	if s.Summarize != nil {
+		return s.Summarize(output)
+	}
+	return fmt.Sprint(output)
 }
 
 // Scan performs the scan to be performed on the given host and stores its result.
 func (s *Scanner) Scan(addr, hostname string) (Grade, Output, error) {
-	grade, output, err := s.scan(addr, hostname)
+	return s.ScanWithOptions(addr, hostname, nil)
+}
+
+// ScanWithOptions performs the scan on the given host using the given
+// per-scan Options, which may be nil.
+func (s *Scanner) ScanWithOptions(addr, hostname string, opts *Options) (Grade, Output, error) {
+	if opts == nil {
+		opts = new(Options)
+	}
+	grade, output, err := s.scan(addr, hostname, opts)
 	if err != nil {
 		log.Debugf("scan: %v", err)
 		return grade, output, err
@@ -125,6 +277,8 @@ var Default = FamilySet{
 	"TLSHandshake": TLSHandshake,
 	"TLSSession":   TLSSession,
 	"PKI":          PKI,
+	"Revocation":   Revocation,
+	"HTTP":         HTTP,
 	"Broad":        Broad,
 }
 
@@ -148,15 +302,17 @@ type context struct {
 	sync.WaitGroup
 	addr, hostname              string
 	familyRegexp, scannerRegexp *regexp.Regexp
+	opts                        *Options
 	resultChan                  chan *Result
 }
 
-func newContext(addr, hostname string, familyRegexp, scannerRegexp *regexp.Regexp, numFamilies int) *context {
+func newContext(addr, hostname string, familyRegexp, scannerRegexp *regexp.Regexp, opts *Options, numFamilies int) *context {
 	ctx := &context{
 		addr:          addr,
 		hostname:      hostname,
 		familyRegexp:  familyRegexp,
 		scannerRegexp: scannerRegexp,
+		opts:          opts,
 		resultChan:    make(chan *Result),
 	}
 	ctx.Add(numFamilies)
@@ -187,29 +343,26 @@ func (ctx *context) newfamilyContext(numScanners int) *familyContext {
 }
 
 func (ctx *context) copyResults(timeout time.Duration) map[string]FamilyResult {
-	results := make(map[string]FamilyResult)
+	var results Collector
 	for {
 		var result *Result
 		select {
 		case <-time.After(timeout):
 			log.Warningf("Scan timed out after %v", timeout)
-			return results
+			return results.Snapshot()
 		case result = <-ctx.resultChan:
 			if result == nil {
-				return results
+				return results.Snapshot()
 			}
 		}
 
-		if results[result.Family] == nil {
-			results[result.Family] = make(FamilyResult)
-		}
-		results[result.Family][result.Scanner] = result.ScannerResult
+		results.Add(result.Family, result.Scanner, result.ScannerResult)
 	}
 }
 
 func (familyCtx *familyContext) runScanner(familyName, scannerName string, scanner *Scanner) {
 	if familyCtx.ctx.familyRegexp.MatchString(familyName) && familyCtx.ctx.scannerRegexp.MatchString(scannerName) {
-		grade, output, err := scanner.Scan(familyCtx.ctx.addr, familyCtx.ctx.hostname)
+		grade, output, err := scanner.ScanWithOptions(familyCtx.ctx.addr, familyCtx.ctx.hostname, familyCtx.ctx.opts)
 		result := &Result{
 			familyName,
 			scannerName,
@@ -226,21 +379,40 @@ func (familyCtx *familyContext) runScanner(familyName, scannerName string, scann
 	familyCtx.Done()
 }
 
-// RunScans iterates over AllScans, running each scan that matches the family
-// and scanner regular expressions concurrently.
-func (fs FamilySet) RunScans(host, ip, family, scanner string, timeout time.Duration) (map[string]FamilyResult, error) {
+// dialAddr returns the address to dial for host, given as a hostname with an
+// optional port defaulting to 443, and the host's name. The address uses the
+// OverrideAddr option when it's set.
+func (opts *Options) dialAddr(host string) (addr, hostname string) {
 	hostname, port, err := net.SplitHostPort(host)
 	if err != nil {
 		hostname = host
 		port = "443"
 	}
 
-	var addr string
-	if net.ParseIP(ip) != nil {
+	addr = net.JoinHostPort(hostname, port)
+	if ip := opts.overrideIP(); ip != "" {
+		if _, overridePort, err := net.SplitHostPort(opts.OverrideAddr); err == nil {
+			port = overridePort
+		}
 		addr = net.JoinHostPort(ip, port)
-	} else {
-		addr = net.JoinHostPort(hostname, port)
 	}
+	return
+}
+
+// RunScans iterates over AllScans, running each scan that matches the family
+// and scanner regular expressions concurrently.
+func (fs FamilySet) RunScans(host, ip, family, scanner string, timeout time.Duration) (map[string]FamilyResult, error) {
+	return fs.RunScansWithOptions(host, family, scanner, timeout, &Options{OverrideAddr: ip})
+}
+
+// RunScansWithOptions is like RunScans, but passes the given per-scan Options,
+// which may be nil, to each scanner.
+func (fs FamilySet) RunScansWithOptions(host, family, scanner string, timeout time.Duration, opts *Options) (map[string]FamilyResult, error) {
+	if opts == nil {
+		opts = new(Options)
+	}
+
+	addr, hostname := opts.dialAddr(host)
 
 	familyRegexp, err := regexp.Compile(family)
 	if err != nil {
@@ -252,15 +424,21 @@ func (fs FamilySet) RunScans(host, ip, family, scanner string, timeout time.Dura
 		return nil, err
 	}
 
-	ctx := newContext(addr, hostname, familyRegexp, scannerRegexp, len(fs))
+	return fs.runScans(addr, hostname, familyRegexp, scannerRegexp, opts).copyResults(timeout), nil
+}
+
+// runScans concurrently starts each scan of addr that matches the family and
+// scanner regular expressions. The returned context's resultChan yields each
+// result as its scan completes, and is closed once all have.
+func (fs FamilySet) runScans(addr, hostname string, familyRegexp, scannerRegexp *regexp.Regexp, opts *Options) *context {
+	ctx := newContext(addr, hostname, familyRegexp, scannerRegexp, opts, len(fs))
 	for familyName, family := range fs {
 		familyCtx := ctx.newfamilyContext(len(family.Scanners))
 		for scannerName, scanner := range family.Scanners {
 			go familyCtx.runScanner(familyName, scannerName, scanner)
 		}
 	}
-
-	return ctx.copyResults(timeout), nil
+	return ctx
 }
 
 // LoadRootCAs loads the default root certificate authorities from file.
@@ -272,6 +450,20 @@ func LoadRootCAs(caBundleFile string) (err error) {
 	return
 }
 
+// tlsConfig returns the default TLS configuration for hostname with the
+// ClientHelloSpec, if any, applied.
+func (opts *Options) tlsConfig(hostname string) *tls.Config {
+	config := defaultTLSConfig(hostname)
+	if spec := opts.ClientHello; spec != nil {
+		config.CipherSuites = spec.CipherSuites
+		config.CurvePreferences = spec.Curves
+		config.MinVersion = spec.MinVersion
+		config.MaxVersion = spec.MaxVersion
+		config.NextProtos = spec.NextProtos
+	}
+	return config
+}
+
 func defaultTLSConfig(hostname string) *tls.Config {
 	return &tls.Config{
 		ServerName:         hostname,
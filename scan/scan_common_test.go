@@ -7,7 +7,7 @@ import (
 
 var TestingScanner = &Scanner{
 	Description: "Tests common scan functions",
-	scan: func(addr, hostname string) (Grade, Output, error) {
+	scan: func(addr, hostname string, opts *Options) (Grade, Output, error) {
 		switch addr {
 		case "bad.example.com:443":
 			return Bad, "bad.com", nil
@@ -64,3 +64,20 @@ func TestCommon(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestOverrideIP(t *testing.T) {
+	for overrideAddr, ip := range map[string]string{
+		"":                "",
+		"192.0.2.1":       "192.0.2.1",
+		"192.0.2.1:8443":  "192.0.2.1",
+		"2001:db8::1":     "2001:db8::1",
+		"[2001:db8::1]:0": "2001:db8::1",
+		"example.com":     "",
+		"example.com:443": "",
+	} {
+		opts := &Options{OverrideAddr: overrideAddr}
+		if got := opts.overrideIP(); got != ip {
+			t.Errorf("overrideIP of %q = %q, want %q", overrideAddr, got, ip)
+		}
+	}
+}
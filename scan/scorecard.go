@@ -0,0 +1,295 @@
+package scan
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/cfssl/scan/crypto/tls"
+)
+
+// Weights of each component of the overall ScoreCard score, as percentages.
+var (
+	ScoreProtocolWeight    = 30
+	ScoreKeyExchangeWeight = 30
+	ScoreCipherWeight      = 40
+)
+
+// Score is an aggregate evaluation of a host's TLS configuration. Each
+// component is scored out of 100 and Overall is their weighted average.
+type Score struct {
+	Protocol    int `json:"protocol"`
+	KeyExchange int `json:"key_exchange"`
+	Cipher      int `json:"cipher"`
+	Overall     int `json:"overall"`
+	// Grade is a letter grade from A+ to F derived from Overall, possibly
+	// capped by the problems listed in Caps.
+	Grade string     `json:"grade"`
+	Caps  []ScoreCap `json:"caps,omitempty"`
+}
+
+// A ScoreCap is a problem limiting a Score's grade to at most Grade.
+type ScoreCap struct {
+	Grade  string `json:"grade"`
+	Reason string `json:"reason"`
+}
+
+// ScoreCard enumerates the host's protocol versions and cipher suites and
+// checks its certificate to compute a single comparable Score.
+func ScoreCard(host string, opts *Options) (*Score, error) {
+	if opts == nil {
+		opts = new(Options)
+	}
+	addr, hostname := opts.dialAddr(host)
+
+	var suites []uint16
+	for id := range tls.TLS13CipherSuites {
+		suites = append(suites, id)
+	}
+	var tls13Suite uint16
+	if serverHello, ok, herr := tls13Hello(addr, hostname, opts, suites, tls13Groups); herr == nil && ok {
+		tls13Suite = serverHello.CipherSuite
+	}
+
+	// Hosts accepting only TLS 1.3 negotiate nothing with cipherSuiteScan, and
+	// can only give up their chain to crypto/tls.
+	_, output, err := cipherSuiteScan(addr, hostname, opts)
+	if err == errNoCipherSuites && tls13Suite != 0 {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cvList, _ := output.(cipherVersionList)
+
+	chain, err := getChain(addr, opts.tlsConfig(hostname))
+	if err != nil && tls13Suite != 0 {
+		chain, err = stdChain(addr, hostname)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return computeScore(cvList, tls13Suite, chain, hostname, time.Now()), nil
+}
+
+// protocolScore scores a single protocol version.
+func protocolScore(vers uint16) int {
+	switch vers {
+	case tls.VersionSSL30:
+		return 80
+	case tls.VersionTLS10:
+		return 90
+	case tls.VersionTLS11:
+		return 95
+	case tls.VersionTLS12, tls.VersionTLS13:
+		return 100
+	}
+	return 0
+}
+
+// curveBits are the sizes, in bits, of the named elliptic curves.
+var curveBits = map[tls.CurveID]int{
+	1: 163, 2: 163, 3: 163, 4: 193, 5: 193, 6: 233, 7: 233, 8: 239,
+	9: 283, 10: 283, 11: 409, 12: 409, 13: 571, 14: 571,
+	15: 160, 16: 160, 17: 160, 18: 192, 19: 192, 20: 224, 21: 224,
+	22: 256, 23: 256, 24: 384, 25: 521,
+	26: 256, 27: 384, 28: 512, 29: 256, 30: 448,
+}
+
+// keyExchangeScore scores the strength of the key exchange as the weaker of
+// the certificate's public key and the weakest ECDHE curve the host accepts,
+// with elliptic curve keys rated by their equivalent RSA key size. The group
+// sizes of DHE cipher suites aren't enumerated, so aren't scored.
+func keyExchangeScore(cert *x509.Certificate, cvList cipherVersionList) int {
+	var bits int
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		bits = key.N.BitLen()
+	case *ecdsa.PublicKey:
+		bits = key.Params().BitSize * 12
+	}
+	for _, cv := range cvList {
+		for _, d := range cv.data {
+			for _, curve := range d.curves {
+				if size, ok := curveBits[curve]; ok && size*12 < bits {
+					bits = size * 12
+				}
+			}
+		}
+	}
+	return keyBitsScore(bits)
+}
+
+// keyBitsScore scores a key of the given RSA-equivalent size.
+func keyBitsScore(bits int) int {
+	switch {
+	case bits < 512:
+		return 20
+	case bits < 1024:
+		return 40
+	case bits < 2048:
+		return 80
+	case bits < 4096:
+		return 90
+	}
+	return 100
+}
+
+// cipherBits returns the symmetric key strength, in bits, of a cipher suite.
+func cipherBits(cipherID uint16) int {
+	suite, ok := tls.CipherSuites[cipherID]
+	if !ok {
+		suite = tls.TLS13CipherSuites[cipherID]
+	}
+	name := suite.Name
+	switch {
+	case strings.Contains(name, "_WITH_NULL_"):
+		return 0
+	case strings.Contains(name, "_40") || strings.Contains(name, "EXPORT"):
+		return 40
+	case strings.Contains(name, "_WITH_DES_"):
+		return 56
+	case strings.Contains(name, "3DES"):
+		return 112
+	case strings.Contains(name, "_256") || strings.Contains(name, "CHACHA20"):
+		return 256
+	}
+	return 128
+}
+
+// cipherScore scores a cipher suite by the strength of its symmetric key.
+func cipherScore(cipherID uint16) int {
+	switch bits := cipherBits(cipherID); {
+	case bits == 0:
+		return 0
+	case bits < 128:
+		return 20
+	case bits < 256:
+		return 80
+	}
+	return 100
+}
+
+// computeScore scores the cipher suites and versions found by cipherSuiteScan,
+// and the TLS 1.3 cipher suite the host negotiates, if any, along with the
+// host's chain, as valid for hostname at time now. Protocol and cipher
+// components average the best and worst supported options.
+func computeScore(cvList cipherVersionList, tls13Suite uint16, chain []*x509.Certificate, hostname string, now time.Time) *Score {
+	score := new(Score)
+
+	bestProto, worstProto := 0, 100
+	bestCipher, worstCipher := 0, 100
+	addProto := func(p int) {
+		if p > bestProto {
+			bestProto = p
+		}
+		if p < worstProto {
+			worstProto = p
+		}
+	}
+	addCipher := func(s int) {
+		if s > bestCipher {
+			bestCipher = s
+		}
+		if s < worstCipher {
+			worstCipher = s
+		}
+	}
+	if tls13Suite != 0 {
+		addProto(protocolScore(tls.VersionTLS13))
+		addCipher(cipherScore(tls13Suite))
+	}
+
+	allForwardSecret, legacyVersions := true, false
+	for _, cv := range cvList {
+		addCipher(cipherScore(cv.cipherID))
+		if !tls.CipherSuites[cv.cipherID].ForwardSecret {
+			allForwardSecret = false
+		}
+		for _, d := range cv.data {
+			addProto(protocolScore(d.versionID))
+			if d.versionID < tls.VersionTLS12 {
+				legacyVersions = true
+			}
+			if d.versionID == tls.VersionSSL30 {
+				score.cap("C", "SSL 3.0 supported")
+			}
+		}
+		if strings.Contains(tls.CipherSuites[cv.cipherID].Name, "RC4") {
+			score.cap("B", "RC4 supported")
+		}
+	}
+	if len(cvList) == 0 && tls13Suite == 0 {
+		worstProto, worstCipher = 0, 0
+	}
+	score.Protocol = (bestProto + worstProto) / 2
+	score.Cipher = (bestCipher + worstCipher) / 2
+	score.KeyExchange = keyExchangeScore(chain[0], cvList)
+	score.Overall = (score.Protocol*ScoreProtocolWeight +
+		score.KeyExchange*ScoreKeyExchangeWeight +
+		score.Cipher*ScoreCipherWeight) / (ScoreProtocolWeight + ScoreKeyExchangeWeight + ScoreCipherWeight)
+
+	if verr := validityError(chain, now); verr != nil {
+		score.cap("F", verr.Error())
+	} else if err := chain[0].VerifyHostname(hostname); err != nil {
+		score.cap("F", err.Error())
+	} else if _, err := buildChains(chain); err != nil {
+		score.cap("F", "certificate not trusted")
+	}
+
+	grade := letterGrade(score.Overall)
+	if grade == "A" && allForwardSecret && !legacyVersions {
+		grade = "A+"
+	}
+	for _, c := range score.Caps {
+		if gradeRank(c.Grade) > gradeRank(grade) {
+			grade = c.Grade
+		}
+	}
+	score.Grade = grade
+	return score
+}
+
+// cap records a problem limiting the overall grade to at most grade.
+func (s *Score) cap(grade, reason string) {
+	s.Caps = append(s.Caps, ScoreCap{grade, reason})
+}
+
+// letterGrades are the letter grades in order, with the minimum overall score for each.
+var letterGrades = []struct {
+	grade    string
+	minScore int
+}{
+	{"A", 80},
+	{"B", 65},
+	{"C", 50},
+	{"D", 35},
+	{"E", 20},
+	{"F", 0},
+}
+
+// letterGrade returns the letter grade of an overall score.
+func letterGrade(overall int) string {
+	for _, g := range letterGrades {
+		if overall >= g.minScore {
+			return g.grade
+		}
+	}
+	return "F"
+}
+
+// gradeRank orders letter grades from best (A+) to worst (F).
+func gradeRank(grade string) int {
+	if grade == "A+" {
+		return -1
+	}
+	for i, g := range letterGrades {
+		if g.grade == grade {
+			return i
+		}
+	}
+	return len(letterGrades)
+}
@@ -0,0 +1,63 @@
+package scan
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/scan/crypto/tls"
+)
+
+func TestComputeScore(t *testing.T) {
+	now := time.Now()
+	cert := testCertFromTemplate(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "example.com"},
+		DNSNames:              []string{"example.com"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}, testKey(t), nil, nil)
+	chain := []*x509.Certificate{cert}
+
+	defer func(roots *x509.CertPool) { RootCAs = roots }(RootCAs)
+	RootCAs = x509.NewCertPool()
+	RootCAs.AddCert(cert)
+
+	modern := cipherVersionList{
+		{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, []cipherDatum{{versionID: tls.VersionTLS12}}},
+		{tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA, []cipherDatum{{versionID: tls.VersionTLS12}}},
+	}
+	withSSL3 := append(cipherVersionList{
+		{tls.TLS_RSA_WITH_AES_128_CBC_SHA, []cipherDatum{{versionID: tls.VersionTLS12}, {versionID: tls.VersionSSL30}}},
+	}, modern...)
+
+	weakCurve := cipherVersionList{
+		{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, []cipherDatum{{tls.VersionTLS12, []tls.CurveID{tls.CurveP256, 16}}}},
+	}
+
+	tests := []struct {
+		name        string
+		cvList      cipherVersionList
+		tls13Suite  uint16
+		host        string
+		now         time.Time
+		grade       string
+		keyExchange int
+	}{
+		{"modern", modern, 0, "example.com", now, "A+", 90},
+		{"ssl3", withSSL3, 0, "example.com", now, "C", 90},
+		{"expired", modern, 0, "example.com", now.Add(2 * time.Hour), "F", 90},
+		{"wrong host", modern, 0, "example.org", now, "F", 90},
+		{"tls13 only", nil, 0x1301, "example.com", now, "A+", 90},
+		{"weak curve", weakCurve, 0, "example.com", now, "A+", 80},
+	}
+	for _, test := range tests {
+		score := computeScore(test.cvList, test.tls13Suite, chain, test.host, test.now)
+		if score.Grade != test.grade || score.KeyExchange != test.keyExchange {
+			t.Errorf("%s: grade = %s, key exchange = %d, want %s, %d (%+v)", test.name, score.Grade, score.KeyExchange, test.grade, test.keyExchange, score)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package scan
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/certificate-transparency-go"
+	cttls "github.com/google/certificate-transparency-go/tls"
+	ctx509 "github.com/google/certificate-transparency-go/x509"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/scan/crypto/tls"
+)
+
+// sctListOID identifies the X.509 extension embedding SCTs in a certificate
+// (RFC 6962, section 3.3).
+var sctListOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+// How an SCT was delivered to the client.
+const (
+	sctEmbedded = "embedded"
+	sctTLS      = "tls"
+	sctOCSP     = "ocsp"
+)
+
+// A deliveredSCT is an SCT for the host's leaf along with how it was delivered.
+type deliveredSCT struct {
+	ct.SignedCertificateTimestamp
+	Source string
+}
+
+// time returns the time at which the log issued the SCT.
+func (s *deliveredSCT) time() time.Time {
+	return time.Unix(0, int64(s.Timestamp)*int64(time.Millisecond))
+}
+
+// getSCTs handshakes with the host, returning its chain and the SCTs for its
+// leaf, whether embedded in it, sent in the signed_certificate_timestamp
+// extension, or included in a stapled OCSP response. SCTs that can't be
+// parsed are left out.
+func getSCTs(addr, hostname string, opts *Options) (chain []*x509.Certificate, scts []deliveredSCT, err error) {
+	conn, err := tls.DialWithDialer(Dialer, Network, addr, opts.tlsConfig(hostname))
+	if err != nil {
+		return
+	}
+	conn.Close()
+
+	state := conn.ConnectionState()
+	leaf, err := leafCert(state)
+	if err != nil {
+		return
+	}
+	chain = state.PeerCertificates
+
+	for _, ext := range leaf.Extensions {
+		var list []byte
+		if !ext.Id.Equal(sctListOID) {
+			continue
+		}
+		if _, uerr := asn1.Unmarshal(ext.Value, &list); uerr != nil {
+			continue
+		}
+		if embedded, derr := helpers.DeserializeSCTList(list); derr == nil {
+			for _, sct := range embedded {
+				scts = append(scts, deliveredSCT{sct, sctEmbedded})
+			}
+		}
+	}
+
+	for _, raw := range state.SignedCertificateTimestamps {
+		var sct ct.SignedCertificateTimestamp
+		if rest, uerr := cttls.Unmarshal(raw, &sct); uerr == nil && len(rest) == 0 {
+			scts = append(scts, deliveredSCT{sct, sctTLS})
+		}
+	}
+
+	if len(state.OCSPResponse) > 0 {
+		if resp, perr := ocsp.ParseResponse(state.OCSPResponse, nil); perr == nil {
+			if stapled, serr := helpers.SCTListFromOCSPResponse(resp); serr == nil {
+				for _, sct := range stapled {
+					scts = append(scts, deliveredSCT{sct, sctOCSP})
+				}
+			}
+		}
+	}
+	return
+}
+
+var (
+	// CTLogListURL is where the list of CT logs recognized by Chrome is
+	// fetched from, in the v3 log list format. It may instead be the path of a
+	// local log list file.
+	CTLogListURL = "https://www.gstatic.com/ct/log_list/v3/log_list.json"
+	// CTLogListMaxAge is how long a loaded log list is used before it's loaded
+	// again, so that long-running scanners see logs' state changes.
+	CTLogListMaxAge = 24 * time.Hour
+
+	ctLogLists   = make(map[string]loadedCTLogList)
+	ctLogListsMu sync.Mutex
+)
+
+// loadedCTLogList is a log list along with when it was loaded.
+type loadedCTLogList struct {
+	logs   ctLogList
+	loaded time.Time
+}
+
+// A ctLog is a CT log from the log list.
+type ctLog struct {
+	Description string `json:"description"`
+	LogID       []byte `json:"log_id"`
+	Key         []byte `json:"key"`
+	// State maps the log's state, such as "usable" or "retired", to when it
+	// entered it.
+	State map[string]struct {
+		Timestamp time.Time `json:"timestamp"`
+	} `json:"state"`
+	Operator string `json:"-"`
+}
+
+// qualifiedAt reports whether Chrome counts SCTs the log issued at t.
+func (l *ctLog) qualifiedAt(t time.Time) bool {
+	for state, entered := range l.State {
+		switch state {
+		case "qualified", "usable", "readonly":
+			return true
+		case "retired":
+			return t.Before(entered.Timestamp)
+		}
+	}
+	return false
+}
+
+// state returns the log's current state, such as "usable" or "retired".
+func (l *ctLog) state() string {
+	for state := range l.State {
+		return state
+	}
+	return ""
+}
+
+// ctLogList holds the logs of the log list by log ID.
+type ctLogList map[ct.LogID]*ctLog
+
+// loadCTLogList returns the log list at CTLogListURL, loading it if it hasn't
+// been in the last CTLogListMaxAge. Failed loads aren't cached, so they may be
+// retried.
+func loadCTLogList() (ctLogList, error) {
+	ctLogListsMu.Lock()
+	defer ctLogListsMu.Unlock()
+
+	source := CTLogListURL
+	if list, ok := ctLogLists[source]; ok && time.Since(list.loaded) < CTLogListMaxAge {
+		return list.logs, nil
+	}
+
+	var r io.Reader
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		resp, err := Client.Get(source)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != 200 {
+			return nil, fmt.Errorf("fetching CT log list returned HTTP status %d", resp.StatusCode)
+		}
+		r = resp.Body
+	} else {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var list struct {
+		Operators []struct {
+			Name      string   `json:"name"`
+			Logs      []*ctLog `json:"logs"`
+			TiledLogs []*ctLog `json:"tiled_logs"`
+		} `json:"operators"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r, maxHTTPBodySize)).Decode(&list); err != nil {
+		return nil, err
+	}
+
+	logs := make(ctLogList)
+	for _, operator := range list.Operators {
+		for _, log := range append(operator.Logs, operator.TiledLogs...) {
+			var id ct.LogID
+			if len(log.LogID) != len(id.KeyID) {
+				continue
+			}
+			copy(id.KeyID[:], log.LogID)
+			log.Operator = operator.Name
+			logs[id] = log
+		}
+	}
+	ctLogLists[source] = loadedCTLogList{logs, time.Now()}
+	return logs, nil
+}
+
+// verifySCT verifies the signature of sct over the host's leaf with the log's
+// DER-encoded public key, given the host's chain as parsed by the
+// certificate-transparency-go x509 package. Embedded SCTs are signed over the
+// precertificate, so also need the leaf's issuer to follow it in chain.
+func verifySCT(sct *deliveredSCT, chain []*ctx509.Certificate, key []byte) error {
+	pub, err := ctx509.ParsePKIXPublicKey(key)
+	if err != nil {
+		return err
+	}
+	verifier, err := ct.NewSignatureVerifier(pub)
+	if err != nil {
+		return err
+	}
+
+	var leaf *ct.MerkleTreeLeaf
+	if sct.Source == sctEmbedded {
+		leaf, err = ct.MerkleTreeLeafForEmbeddedSCT(chain, sct.Timestamp)
+	} else {
+		leaf, err = ct.MerkleTreeLeafFromChain(chain, ct.X509LogEntryType, sct.Timestamp)
+	}
+	if err != nil {
+		return err
+	}
+	return verifier.VerifySCTSignature(sct.SignedCertificateTimestamp, ct.LogEntry{Leaf: *leaf})
+}
@@ -0,0 +1,121 @@
+package scan
+
+import (
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency-go"
+	cttls "github.com/google/certificate-transparency-go/tls"
+	ctx509 "github.com/google/certificate-transparency-go/x509"
+)
+
+const testLogList = `{
+  "operators": [{
+    "name": "Example",
+    "logs": [{
+      "description": "Example Retired Log",
+      "log_id": "AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=",
+      "state": {"retired": {"timestamp": "2024-01-01T00:00:00Z"}}
+    }],
+    "tiled_logs": [{
+      "description": "Example Tiled Log",
+      "log_id": "AgICAgICAgICAgICAgICAgICAgICAgICAgICAgICAgI=",
+      "state": {"usable": {"timestamp": "2025-01-01T00:00:00Z"}}
+    }]
+  }]
+}`
+
+func TestLoadCTLogList(t *testing.T) {
+	fetches := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.Write([]byte(testLogList))
+	}))
+	defer ts.Close()
+	defer func(url string) { CTLogListURL = url }(CTLogListURL)
+	CTLogListURL = ts.URL
+
+	logs, err := loadCTLogList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 2 {
+		t.Fatalf("got %d logs, want 2", len(logs))
+	}
+
+	var retired, tiled ct.LogID
+	for i := range retired.KeyID {
+		retired.KeyID[i], tiled.KeyID[i] = 1, 2
+	}
+	if log := logs[tiled]; log == nil || log.Operator != "Example" || !log.qualifiedAt(time.Now()) {
+		t.Errorf("tiled log not qualified: %+v", log)
+	}
+	log := logs[retired]
+	if log == nil {
+		t.Fatal("retired log missing")
+	}
+	if state := log.state(); state != "retired" {
+		t.Errorf("retired log in state %q", state)
+	}
+	if !log.qualifiedAt(time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Error("retired log not qualified before retirement")
+	}
+	if log.qualifiedAt(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Error("retired log qualified after retirement")
+	}
+
+	defer func(age time.Duration) { CTLogListMaxAge = age }(CTLogListMaxAge)
+	if _, err = loadCTLogList(); err != nil || fetches != 1 {
+		t.Errorf("log list fetched %d times, want 1: %v", fetches, err)
+	}
+	CTLogListMaxAge = 0
+	if _, err = loadCTLogList(); err != nil || fetches != 2 {
+		t.Errorf("expired log list fetched %d times, want 2: %v", fetches, err)
+	}
+}
+
+func TestVerifySCT(t *testing.T) {
+	key := testKey(t)
+	template := &x509.Certificate{
+		NotBefore: time.Now(),
+		NotAfter:  time.Now().Add(time.Hour),
+		DNSNames:  []string{"example.com"},
+	}
+	cert, err := ctx509.ParseCertificate(testCertFromTemplate(t, template, key, nil, nil).Raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := []*ctx509.Certificate{cert}
+
+	// The certificate's own key doubles as the log's.
+	logKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sct := deliveredSCT{Source: sctTLS}
+	sct.Timestamp = uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	leaf, err := ct.MerkleTreeLeafFromChain(chain, ct.X509LogEntryType, sct.Timestamp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input, err := ct.SerializeSCTSignatureInput(sct.SignedCertificateTimestamp, ct.LogEntry{Leaf: *leaf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := cttls.CreateSignature(*key, cttls.SHA256, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sct.Signature = ct.DigitallySigned(signature)
+
+	if err = verifySCT(&sct, chain, logKey); err != nil {
+		t.Errorf("valid SCT failed to verify: %v", err)
+	}
+	sct.Timestamp++
+	if err = verifySCT(&sct, chain, logKey); err == nil {
+		t.Error("SCT with altered timestamp verified")
+	}
+}
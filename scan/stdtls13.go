@@ -0,0 +1,85 @@
+//go:build go1.21
+// +build go1.21
+
+package scan
+
+// TLS 1.3 handshakes cf-tls can't complete are made with crypto/tls, though
+// only when built with Go 1.21 or later, which can also expose the sessions
+// they establish. Earlier versions fall back to stdtls13_old.go.
+
+import (
+	stdtls "crypto/tls"
+	"errors"
+	"net"
+	"time"
+)
+
+// stdSessionCache is a crypto/tls ClientSessionCache that keeps the last
+// session put into it and offers none.
+type stdSessionCache struct {
+	session *stdtls.ClientSessionState
+}
+
+func (c *stdSessionCache) Get(sessionKey string) (*stdtls.ClientSessionState, bool) {
+	return nil, false
+}
+
+func (c *stdSessionCache) Put(sessionKey string, cs *stdtls.ClientSessionState) {
+	if cs != nil {
+		c.session = cs
+	}
+}
+
+// tls13Ticket completes a TLS 1.3 handshake with the host using crypto/tls,
+// since cf-tls can't, returning the session ticket it issues, if any. Reading
+// the ticket needs Go 1.21; with earlier versions, none is returned.
+func tls13Ticket(addr, hostname string) ([]byte, error) {
+	cache := new(stdSessionCache)
+	conn, err := stdtls.DialWithDialer(Dialer, Network, addr, &stdtls.Config{
+		ServerName:         hostname,
+		InsecureSkipVerify: true,
+		MinVersion:         stdtls.VersionTLS13,
+		ClientSessionCache: cache,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// Tickets are sent after the handshake, and read along with application data.
+	conn.SetReadDeadline(time.Now().Add(ticketWait))
+	conn.Read(make([]byte, 1))
+	if cache.session == nil {
+		return nil, nil
+	}
+	ticket, _, err := cache.session.ResumptionState()
+	return ticket, err
+}
+
+// tls13CertificateRequest completes a TLS 1.3 handshake with the host using
+// crypto/tls, reporting whether it requested a client certificate and the
+// DER-encoded distinguished names of the CAs it listed if so.
+func tls13CertificateRequest(addr, hostname string) (acceptableCAs [][]byte, requested bool, err error) {
+	conn, err := stdtls.DialWithDialer(Dialer, Network, addr, &stdtls.Config{
+		ServerName:         hostname,
+		InsecureSkipVerify: true,
+		MinVersion:         stdtls.VersionTLS13,
+		GetClientCertificate: func(info *stdtls.CertificateRequestInfo) (*stdtls.Certificate, error) {
+			acceptableCAs, requested = info.AcceptableCAs, true
+			return new(stdtls.Certificate), nil
+		},
+	})
+	if conn != nil {
+		conn.Close()
+	}
+	// Hosts requiring a client certificate fail the handshake once sent none.
+	if requested {
+		err = nil
+	}
+	// crypto/tls wraps handshake errors; unwrap them so alerts classify as such.
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		err = opErr
+	}
+	return
+}
@@ -0,0 +1,16 @@
+//go:build !go1.21
+// +build !go1.21
+
+package scan
+
+// tls13Ticket returns no ticket, since crypto/tls can't expose TLS 1.3
+// session tickets before Go 1.21.
+func tls13Ticket(addr, hostname string) ([]byte, error) {
+	return nil, nil
+}
+
+// tls13CertificateRequest reports no certificate request, since crypto/tls is
+// only used for TLS 1.3 handshakes from Go 1.21.
+func tls13CertificateRequest(addr, hostname string) (acceptableCAs [][]byte, requested bool, err error) {
+	return nil, false, nil
+}
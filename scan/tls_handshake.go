@@ -2,10 +2,16 @@ package scan
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"errors"
 	"fmt"
+	"io"
 	"net"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/cloudflare/cfssl/helpers"
 	"github.com/cloudflare/cfssl/scan/crypto/tls"
@@ -14,29 +20,133 @@ import (
 // Sentinel for failures in sayHello. Should always be caught.
 var errHelloFailed = errors.New("Handshake failed in sayHello")
 
+// errNoCipherSuites is returned by cipherSuiteScan for hosts negotiating no
+// cipher suite below TLS 1.3.
+var errNoCipherSuites = errors.New("couldn't negotiate any cipher suites")
+
 // TLSHandshake contains scanners testing host cipher suite negotiation
 var TLSHandshake = &Family{
 	Description: "Scans for host's SSL/TLS version and cipher suite negotiation",
 	Scanners: map[string]*Scanner{
 		"CipherSuite": {
-			"Determines host's cipher suites accepted and preferred order",
-			cipherSuiteScan,
+			Description: "Determines host's cipher suites accepted and preferred order",
+			scan:        cipherSuiteScan,
 		},
 		"SigAlgs": {
-			"Determines host's accepted signature and hash algorithms",
-			sigAlgsScan,
+			Description: "Determines host's accepted signature and hash algorithms",
+			scan:        sigAlgsScan,
 		},
 		"CertsBySigAlgs": {
-			"Determines host's certificate signature algorithm matching client's accepted signature and hash algorithms",
-			certSigAlgsScan,
+			Description: "Determines host's certificate signature algorithm matching client's accepted signature and hash algorithms",
+			scan:        certSigAlgsScan,
 		},
 		"CertsByCiphers": {
-			"Determines host's certificate signature algorithm matching client's accepted ciphers",
-			certSigAlgsScanByCipher,
+			Description: "Determines host's certificate signature algorithm matching client's accepted ciphers",
+			scan:        certSigAlgsScanByCipher,
 		},
 		"ECCurves": {
-			"Determines the host's ec curve support for TLS 1.2",
-			ecCurveScan,
+			Description: "Determines the host's ec curve support for TLS 1.2",
+			scan:        ecCurveScan,
+		},
+		"ForwardSecrecy": {
+			Description: "Host negotiates a forward secret key exchange by default",
+			scan:        forwardSecrecyScan,
+		},
+		"HandshakeSigAlg": {
+			Description: "Determines the signature algorithm host uses to sign the handshake",
+			scan:        handshakeSigAlgScan,
+		},
+		"ServerExtensions": {
+			Description: "Determines the TLS extensions host includes in its ServerHello",
+			scan:        serverExtensionsScan,
+		},
+		"NoSNI": {
+			Description: "Determines how host responds to a handshake without SNI",
+			scan:        noSNIScan,
+		},
+		"UnknownSNI": {
+			Description: "Determines how host responds to a handshake for a name it doesn't host",
+			scan:        unknownSNIScan,
+		},
+		"TrailingDotSNI": {
+			Description: "Host handles a fully qualified name with a trailing dot in SNI",
+			scan:        trailingDotSNIScan,
+		},
+		"HandshakeSize": {
+			Description: "Host's handshake is small enough not to need extra round trips",
+			scan:        handshakeSizeScan,
+		},
+		"TLS13CipherSuites": {
+			Description: "Determines the TLS 1.3 cipher suites host accepts",
+			scan:        tls13CipherSuitesScan,
+		},
+		"PostQuantum": {
+			Description: "Determines whether host negotiates hybrid post-quantum key exchange",
+			scan:        postQuantumScan,
+		},
+		"MinimumVersion": {
+			Description: "Host rejects clients limited to TLS versions older than TLS 1.2",
+			scan:        minimumVersionScan,
+		},
+		"DowngradeSentinel": {
+			Description: "Host marks its ServerHello random when negotiating below TLS 1.3",
+			scan:        downgradeSentinelScan,
+		},
+		"NoSharedCipher": {
+			Description: "Host answers a ClientHello without a cipher suite it supports with a handshake_failure alert",
+			scan:        noSharedCipherScan,
+		},
+		"ExtensionDependencies": {
+			Description: "Determines which ClientHello extensions host requires to complete a handshake",
+			scan:        extensionDependenciesScan,
+		},
+		"GREASE": {
+			Description: "Host ignores GREASE cipher suites, groups, and extensions",
+			scan:        greaseScan,
+		},
+		"CertificateAuthorities": {
+			Description: "Host requesting a client certificate in TLS 1.3 lists the CAs it accepts",
+			scan:        certificateAuthoritiesScan,
+		},
+		"ExtendedMasterSecret": {
+			Description: "Host supports the extended master secret extension",
+			scan:        extendedMasterSecretScan,
+		},
+		"MalformedHello": {
+			Description: "Host rejects a malformed ClientHello with an alert",
+			scan:        malformedHelloScan,
+		},
+		"OversizedHello": {
+			Description: "Host limits the size of the ClientHello it buffers",
+			scan:        oversizedHelloScan,
+		},
+		"DuplicateExtension": {
+			Description: "Host rejects a ClientHello with a duplicated extension with an alert",
+			scan:        duplicateExtensionScan,
+		},
+		"BaselineDiff": {
+			Description: "Host's handshake hasn't changed since the recorded baseline",
+			scan:        baselineDiffScan,
+		},
+		"ComplianceProfile": {
+			Description: "Host's versions, cipher suites, and key meet the requirements of the chosen compliance profile",
+			scan:        complianceProfileScan,
+		},
+		"ROBOT": {
+			Description: "Host isn't vulnerable to the ROBOT RSA padding oracle",
+			scan:        robotScan,
+		},
+		"Lucky13": {
+			Description: "Host doesn't leak the CBC padding length through the timing of its bad_record_mac alerts",
+			scan:        lucky13Scan,
+		},
+		"JARM": {
+			Description: "Fingerprints host's TLS stack from its responses to the JARM ClientHellos",
+			scan:        jarmScan,
+		},
+		"Authentication": {
+			Description: "Determines whether host authenticates the handshake with a certificate",
+			scan:        authenticationScan,
 		},
 	},
 }
@@ -268,17 +378,25 @@ func doCurveScan(addr, hostname string, vers, cipherID uint16, ciphers []uint16)
 
 // cipherSuiteScan returns, by TLS Version, the sort list of cipher suites
 // supported by the host
-func cipherSuiteScan(addr, hostname string) (grade Grade, output Output, err error) {
+func cipherSuiteScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
 	var cvList cipherVersionList
 	allCiphers := allCiphersIDs()
 
+	// Each version is budgeted one probe per cipher suite; versions which
+	// run out of negotiable cipher suites early skip the rest of their budget.
+	total := len(allCiphers) * int(tls.VersionTLS12-tls.VersionSSL30+1)
+	done := 0
+
 	var vers uint16
 	for vers = tls.VersionTLS12; vers >= tls.VersionSSL30; vers-- {
 		ciphers := make([]uint16, len(allCiphers))
 		copy(ciphers, allCiphers)
+		done = len(allCiphers) * int(tls.VersionTLS12-vers)
 		for len(ciphers) > 0 {
 			var cipherIndex int
 			cipherIndex, _, _, err = sayHello(addr, hostname, ciphers, nil, vers, nil)
+			done++
+			opts.progress(done, total)
 			if err != nil {
 				if err == errHelloFailed {
 					err = nil
@@ -311,8 +429,10 @@ func cipherSuiteScan(addr, hostname string) (grade Grade, output Output, err err
 		}
 	}
 
+	opts.progress(total, total)
+
 	if len(cvList) == 0 {
-		err = errors.New("couldn't negotiate any cipher suites")
+		err = errNoCipherSuites
 		return
 	}
 
@@ -324,18 +444,28 @@ func cipherSuiteScan(addr, hostname string) (grade Grade, output Output, err err
 	return
 }
 
-// sigAlgsScan returns the accepted signature and hash algorithms of the host
-func sigAlgsScan(addr, hostname string) (grade Grade, output Output, err error) {
+// sigAlgsScan returns the accepted signature and hash algorithms of the host,
+// offering each in turn as the only one in the ClientHello. It warns if the
+// host still accepts rsa_pkcs1_sha1.
+func sigAlgsScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
 	var supportedSigAlgs []tls.SignatureAndHash
-	for _, sigAlg := range tls.AllSignatureAndHashAlgorithms {
+	acceptsSHA1RSA := false
+	for i, sigAlg := range tls.AllSignatureAndHashAlgorithms {
 		_, _, _, e := sayHello(addr, hostname, nil, nil, tls.VersionTLS12, []tls.SignatureAndHash{sigAlg})
+		opts.progress(i+1, len(tls.AllSignatureAndHashAlgorithms))
 		if e == nil {
 			supportedSigAlgs = append(supportedSigAlgs, sigAlg)
+			if sigAlg.Signature() == tls.SigRSA && sigAlg.Hash() == tls.HashSHA1 {
+				acceptsSHA1RSA = true
+			}
 		}
 	}
 
 	if len(supportedSigAlgs) > 0 {
 		grade = Good
+		if acceptsSHA1RSA {
+			grade = Warning
+		}
 		output = supportedSigAlgs
 	} else {
 		err = errors.New("no SigAlgs supported")
@@ -344,10 +474,11 @@ func sigAlgsScan(addr, hostname string) (grade Grade, output Output, err error)
 }
 
 // certSigAlgScan returns the server certificate with various sigature and hash algorithms in the ClientHello
-func certSigAlgsScan(addr, hostname string) (grade Grade, output Output, err error) {
+func certSigAlgsScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
 	var certSigAlgs = make(map[string]string)
-	for _, sigAlg := range tls.AllSignatureAndHashAlgorithms {
+	for i, sigAlg := range tls.AllSignatureAndHashAlgorithms {
 		_, _, derCerts, e := sayHello(addr, hostname, nil, nil, tls.VersionTLS12, []tls.SignatureAndHash{sigAlg})
+		opts.progress(i+1, len(tls.AllSignatureAndHashAlgorithms))
 		if e == nil {
 			if len(derCerts) == 0 {
 				return Bad, nil, errors.New("no certs returned")
@@ -373,10 +504,13 @@ func certSigAlgsScan(addr, hostname string) (grade Grade, output Output, err err
 }
 
 // certSigAlgScan returns the server certificate with various ciphers in the ClientHello
-func certSigAlgsScanByCipher(addr, hostname string) (grade Grade, output Output, err error) {
+func certSigAlgsScanByCipher(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
 	var certSigAlgs = make(map[string]string)
+	done := 0
 	for cipherID := range tls.CipherSuites {
 		_, _, derCerts, e := sayHello(addr, hostname, []uint16{cipherID}, nil, tls.VersionTLS12, []tls.SignatureAndHash{})
+		done++
+		opts.progress(done, len(tls.CipherSuites))
 		if e == nil {
 			if len(derCerts) == 0 {
 				return Bad, nil, errors.New("no certs returned")
@@ -401,7 +535,7 @@ func certSigAlgsScanByCipher(addr, hostname string) (grade Grade, output Output,
 }
 
 // ecCurveScan returns the elliptic curves supported by the host.
-func ecCurveScan(addr, hostname string) (grade Grade, output Output, err error) {
+func ecCurveScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
 	allCurves := allCurvesIDs()
 	curves := make([]tls.CurveID, len(allCurves))
 	copy(curves, allCurves)
@@ -409,6 +543,7 @@ func ecCurveScan(addr, hostname string) (grade Grade, output Output, err error)
 	for len(curves) > 0 {
 		var curveIndex int
 		_, curveIndex, _, err = sayHello(addr, hostname, allECDHECiphersIDs(), curves, tls.VersionTLS12, nil)
+		opts.progress(len(allCurves)-len(curves)+1, len(allCurves))
 		if err != nil {
 			// This case is expected, because eventually we ask only for curves the server doesn't support
 			if err == errHelloFailed {
@@ -421,7 +556,1130 @@ func ecCurveScan(addr, hostname string) (grade Grade, output Output, err error)
 		supportedCurves = append(supportedCurves, tls.Curves[curveID])
 		curves = append(curves[:curveIndex], curves[curveIndex+1:]...)
 	}
+	opts.progress(len(allCurves), len(allCurves))
 	output = supportedCurves
 	grade = Good
 	return
 }
+
+// keyExchange describes the key exchange of a negotiated cipher suite.
+type keyExchange struct {
+	CipherSuite   string `json:"cipher_suite"`
+	KeyExchange   string `json:"key_exchange"`
+	ForwardSecret bool   `json:"forward_secret"`
+}
+
+// forwardSecrecyScan reports the key exchange of the cipher suite the host
+// negotiates in a default handshake, graded Good if it's forward secret, as
+// with ECDHE and DHE, and Bad otherwise, as with static RSA.
+func forwardSecrecyScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	conn, err := tls.DialWithDialer(Dialer, Network, addr, opts.tlsConfig(hostname))
+	if err != nil {
+		return
+	}
+	conn.Close()
+
+	suite := tls.CipherSuites[conn.ConnectionState().CipherSuite]
+	result := keyExchange{CipherSuite: suite.Name, ForwardSecret: suite.ForwardSecret}
+	// Suite names are of the form TLS_<key exchange>_WITH_<cipher>.
+	if i := strings.Index(suite.Name, "_WITH_"); i > 0 {
+		result.KeyExchange = strings.TrimPrefix(strings.TrimPrefix(suite.Name[:i], "TLS_"), "SSL_")
+	}
+	output = result
+
+	if result.ForwardSecret {
+		grade = Good
+	}
+	return
+}
+
+// handshakeSignature describes how the host signed its key exchange.
+type handshakeSignature struct {
+	Version string `json:"version"`
+	Scheme  string `json:"scheme"`
+}
+
+// handshakeSigAlgScan reports the signature scheme the host uses to sign its
+// ServerKeyExchange in a default handshake. SHA-1 based schemes, which are
+// implied before TLS 1.2, are warned against. PKCS#1 v1.5 schemes aren't,
+// since cf-tls offers no RSA-PSS scheme the host could choose instead. Hosts
+// negotiating a key exchange without a signature are skipped.
+func handshakeSigAlgScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	conn, err := tls.DialWithDialer(Dialer, Network, addr, opts.tlsConfig(hostname))
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	sigAlg, ok := conn.ServerKeyExchangeSignature()
+	if !ok {
+		grade = Skipped
+		return
+	}
+
+	version := conn.ConnectionState().Version
+	scheme := sigAlg.SchemeName()
+	if version < tls.VersionTLS12 {
+		if sigAlg.Signature() == tls.SigRSA {
+			scheme = "rsa_pkcs1_md5_sha1"
+		} else {
+			scheme = "ecdsa_sha1"
+		}
+	}
+	output = handshakeSignature{tls.Versions[version], scheme}
+
+	switch {
+	case version < tls.VersionTLS12, sigAlg.Hash() == tls.HashSHA1, sigAlg.Hash() == tls.HashMD5:
+		grade = Warning
+	default:
+		grade = Good
+	}
+	return
+}
+
+// serverExtensionsScan reports the extensions the host includes in its
+// ServerHello in response to a default handshake.
+func serverExtensionsScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	conn, err := tls.DialWithDialer(Dialer, Network, addr, opts.tlsConfig(hostname))
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	extensions := []string{}
+	for _, ext := range conn.ServerHelloExtensions() {
+		name, ok := tls.Extensions[ext]
+		if !ok {
+			name = fmt.Sprintf("unknown(%d)", ext)
+		}
+		extensions = append(extensions, name)
+	}
+
+	grade, output = Good, extensions
+	return
+}
+
+// authenticationScan reports whether the host presented an X.509 certificate
+// in the handshake, warning if it didn't unless the AllowCertless option is
+// set. cf-tls offers no PSK or anonymous cipher suites, so hosts which only
+// negotiate those fail the handshake instead.
+func authenticationScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	conn, err := tls.DialWithDialer(Dialer, Network, addr, opts.tlsConfig(hostname))
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	if _, lerr := leafCert(conn.ConnectionState()); lerr == nil {
+		grade, output = Good, "certificate"
+		return
+	}
+
+	output = "none"
+	if opts.AllowCertless {
+		grade = Good
+	} else {
+		grade = Warning
+	}
+	return
+}
+
+// helloTimeout bounds how long handshakes and ClientHello probes over
+// connections dialed by hand wait on the host.
+var helloTimeout = 5 * time.Second
+
+// noSNIScan attempts a handshake without the server_name extension, reporting
+// whether the host aborts it or which certificate it falls back to. Falling
+// back to a certificate that isn't valid for the host is warned against.
+func noSNIScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	tcpConn, err := Dialer.Dial(Network, addr)
+	if err != nil {
+		return
+	}
+	defer tcpConn.Close()
+	tcpConn.SetDeadline(time.Now().Add(helloTimeout))
+
+	conn := tls.Client(tcpConn, opts.tlsConfig(""))
+	if conn.Handshake() != nil {
+		grade, output = Good, "aborts handshake"
+		return
+	}
+
+	leaf, err := leafCert(conn.ConnectionState())
+	if err != nil {
+		return
+	}
+
+	if leaf.VerifyHostname(hostname) == nil {
+		grade, output = Good, "returns expected certificate"
+	} else {
+		grade, output = Warning, fmt.Sprintf("returns default certificate for %s", leaf.Subject.CommonName)
+	}
+	return
+}
+
+// unknownSNIName is a name no host serves, requested by unknownSNIScan.
+var unknownSNIName = "does-not-exist.invalid"
+
+// unknownSNIScan attempts a handshake requesting unknownSNIName through SNI,
+// reporting whether the host rejects it with an alert, closes the connection,
+// or falls back to a default certificate. Falling back to a publicly trusted
+// certificate, exposing a production name as the catch-all, is warned against.
+func unknownSNIScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	tcpConn, err := Dialer.Dial(Network, addr)
+	if err != nil {
+		return
+	}
+	defer tcpConn.Close()
+	tcpConn.SetDeadline(time.Now().Add(helloTimeout))
+
+	conn := tls.Client(tcpConn, opts.tlsConfig(unknownSNIName))
+	if herr := conn.Handshake(); herr != nil {
+		grade = Good
+		if code, ok := tls.RemoteAlert(herr); ok && code == tls.AlertUnrecognizedName {
+			output = "sends unrecognized_name alert"
+		} else if ok {
+			output = fmt.Sprintf("sends alert %d", code)
+		} else {
+			output = "closes connection"
+		}
+		return
+	}
+
+	state := conn.ConnectionState()
+	leaf, err := leafCert(state)
+	if err != nil {
+		return
+	}
+
+	output = fmt.Sprintf("returns default certificate for %s", leaf.Subject.CommonName)
+	if _, verr := buildChains(state.PeerCertificates); verr == nil {
+		grade = Warning
+	} else {
+		grade = Good
+	}
+	return
+}
+
+// sniResult describes the outcome of a handshake requesting a particular name.
+type sniResult struct {
+	Handshake bool   `json:"handshake"`
+	Verified  bool   `json:"verified"`
+	Subject   string `json:"subject,omitempty"`
+}
+
+// sniHandshake handshakes with the host requesting sni, reporting whether the
+// handshake succeeded and the certificate returned is valid for hostname.
+func sniHandshake(addr, hostname, sni string, opts *Options) (result sniResult, err error) {
+	tcpConn, err := Dialer.Dial(Network, addr)
+	if err != nil {
+		return
+	}
+	defer tcpConn.Close()
+	tcpConn.SetDeadline(time.Now().Add(helloTimeout))
+
+	conn := tls.Client(tcpConn, opts.tlsConfig(sni))
+	if conn.Handshake() != nil {
+		return
+	}
+	result.Handshake = true
+
+	state := conn.ConnectionState()
+	leaf, err := leafCert(state)
+	if err != nil {
+		return
+	}
+	result.Subject = leaf.Subject.CommonName
+	if leaf.VerifyHostname(hostname) == nil {
+		_, verr := buildChains(state.PeerCertificates)
+		result.Verified = verr == nil
+	}
+	return
+}
+
+// trailingDotSNIScan requests the host's fully qualified name, with a
+// trailing dot, through SNI, reporting whether the handshake succeeds with a
+// certificate valid for the host. Failing where a handshake requesting the
+// name without the dot succeeds is warned of.
+func trailingDotSNIScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	hostname = strings.TrimSuffix(hostname, ".")
+	plain, err := sniHandshake(addr, hostname, hostname, opts)
+	if err != nil {
+		return
+	}
+	dotted, err := sniHandshake(addr, hostname, hostname+".", opts)
+	if err != nil {
+		return
+	}
+	output = dotted
+
+	if (plain.Handshake && !dotted.Handshake) || (plain.Verified && !dotted.Verified) {
+		grade = Warning
+	} else {
+		grade = Good
+	}
+	return
+}
+
+// MaxHandshakeBytes is the total size of a handshake, in bytes, above which
+// handshakeSizeScan warns. The default roughly matches a typical initial TCP
+// congestion window of ten segments.
+var MaxHandshakeBytes int64 = 14600
+
+// countingConn is a net.Conn counting the bytes read from and written to it.
+type countingConn struct {
+	net.Conn
+	read, written int64
+}
+
+func (c *countingConn) Read(b []byte) (n int, err error) {
+	n, err = c.Conn.Read(b)
+	c.read += int64(n)
+	return
+}
+
+func (c *countingConn) Write(b []byte) (n int, err error) {
+	n, err = c.Conn.Write(b)
+	c.written += int64(n)
+	return
+}
+
+// handshakeSize breaks down the bytes exchanged during a handshake.
+type handshakeSize struct {
+	Total           int64 `json:"total"`
+	Sent            int64 `json:"sent"`
+	Received        int64 `json:"received"`
+	CertificateMsg  int   `json:"certificate_message"`
+	StapledResponse int   `json:"stapled_response"`
+}
+
+// handshakeSizeScan counts the bytes sent and received on the wire during a
+// handshake with the host, along with the size of its Certificate message and
+// any stapled OCSP response, warning if the total exceeds MaxHandshakeBytes.
+func handshakeSizeScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	tcpConn, err := Dialer.Dial(Network, addr)
+	if err != nil {
+		return
+	}
+	tcpConn.SetDeadline(time.Now().Add(helloTimeout))
+	counter := &countingConn{Conn: tcpConn}
+	conn := tls.Client(counter, opts.tlsConfig(hostname))
+	defer conn.Close()
+
+	if err = conn.Handshake(); err != nil {
+		return
+	}
+
+	state := conn.ConnectionState()
+	// A Certificate message has a 4 byte header and a 3 byte list length,
+	// with a 3 byte length before each certificate.
+	certificateMsg := 4 + 3
+	for _, cert := range state.PeerCertificates {
+		certificateMsg += 3 + len(cert.Raw)
+	}
+
+	size := handshakeSize{
+		Total:           counter.read + counter.written,
+		Sent:            counter.written,
+		Received:        counter.read,
+		CertificateMsg:  certificateMsg,
+		StapledResponse: len(state.OCSPResponse),
+	}
+	output = size
+
+	if size.Total > MaxHandshakeBytes {
+		grade = Warning
+	} else {
+		grade = Good
+	}
+	return
+}
+
+// helloWithExtensions sends the host a ClientHello with the given extensions
+// added, returning its ServerHello.
+func helloWithExtensions(addr, hostname string, opts *Options, extensions []tls.Extension) (*tls.ServerHello, error) {
+	tcpConn, err := Dialer.Dial(Network, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer tcpConn.Close()
+	tcpConn.SetDeadline(time.Now().Add(helloTimeout))
+
+	return tls.Client(tcpConn, opts.tlsConfig(hostname)).HelloWithExtensions(extensions)
+}
+
+// hasExtension reports whether extensions contains ext.
+func hasExtension(extensions []uint16, ext uint16) bool {
+	for _, e := range extensions {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// extensionExtendedMasterSecret is the extended_master_secret extension (RFC 7627).
+const extensionExtendedMasterSecret = 23
+
+// extendedMasterSecretScan tests whether the host agrees to the extended
+// master secret extension, which protects against the triple handshake attack.
+func extendedMasterSecretScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	serverHello, err := helloWithExtensions(addr, hostname, opts, []tls.Extension{{Type: extensionExtendedMasterSecret}})
+	if err != nil {
+		return
+	}
+
+	supported := hasExtension(serverHello.Extensions, extensionExtendedMasterSecret)
+	output = supported
+	if supported {
+		grade = Good
+	} else {
+		grade = Warning
+	}
+	return
+}
+
+// TLS 1.3 extensions (RFC 8446) and their values offered by tls13Hello.
+const (
+	extensionSupportedVersions = 43
+	extensionKeyShare          = 51
+	extensionSupportedGroups   = 10
+	extensionSignatureAlgs     = 13
+)
+
+// tls13SignatureSchemes are the signature schemes offered in a TLS 1.3
+// ClientHello: ECDSA, RSA-PSS, and RSA PKCS #1 v1.5 with SHA-256, SHA-384,
+// and SHA-512.
+var tls13SignatureSchemes = []uint16{0x0403, 0x0503, 0x0603, 0x0804, 0x0805, 0x0806, 0x0401, 0x0501, 0x0601}
+
+// tls13Groups are the groups offered by default in a TLS 1.3 ClientHello.
+var tls13Groups = []tls.CurveID{29} // x25519
+
+// keyShare returns a random key share for group, or nil if it isn't one for
+// which tls13Hello can generate shares; tls13Extensions sends a share for
+// every group it's given that it can. Since the handshake never completes,
+// the private keys needn't be kept.
+func keyShare(group tls.CurveID) ([]byte, error) {
+	var x25519, mlkem768 []byte
+	switch group {
+	case 29, 0x11ec, 0x6399:
+		x25519 = make([]byte, 32)
+		if _, err := rand.Read(x25519); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, nil
+	}
+	if group == 29 {
+		return x25519, nil
+	}
+
+	// An ML-KEM-768 encapsulation key is 768 coefficients below 3329,
+	// packed 12 bits apiece, followed by a 32-byte seed.
+	mlkem768 = make([]byte, 0, 1184)
+	buf := make([]byte, 2)
+	coefficient := func() (uint16, error) {
+		for {
+			if _, err := rand.Read(buf); err != nil {
+				return 0, err
+			}
+			if c := (uint16(buf[0])<<8 | uint16(buf[1])) & 0xfff; c < 3329 {
+				return c, nil
+			}
+		}
+	}
+	for i := 0; i < 384; i++ {
+		a, err := coefficient()
+		if err != nil {
+			return nil, err
+		}
+		b, err := coefficient()
+		if err != nil {
+			return nil, err
+		}
+		mlkem768 = append(mlkem768, byte(a), byte(a>>8|b<<4), byte(b>>4))
+	}
+	seed := make([]byte, 32)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, err
+	}
+	mlkem768 = append(mlkem768, seed...)
+
+	if group == 0x6399 {
+		return append(x25519, mlkem768...), nil
+	}
+	return append(mlkem768, x25519...), nil
+}
+
+// tls13Extensions returns the extensions turning a cf-tls ClientHello into a
+// TLS 1.3 one: TLS 1.3 as the only supported version, the given groups with
+// key shares for those keyShare supports, and TLS 1.3 signature schemes.
+func tls13Extensions(groups []tls.CurveID) ([]tls.Extension, error) {
+	supportedGroups := []byte{byte(2 * len(groups) >> 8), byte(2 * len(groups))}
+	keyShares := []byte{0, 0}
+	for _, group := range groups {
+		supportedGroups = append(supportedGroups, byte(group>>8), byte(group))
+
+		share, err := keyShare(group)
+		if err != nil {
+			return nil, err
+		}
+		if share != nil {
+			keyShares = append(keyShares, byte(group>>8), byte(group), byte(len(share)>>8), byte(len(share)))
+			keyShares = append(keyShares, share...)
+		}
+	}
+	keyShares[0], keyShares[1] = byte((len(keyShares)-2)>>8), byte(len(keyShares)-2)
+
+	n := 2 * len(tls13SignatureSchemes)
+	sigAlgs := []byte{byte(n >> 8), byte(n)}
+	for _, scheme := range tls13SignatureSchemes {
+		sigAlgs = append(sigAlgs, byte(scheme>>8), byte(scheme))
+	}
+
+	return []tls.Extension{
+		{Type: extensionSupportedVersions, Data: []byte{2, 0x03, 0x04}},
+		{Type: extensionSupportedGroups, Data: supportedGroups},
+		{Type: extensionKeyShare, Data: keyShares},
+		{Type: extensionSignatureAlgs, Data: sigAlgs},
+	}, nil
+}
+
+// tls13Hello sends the host a TLS 1.3 ClientHello offering the given cipher
+// suites and groups, returning its ServerHello, which may be a
+// HelloRetryRequest, and whether it negotiated TLS 1.3 at all.
+func tls13Hello(addr, hostname string, opts *Options, suites []uint16, groups []tls.CurveID) (serverHello *tls.ServerHello, ok bool, err error) {
+	extensions, err := tls13Extensions(groups)
+	if err != nil {
+		return
+	}
+
+	tcpConn, err := Dialer.Dial(Network, addr)
+	if err != nil {
+		return
+	}
+	defer tcpConn.Close()
+	tcpConn.SetDeadline(time.Now().Add(helloTimeout))
+
+	config := opts.tlsConfig(hostname)
+	config.CipherSuites = suites
+	// TLS 1.3 is only negotiated through supported_versions, with the legacy
+	// version fixed at TLS 1.2.
+	config.MinVersion, config.MaxVersion = tls.VersionTLS12, tls.VersionTLS12
+	serverHello, err = tls.Client(tcpConn, config).HelloWithExtensions(extensions)
+	if err != nil {
+		return
+	}
+	return serverHello, hasExtension(serverHello.Extensions, extensionSupportedVersions), nil
+}
+
+// certificateAuthorities describes the certificate_authorities extension of
+// the host's TLS 1.3 CertificateRequest.
+type certificateAuthorities struct {
+	Sent bool `json:"sent"`
+	// CAs are the distinguished names of the CAs the host accepts.
+	CAs []string `json:"cas,omitempty"`
+}
+
+// certificateAuthoritiesScan completes a TLS 1.3 handshake with the host using
+// crypto/tls, since cf-tls can't, and if it requests a client certificate,
+// reports the CAs listed in the certificate_authorities extension of its
+// CertificateRequest. Hosts requesting a certificate without listing CAs,
+// leaving clients to guess which to present, are warned of. Hosts not
+// requesting one, or without TLS 1.3, are skipped, as are all hosts when built
+// with Go before 1.21.
+func certificateAuthoritiesScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	acceptableCAs, requested, err := tls13CertificateRequest(addr, hostname)
+	if !requested {
+		if err != nil && strings.Contains(classifyNetError(err), "protocol version") {
+			err = nil
+		}
+		if err == nil {
+			grade = Skipped
+		}
+		return
+	}
+
+	result := certificateAuthorities{Sent: len(acceptableCAs) > 0}
+	for _, der := range acceptableCAs {
+		var rdns pkix.RDNSequence
+		if rest, uerr := asn1.Unmarshal(der, &rdns); uerr != nil || len(rest) > 0 {
+			result.CAs = append(result.CAs, "malformed name")
+			continue
+		}
+		var name pkix.Name
+		name.FillFromRDNSequence(&rdns)
+		result.CAs = append(result.CAs, name.String())
+	}
+	output = result
+
+	if result.Sent {
+		grade = Good
+	} else {
+		grade = Warning
+	}
+	return
+}
+
+// tls13CipherSuitesScan offers the host each TLS 1.3 cipher suite in turn,
+// listing those it accepts. Hosts accepting only TLS_AES_128_CCM_8_SHA256,
+// with its truncated authentication tag, are warned of.
+func tls13CipherSuitesScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	var all []uint16
+	for id := range tls.TLS13CipherSuites {
+		all = append(all, id)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i] < all[j] })
+
+	if _, ok, herr := tls13Hello(addr, hostname, opts, all, tls13Groups); herr != nil || !ok {
+		grade = Skipped
+		return
+	}
+
+	accepted := []string{}
+	for _, id := range all {
+		if serverHello, ok, herr := tls13Hello(addr, hostname, opts, []uint16{id}, tls13Groups); herr == nil && ok && serverHello.CipherSuite == id {
+			accepted = append(accepted, tls.TLS13CipherSuites[id].Name)
+		}
+	}
+	output = accepted
+
+	switch {
+	case len(accepted) == 0:
+		err = errors.New("host negotiated TLS 1.3 but accepted none of its cipher suites individually")
+	case len(accepted) == 1 && accepted[0] == tls.TLS13CipherSuites[0x1305].Name:
+		grade = Warning
+	default:
+		grade = Good
+	}
+	return
+}
+
+// postQuantumGroups are the groups offered by postQuantumScan, in order of
+// preference. A key share is sent for each of them.
+var postQuantumGroups = []tls.CurveID{0x11ec, 0x6399, 29}
+
+// keyExchangeGroup describes the group the host negotiated for key exchange.
+type keyExchangeGroup struct {
+	Group       string `json:"group"`
+	PostQuantum bool   `json:"post_quantum"`
+}
+
+// postQuantumScan offers the host hybrid post-quantum groups alongside x25519
+// in a TLS 1.3 ClientHello and reports the group it selects. Hosts selecting
+// a post-quantum group are graded Good; others are reported without a grade.
+func postQuantumScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	var suites []uint16
+	for id := range tls.TLS13CipherSuites {
+		suites = append(suites, id)
+	}
+
+	serverHello, ok, err := tls13Hello(addr, hostname, opts, suites, postQuantumGroups)
+	// Hosts without TLS 1.3 may reject the ClientHello outright.
+	if err != nil && strings.Contains(classifyNetError(err), "protocol version") {
+		err = nil
+	}
+	if err != nil {
+		return
+	}
+	grade = Skipped
+	if !ok {
+		return
+	}
+
+	share := serverHello.ExtensionData[extensionKeyShare]
+	if len(share) < 2 {
+		err = errors.New("host negotiated TLS 1.3 without a key share")
+		grade = Bad
+		return
+	}
+	group := tls.CurveID(share[0])<<8 | tls.CurveID(share[1])
+
+	result := keyExchangeGroup{Group: tls.Curves[group]}
+	if name, isPQ := tls.PostQuantumGroups[group]; isPQ {
+		result.Group, result.PostQuantum = name, true
+		grade = Good
+	}
+	if result.Group == "" {
+		result.Group = fmt.Sprintf("0x%04x", uint16(group))
+	}
+	output = result
+	return
+}
+
+// versionHello offers the host only version, with every cipher suite and
+// curve, returning errHelloFailed if it doesn't answer with a ServerHello for
+// that version within helloTimeout.
+func versionHello(addr, hostname string, vers uint16) error {
+	tcpConn, err := Dialer.Dial(Network, addr)
+	if err != nil {
+		return err
+	}
+	defer tcpConn.Close()
+	tcpConn.SetDeadline(time.Now().Add(helloTimeout))
+
+	config := defaultTLSConfig(hostname)
+	config.MinVersion, config.MaxVersion = vers, vers
+	config.CipherSuites = allCiphersIDs()
+	config.CurvePreferences = allCurvesIDs()
+	serverHello, err := tls.Client(tcpConn, config).HelloWithExtensions(nil)
+	if err != nil || serverHello.Version != vers {
+		return errHelloFailed
+	}
+	return nil
+}
+
+// minimumVersionScan offers the host each TLS version in turn, from SSL 3.0
+// up, reporting the oldest it accepts. Hosts accepting TLS 1.0 or older are
+// graded Bad, and those accepting TLS 1.1 warned of.
+func minimumVersionScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	for vers := uint16(tls.VersionSSL30); vers <= tls.VersionTLS12; vers++ {
+		err = versionHello(addr, hostname, vers)
+		if err == errHelloFailed {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		output = tls.Versions[vers]
+		switch {
+		case vers <= tls.VersionTLS10:
+		case vers == tls.VersionTLS11:
+			grade = Warning
+		default:
+			grade = Good
+		}
+		return
+	}
+
+	var suites []uint16
+	for id := range tls.TLS13CipherSuites {
+		suites = append(suites, id)
+	}
+	_, ok, err := tls13Hello(addr, hostname, opts, suites, tls13Groups)
+	if err != nil {
+		return
+	}
+	if !ok {
+		err = errors.New("host accepted no TLS version")
+		return
+	}
+	grade, output = Good, "TLS 1.3"
+	return
+}
+
+// The values TLS 1.3 servers end their ServerHello random with when
+// negotiating TLS 1.2 or older (RFC 8446, section 4.1.3).
+var (
+	downgradeTLS12 = []byte("DOWNGRD\x01")
+	downgradeTLS11 = []byte("DOWNGRD\x00")
+)
+
+// downgradeSentinel reports the version negotiated by a TLS 1.2 ClientHello
+// and whether the host marked it as a downgrade.
+type downgradeSentinel struct {
+	Version  string `json:"version"`
+	Sentinel bool   `json:"sentinel"`
+}
+
+// downgradeSentinelScan sends a host supporting TLS 1.3 a TLS 1.2 ClientHello,
+// checking that the ServerHello random ends with the downgrade sentinel that
+// lets TLS 1.3 clients detect an attacker forcing an older version. Hosts
+// omitting it are graded Bad, and hosts without TLS 1.3 are skipped.
+func downgradeSentinelScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	var suites []uint16
+	for id := range tls.TLS13CipherSuites {
+		suites = append(suites, id)
+	}
+	if _, ok, herr := tls13Hello(addr, hostname, opts, suites, tls13Groups); herr != nil || !ok {
+		grade = Skipped
+		return
+	}
+
+	tcpConn, err := Dialer.Dial(Network, addr)
+	if err != nil {
+		return
+	}
+	defer tcpConn.Close()
+	tcpConn.SetDeadline(time.Now().Add(helloTimeout))
+	config := opts.tlsConfig(hostname)
+	config.MaxVersion = tls.VersionTLS12
+	serverHello, err := tls.Client(tcpConn, config).HelloWithExtensions(nil)
+	if err != nil {
+		return
+	}
+
+	sentinel := downgradeTLS11
+	if serverHello.Version == tls.VersionTLS12 {
+		sentinel = downgradeTLS12
+	}
+	result := downgradeSentinel{
+		Version:  tls.Versions[serverHello.Version],
+		Sentinel: bytes.HasSuffix(serverHello.Random, sentinel),
+	}
+	output = result
+
+	if result.Sentinel {
+		grade = Good
+	}
+	return
+}
+
+// noSharedCipherTimeout bounds how long noSharedCipherScan waits for the host's alert.
+var noSharedCipherTimeout = 5 * time.Second
+
+// noSharedCipherScan offers the host only TLS_NULL_WITH_NULL_NULL, which no
+// server may negotiate, reporting how it responds. Hosts should send a
+// handshake_failure alert, and are warned of if they hang, close the
+// connection, or send a different alert. Hosts negotiating the cipher suite
+// anyway are graded Bad.
+func noSharedCipherScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	tcpConn, err := Dialer.Dial(Network, addr)
+	if err != nil {
+		return
+	}
+	defer tcpConn.Close()
+	tcpConn.SetDeadline(time.Now().Add(noSharedCipherTimeout))
+
+	config := opts.tlsConfig(hostname)
+	config.CipherSuites = []uint16{0x0000}
+	if _, herr := tls.Client(tcpConn, config).HelloWithExtensions(nil); herr != nil {
+		output = classifyNetError(herr)
+		if output == "alert: handshake failure" {
+			grade = Good
+		} else {
+			grade = Warning
+		}
+		return
+	}
+	output = "negotiated TLS_NULL_WITH_NULL_NULL"
+	return
+}
+
+// greaseTolerance describes the host's response to a ClientHello with GREASE values.
+type greaseTolerance struct {
+	Tolerated bool   `json:"tolerated"`
+	Error     string `json:"error,omitempty"`
+}
+
+// greaseScan sends the host a ClientHello with GREASE values (RFC 8701) among
+// its cipher suites, groups, and extensions, which servers must ignore, and
+// checks that it still responds with a ServerHello selecting a real cipher
+// suite. Hosts rejecting the ClientHello, when they accept one without GREASE,
+// would break with clients sending GREASE and are graded Bad.
+func greaseScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	curves := []tls.CurveID{29, tls.CurveP256, tls.CurveP384, tls.CurveP521}
+	hello := func(grease bool) (*tls.ServerHello, error) {
+		tcpConn, err := Dialer.Dial(Network, addr)
+		if err != nil {
+			return nil, err
+		}
+		defer tcpConn.Close()
+		tcpConn.SetDeadline(time.Now().Add(helloTimeout))
+
+		config := opts.tlsConfig(hostname)
+		config.CipherSuites = allCiphersIDs()
+		config.CurvePreferences = curves
+		var extensions []tls.Extension
+		if grease {
+			values := make([]uint16, 3)
+			for i := range values {
+				g := randomGREASE()
+				values[i] = uint16(g[0])<<8 | uint16(g[1])
+			}
+			config.CipherSuites = append([]uint16{values[0]}, config.CipherSuites...)
+			config.CurvePreferences = append([]tls.CurveID{tls.CurveID(values[0])}, curves...)
+			extensions = []tls.Extension{{Type: values[1]}}
+			// Two GREASE extensions must differ in type.
+			if values[2] != values[1] {
+				extensions = append(extensions, tls.Extension{Type: values[2], Data: []byte{0}})
+			}
+		}
+		return tls.Client(tcpConn, config).HelloWithExtensions(extensions)
+	}
+
+	if _, err = hello(false); err != nil {
+		return
+	}
+
+	serverHello, herr := hello(true)
+	switch {
+	case herr != nil:
+		output = greaseTolerance{Error: herr.Error()}
+	case serverHello.CipherSuite&0x0f0f == 0x0a0a:
+		output = greaseTolerance{Error: "selected a GREASE cipher suite"}
+	default:
+		grade, output = Good, greaseTolerance{Tolerated: true}
+	}
+	return
+}
+
+// removableExtensions are the ClientHello extensions extensionDependenciesScan
+// removes in turn, by name. Legacy ones are those clients predating TLS 1.3,
+// or older TLS 1.2 stacks, may leave out.
+var removableExtensions = []struct {
+	name   string
+	typ    uint16
+	legacy bool
+}{
+	{"server_name", 0, false},
+	{"status_request", 5, true},
+	{"supported_groups", extensionSupportedGroups, false},
+	{"ec_point_formats", 11, true},
+	{"signature_algorithms", extensionSignatureAlgs, false},
+	{"supported_versions", extensionSupportedVersions, true},
+	{"key_share", extensionKeyShare, false},
+	{"renegotiation_info", 0xff01, true},
+}
+
+// extensionDependenciesScan sends the host a ClientHello offering TLS 1.3 and
+// earlier versions, then the same ClientHello with each of
+// removableExtensions left out in turn, reporting whether the host still
+// responds with a ServerHello ("tolerated") or not ("broke"). Hosts requiring
+// an extension that older clients may not send are warned of.
+func extensionDependenciesScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	extensions, err := tls13Extensions(tls13Groups)
+	if err != nil {
+		return
+	}
+	var suites []uint16
+	for id := range tls.TLS13CipherSuites {
+		suites = append(suites, id)
+	}
+	suites = append(suites, allCiphersIDs()...)
+	hello := func(omit uint16, all bool) error {
+		tcpConn, err := Dialer.Dial(Network, addr)
+		if err != nil {
+			return err
+		}
+		defer tcpConn.Close()
+		tcpConn.SetDeadline(time.Now().Add(helloTimeout))
+
+		config := opts.tlsConfig(hostname)
+		config.CipherSuites = suites
+		config.MinVersion, config.MaxVersion = tls.VersionTLS12, tls.VersionTLS12
+		var exts []tls.Extension
+		for _, ext := range extensions {
+			if all || ext.Type != omit {
+				exts = append(exts, ext)
+			}
+		}
+		var omitted []uint16
+		if !all {
+			omitted = []uint16{omit}
+		}
+		_, err = tls.Client(tcpConn, config).HelloOmittingExtensions(exts, omitted)
+		return err
+	}
+
+	if err = hello(0, true); err != nil {
+		return
+	}
+
+	grade = Good
+	results := make(map[string]string)
+	for i, ext := range removableExtensions {
+		opts.progress(i, len(removableExtensions))
+		if herr := hello(ext.typ, false); herr != nil {
+			results[ext.name] = "broke"
+			if ext.legacy {
+				grade = Warning
+			}
+		} else {
+			results[ext.name] = "tolerated"
+		}
+	}
+	opts.progress(len(removableExtensions), len(removableExtensions))
+	output = results
+	return
+}
+
+// malformedHello is a handshake record holding a ClientHello whose body is
+// truncated to a single byte.
+var malformedHello = []byte{
+	0x16, 0x03, 0x01, 0x00, 0x05, // handshake record, 5 bytes
+	0x01, 0x00, 0x00, 0x01, // ClientHello, 1 byte
+	0x03,
+}
+
+// malformedHelloTimeout bounds how long malformedHelloScan waits for the host
+// to respond before judging it hung.
+var malformedHelloTimeout = 5 * time.Second
+
+// malformedHelloScan sends the host a malformed ClientHello, checking that it
+// responds with an alert rather than closing the connection without one or
+// hanging.
+func malformedHelloScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	conn, err := Dialer.Dial(Network, addr)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	if _, err = conn.Write(malformedHello); err != nil {
+		return
+	}
+
+	conn.SetReadDeadline(time.Now().Add(malformedHelloTimeout))
+	record := make([]byte, 7)
+	_, rerr := io.ReadFull(conn, record)
+	switch e, ok := rerr.(net.Error); {
+	case ok && e.Timeout():
+		grade, output = Warning, fmt.Sprintf("no response within %v", malformedHelloTimeout)
+	case rerr != nil:
+		grade, output = Warning, "closed connection without alert"
+	case record[0] != 0x15:
+		grade, output = Warning, fmt.Sprintf("sent record of type %d instead of an alert", record[0])
+	default:
+		grade, output = Good, fmt.Sprintf("sent %s alert", tls.AlertText(record[6]))
+	}
+	return
+}
+
+// duplicateExtensionScan sends the host a ClientHello carrying the
+// extended_master_secret extension twice, which servers must reject (RFC 8446,
+// section 4.2), checking that it aborts the handshake with an alert. Hosts
+// answering with a ServerHello, or closing the connection or hanging without
+// an alert, are warned of.
+func duplicateExtensionScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	tcpConn, err := Dialer.Dial(Network, addr)
+	if err != nil {
+		return
+	}
+	defer tcpConn.Close()
+	tcpConn.SetDeadline(time.Now().Add(malformedHelloTimeout))
+
+	duplicate := tls.Extension{Type: extensionExtendedMasterSecret}
+	_, herr := tls.Client(tcpConn, opts.tlsConfig(hostname)).HelloWithExtensions([]tls.Extension{duplicate, duplicate})
+	if herr == nil {
+		grade, output = Warning, "accepted"
+		return
+	}
+	switch result := classifyNetError(herr); {
+	case strings.HasPrefix(result, "alert: "):
+		grade, output = Good, fmt.Sprintf("sent %s alert", strings.TrimPrefix(result, "alert: "))
+	case result == "timeout":
+		grade, output = Warning, fmt.Sprintf("no response within %v", malformedHelloTimeout)
+	case result == "tls" || result == "other":
+		err = herr
+	default:
+		grade, output = Warning, "closed connection without alert"
+	}
+	return
+}
+
+// extensionPadding is the padding extension (RFC 7685).
+const extensionPadding = 21
+
+var (
+	// oversizedHelloSizes are the sizes of padding extension sent by
+	// oversizedHelloScan in otherwise valid ClientHellos, up to nearly the
+	// most the extensions block can hold.
+	oversizedHelloSizes = []int{1 << 10, 1 << 14, 1 << 15, 60000}
+	// oversizedHelloFlood is how much of a ClientHello claiming the maximum
+	// handshake message length oversizedHelloScan sends.
+	oversizedHelloFlood = 4 << 20
+	// oversizedHelloTimeout bounds how long each oversizedHelloScan probe
+	// waits on the host.
+	oversizedHelloTimeout = 10 * time.Second
+)
+
+// helloSizeResult is the host's response to a ClientHello of a given size:
+// "accepted", or how it failed, such as "alert: decode error".
+type helloSizeResult struct {
+	Size   int    `json:"size"`
+	Result string `json:"result"`
+}
+
+// oversizedHello describes how the host handles ever larger ClientHellos.
+type oversizedHello struct {
+	Sizes []helloSizeResult `json:"sizes"`
+	// Flood is how the host handled a ClientHello claiming 16 MiB, streamed
+	// until it's rejected or oversizedHelloFlood bytes are sent.
+	Flood string `json:"flood"`
+}
+
+// floodBuffered is the result of floodHello for hosts still waiting for the
+// rest of the ClientHello once all of it is sent.
+const floodBuffered = "buffered without limit"
+
+// floodHello sends the host the start of a ClientHello claiming the maximum
+// handshake message length, followed by zeros, describing how the host
+// rejects it. Hosts may reject it before all oversizedHelloFlood bytes are
+// sent, though not before their and the local socket buffers fill.
+func floodHello(addr string) (string, error) {
+	conn, err := Dialer.Dial(Network, addr)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(oversizedHelloTimeout))
+
+	record := make([]byte, 5+16384)
+	copy(record, []byte{0x16, 0x03, 0x01, 0x40, 0x00})
+	for sent := 0; sent < oversizedHelloFlood; sent += len(record) - 5 {
+		if sent == 0 {
+			// ClientHello of 16 MiB - 1 bytes, version TLS 1.2.
+			copy(record[5:], []byte{0x01, 0xff, 0xff, 0xff, 0x03, 0x03})
+		} else {
+			copy(record[5:], make([]byte, 6))
+		}
+		if _, werr := conn.Write(record); werr != nil {
+			return fmt.Sprintf("rejected after %d KiB: %s", sent>>10, classifyNetError(werr)), nil
+		}
+	}
+
+	response := make([]byte, 7)
+	_, rerr := io.ReadFull(conn, response)
+	switch e, ok := rerr.(net.Error); {
+	case ok && e.Timeout():
+		return floodBuffered, nil
+	case rerr != nil:
+		return "closed", nil
+	case response[0] == 0x15:
+		return fmt.Sprintf("sent %s alert", tls.AlertText(response[6])), nil
+	}
+	return fmt.Sprintf("sent record of type %d", response[0]), nil
+}
+
+// oversizedHelloScan sends the host valid ClientHellos with ever larger
+// padding extensions, reporting how it handles each, then streams a
+// ClientHello claiming 16 MiB. Hosts still waiting for more of it after all
+// oversizedHelloFlood bytes are open to memory amplification and warned of, as
+// are hosts hanging on a valid ClientHello rather than answering it.
+func oversizedHelloScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	var result oversizedHello
+	grade = Good
+	for i, size := range oversizedHelloSizes {
+		opts.progress(i, len(oversizedHelloSizes)+1)
+		herr := func() error {
+			tcpConn, err := Dialer.Dial(Network, addr)
+			if err != nil {
+				return err
+			}
+			defer tcpConn.Close()
+			tcpConn.SetDeadline(time.Now().Add(oversizedHelloTimeout))
+			_, err = tls.Client(tcpConn, opts.tlsConfig(hostname)).HelloWithExtensions([]tls.Extension{{Type: extensionPadding, Data: make([]byte, size)}})
+			return err
+		}()
+		r := helloSizeResult{Size: size, Result: "accepted"}
+		if herr != nil {
+			r.Result = classifyNetError(herr)
+			if r.Result == "timeout" {
+				grade = Warning
+			}
+		}
+		result.Sizes = append(result.Sizes, r)
+	}
+
+	opts.progress(len(oversizedHelloSizes), len(oversizedHelloSizes)+1)
+	if result.Flood, err = floodHello(addr); err != nil {
+		return
+	}
+	opts.progress(len(oversizedHelloSizes)+1, len(oversizedHelloSizes)+1)
+	if result.Flood == floodBuffered {
+		grade = Warning
+	}
+	output = &result
+	return
+}
@@ -1,6 +1,10 @@
 package scan
 
-import "github.com/cloudflare/cfssl/scan/crypto/tls"
+import (
+	"time"
+
+	"github.com/cloudflare/cfssl/scan/crypto/tls"
+)
 
 // TLSSession contains tests of host TLS Session Resumption via
 // Session Tickets and Session IDs
@@ -8,15 +12,35 @@ var TLSSession = &Family{
 	Description: "Scans host's implementation of TLS session resumption using session tickets/session IDs",
 	Scanners: map[string]*Scanner{
 		"SessionResume": {
-			"Host is able to resume sessions across all addresses",
-			sessionResumeScan,
+			Description: "Host is able to resume sessions across all addresses",
+			scan:        sessionResumeScan,
+		},
+		"HandshakeRTTs": {
+			Description: "Host's handshakes take at most one round trip",
+			scan:        handshakeRTTsScan,
+		},
+		"CrossVersionResumption": {
+			Description: "Host doesn't resume a session under a TLS version other than the one it was established with",
+			scan:        crossVersionResumptionScan,
+		},
+		"TicketKeySharing": {
+			Description: "Host's addresses all accept a session ticket issued by one of them",
+			scan:        ticketKeySharingScan,
+		},
+		"CorruptedTicket": {
+			Description: "Host falls back to a full handshake when offered a corrupted session ticket",
+			scan:        corruptedTicketScan,
+		},
+		"TicketLifetime": {
+			Description: "Host resumes a session from a ticket after a short delay, reporting the ticket's lifetime hint",
+			scan:        ticketLifetimeScan,
 		},
 	},
 }
 
 // SessionResumeScan tests that host is able to resume sessions across all addresses.
-func sessionResumeScan(addr, hostname string) (grade Grade, output Output, err error) {
-	config := defaultTLSConfig(hostname)
+func sessionResumeScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	config := opts.tlsConfig(hostname)
 	config.ClientSessionCache = tls.NewLRUClientSessionCache(1)
 
 	conn, err := tls.DialWithDialer(Dialer, Network, addr, config)
@@ -27,7 +51,7 @@ func sessionResumeScan(addr, hostname string) (grade Grade, output Output, err e
 		return
 	}
 
-	return multiscan(addr, func(addrport string) (g Grade, o Output, e error) {
+	return multiscan(addr, opts, func(addrport string) (g Grade, o Output, e error) {
 		var conn *tls.Conn
 		if conn, e = tls.DialWithDialer(Dialer, Network, addrport, config); e != nil {
 			return
@@ -40,3 +64,261 @@ func sessionResumeScan(addr, hostname string) (grade Grade, output Output, err e
 		return
 	})
 }
+
+// pinnedSessionCache is a ClientSessionCache that keeps only the first session
+// put into it, so that every connection using it offers that same session.
+type pinnedSessionCache struct {
+	session *tls.ClientSessionState
+}
+
+func (c *pinnedSessionCache) Get(sessionKey string) (*tls.ClientSessionState, bool) {
+	return c.session, c.session != nil
+}
+
+func (c *pinnedSessionCache) Put(sessionKey string, cs *tls.ClientSessionState) {
+	if c.session == nil {
+		c.session = cs
+	}
+}
+
+// ticketKeySharingScan tests that a session ticket issued by one of the host's
+// addresses can be resumed at every other, i.e. that they share ticket keys.
+// Hosts not issuing tickets are skipped.
+func ticketKeySharingScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	config := opts.tlsConfig(hostname)
+	cache := new(pinnedSessionCache)
+	config.ClientSessionCache = cache
+
+	conn, err := tls.DialWithDialer(Dialer, Network, addr, config)
+	if err != nil {
+		return
+	}
+	if err = conn.Close(); err != nil {
+		return
+	}
+
+	if cache.session == nil || len(cache.session.Ticket()) == 0 {
+		grade = Skipped
+		return
+	}
+
+	return multiscan(addr, opts, func(addrport string) (g Grade, o Output, e error) {
+		var conn *tls.Conn
+		if conn, e = tls.DialWithDialer(Dialer, Network, addrport, config); e != nil {
+			return
+		}
+		conn.Close()
+
+		if o = conn.ConnectionState().DidResume; o.(bool) {
+			g = Good
+		} else {
+			g = Warning
+		}
+		return
+	})
+}
+
+// corruptedTicket describes how the host handled a corrupted session ticket:
+// "full handshake", "resumed", or "failed".
+type corruptedTicket struct {
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+// corruptedTicketScan obtains a session ticket from the host, flips a byte in
+// the middle of it, and offers it for resumption, checking that the host
+// ignores it and completes a full handshake. Hosts failing the handshake are
+// warned of, and hosts resuming the session, so not authenticating their
+// tickets, are graded Bad. Hosts not issuing tickets are skipped.
+func corruptedTicketScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	config := opts.tlsConfig(hostname)
+	cache := new(pinnedSessionCache)
+	config.ClientSessionCache = cache
+
+	conn, err := tls.DialWithDialer(Dialer, Network, addr, config)
+	if err != nil {
+		return
+	}
+	if err = conn.Close(); err != nil {
+		return
+	}
+	if cache.session == nil || len(cache.session.Ticket()) == 0 {
+		grade = Skipped
+		return
+	}
+
+	ticket := append([]byte{}, cache.session.Ticket()...)
+	ticket[len(ticket)/2] ^= 0xff
+	cache.session = cache.session.WithTicket(ticket)
+
+	conn, herr := tls.DialWithDialer(Dialer, Network, addr, config)
+	switch {
+	case herr != nil:
+		grade, output = Warning, corruptedTicket{Result: "failed", Error: herr.Error()}
+	case conn.ConnectionState().DidResume:
+		output = corruptedTicket{Result: "resumed"}
+	default:
+		grade, output = Good, corruptedTicket{Result: "full handshake"}
+	}
+	if conn != nil {
+		conn.Close()
+	}
+	return
+}
+
+// TicketResumeDelay is how long the TicketLifetime scanner waits after
+// obtaining a session ticket before resuming the session with it.
+var TicketResumeDelay = 5 * time.Second
+
+// ticketLifetime describes the host's ticket lifetime hint and whether a session
+// could be resumed after TicketResumeDelay.
+type ticketLifetime struct {
+	// LifetimeHint is the lifetime the host advertised for its ticket, in
+	// seconds, zero if unspecified.
+	LifetimeHint int64  `json:"lifetime_hint"`
+	Delay        int64  `json:"delay"`
+	Resumed      bool   `json:"resumed"`
+	Error        string `json:"error,omitempty"`
+}
+
+// ticketLifetimeScan obtains a session ticket from the host, waits
+// TicketResumeDelay, and resumes the session with it, reporting the ticket's
+// lifetime hint and whether the session was resumed. It is informational, but
+// hosts not resuming the session, including by failing the handshake, or
+// advertising a lifetime shorter than the delay, are warned of. Hosts not
+// issuing tickets are skipped.
+func ticketLifetimeScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	config := opts.tlsConfig(hostname)
+	cache := new(pinnedSessionCache)
+	config.ClientSessionCache = cache
+
+	conn, err := tls.DialWithDialer(Dialer, Network, addr, config)
+	if err != nil {
+		return
+	}
+	if err = conn.Close(); err != nil {
+		return
+	}
+	if cache.session == nil || len(cache.session.Ticket()) == 0 {
+		grade = Skipped
+		return
+	}
+
+	time.Sleep(TicketResumeDelay)
+	hint := cache.session.LifetimeHint()
+	result := ticketLifetime{
+		LifetimeHint: int64(hint / time.Second),
+		Delay:        int64(TicketResumeDelay / time.Second),
+	}
+	if conn, herr := tls.DialWithDialer(Dialer, Network, addr, config); herr != nil {
+		result.Error = herr.Error()
+	} else {
+		conn.Close()
+		result.Resumed = conn.ConnectionState().DidResume
+	}
+	output = result
+
+	if !result.Resumed || (hint > 0 && hint < TicketResumeDelay) {
+		grade = Warning
+	} else {
+		grade = Good
+	}
+	return
+}
+
+// handshakeRTTs gives the network round trips taken by a full handshake with
+// the host and, if it resumes sessions, by a resumed handshake.
+type handshakeRTTs struct {
+	Version     string `json:"version"`
+	FullRTTs    int    `json:"full_rtts"`
+	ResumedRTTs int    `json:"resumed_rtts,omitempty"`
+}
+
+// handshakeRTTsScan infers the round trips the host's handshakes take from the
+// version it negotiates and whether it resumes sessions. TLS 1.3 handshakes
+// take one round trip, whether full or resumed, and are graded Good. Since
+// cf-tls can't complete a TLS 1.3 handshake, 0-RTT early data isn't tested.
+// Earlier versions take two round trips for a full handshake and are warned
+// of, even if resumed handshakes take one.
+func handshakeRTTsScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	var suites []uint16
+	for id := range tls.TLS13CipherSuites {
+		suites = append(suites, id)
+	}
+	if _, ok, herr := tls13Hello(addr, hostname, opts, suites, tls13Groups); herr == nil && ok {
+		grade, output = Good, handshakeRTTs{"TLS 1.3", 1, 1}
+		return
+	}
+
+	config := opts.tlsConfig(hostname)
+	config.ClientSessionCache = tls.NewLRUClientSessionCache(1)
+	result := handshakeRTTs{FullRTTs: 2}
+	for i := 0; i < 2; i++ {
+		var conn *tls.Conn
+		if conn, err = tls.DialWithDialer(Dialer, Network, addr, config); err != nil {
+			return
+		}
+		conn.Close()
+
+		state := conn.ConnectionState()
+		result.Version = tls.Versions[state.Version]
+		if state.DidResume {
+			result.ResumedRTTs = 1
+		}
+	}
+
+	grade, output = Warning, result
+	return
+}
+
+// ticketWait bounds how long crossVersionResumptionScan waits for a TLS 1.3
+// NewSessionTicket after the handshake.
+var ticketWait = time.Second
+
+// crossVersionResumptionScan offers the host a TLS 1.3 session ticket, obtained
+// through crypto/tls, in a TLS 1.2 ClientHello, reporting whether the host
+// resumed the session. Hosts must only resume sessions under the version they
+// were established with, and are graded Bad if they do. Offering a TLS 1.2
+// ticket under TLS 1.3 would need a pre_shared_key binder cf-tls can't compute,
+// so that direction isn't tested. Hosts without TLS 1.3, or issuing no ticket,
+// are skipped, as are all hosts when built with Go before 1.21.
+func crossVersionResumptionScan(addr, hostname string, opts *Options) (grade Grade, output Output, err error) {
+	var tls13Suites []uint16
+	for id := range tls.TLS13CipherSuites {
+		tls13Suites = append(tls13Suites, id)
+	}
+	if _, ok, herr := tls13Hello(addr, hostname, opts, tls13Suites, tls13Groups); herr != nil || !ok {
+		grade = Skipped
+		return
+	}
+
+	ticket, err := tls13Ticket(addr, hostname)
+	if err != nil || len(ticket) == 0 {
+		if err == nil {
+			grade = Skipped
+		}
+		return
+	}
+
+	tcpConn, err := Dialer.Dial(Network, addr)
+	if err != nil {
+		return
+	}
+	defer tcpConn.Close()
+	tcpConn.SetDeadline(time.Now().Add(helloTimeout))
+	config := opts.tlsConfig(hostname)
+	config.MaxVersion = tls.VersionTLS12
+	_, resumed, err := tls.Client(tcpConn, config).HelloWithTicket(ticket, nil)
+	if err != nil {
+		return
+	}
+
+	verdict := "rejected"
+	if resumed {
+		verdict = "accepted"
+	} else {
+		grade = Good
+	}
+	output = map[string]string{"TLS 1.3 to TLS 1.2": verdict}
+	return
+}